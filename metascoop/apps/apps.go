@@ -25,9 +25,19 @@ type AppInfo struct {
 
 	AntiFeatures []string `yaml:"anti_features"`
 
+	// Lock lists metadata fields that metascoop must not change, e.g. "Summary"
+	Lock []string `yaml:"lock"`
+
+	ReleaseTag         string
+	ReleaseURL         string
 	ReleaseDescription string
+	// ChangelogAssets are the download URLs of release assets with localized changelogs, by locale
+	ChangelogAssets map[string]string
 
 	License string
+
+	// Forge is the metadata found on the forge hosting the repository
+	Forge Metadata `yaml:"-"`
 }
 
 func (a AppInfo) Name() string {
@@ -41,6 +51,28 @@ func (a AppInfo) Author() string {
 	return a.repoAuthor
 }
 
+// Metadata returns the metadata fields set in the app file
+func (a AppInfo) Metadata() Metadata {
+	return Metadata{
+		AuthorName:   a.AuthorName,
+		Name:         a.FriendlyName,
+		SourceCode:   a.GitURL,
+		License:      a.License,
+		Summary:      a.Summary,
+		Description:  a.Description,
+		Categories:   a.Categories,
+		AntiFeatures: AntiFeatures{Names: a.AntiFeatures},
+	}
+}
+
+// DefaultMetadata returns the values used for fields that are empty or "Unknown" after fdroid created a metadata file
+func (a AppInfo) DefaultMetadata() Metadata {
+	return Metadata{
+		AuthorName: a.repoAuthor,
+		Name:       a.keyName,
+	}
+}
+
 // ParseAppFile returns the list of apps from the app file
 func ParseAppFile(filepath string) (list []AppInfo, err error) {
 	f, err := os.Open(filepath)
@@ -0,0 +1,86 @@
+package apps
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"metascoop/forge"
+	"metascoop/text"
+)
+
+// DefaultLocale is used for changelogs generated from release notes
+const DefaultLocale = "en-US"
+
+// maxChangelogLength is the maximum length of a changelog in the fastlane format, see
+// https://f-droid.org/en/docs/All_About_Descriptions_Graphics_and_Screenshots/
+const maxChangelogLength = 500
+
+// ChangelogPath returns the path of the changelog file for the given version in the metadata directory
+func ChangelogPath(metadataDir, packageName, locale string, versionCode int) string {
+	return filepath.Join(metadataDir, packageName, locale, "changelogs", fmt.Sprintf("%d.txt", versionCode))
+}
+
+// FormatChangelog converts release notes written in markdown to a plain text changelog.
+// Notes that are too long are truncated and end with a link to the full release.
+// Windows line endings are converted like fdroid does it, so clients show the same text
+func FormatChangelog(releaseNotes, releaseURL string) string {
+	releaseNotes = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(releaseNotes)
+
+	var link string
+	if releaseURL != "" {
+		link = "Full release notes: " + releaseURL
+	}
+
+	return text.TruncateWithLink(text.MarkdownToText(releaseNotes), maxChangelogLength, link)
+}
+
+// WriteChangelog writes content to the changelog file of the given version
+func WriteChangelog(metadataDir, packageName, locale string, versionCode int, content string) (path string, err error) {
+	path = ChangelogPath(metadataDir, packageName, locale, versionCode)
+
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return
+	}
+
+	err = os.WriteFile(path, []byte(content), os.ModePerm)
+
+	return
+}
+
+// changelogAssetRegex matches release assets with localized changelogs, e.g. "changelog-de-DE.txt"
+var changelogAssetRegex = regexp.MustCompile(`(?i)^changelog[-_.]([a-z]{2,3}(?:[-_][a-z0-9]{2,8})?)\.(?:txt|md)$`)
+
+// FindChangelogAssets returns the download URLs of all release assets that contain a changelog, keyed by locale
+func FindChangelogAssets(release forge.Release) (assets map[string]string) {
+	for _, asset := range release.Assets {
+		m := changelogAssetRegex.FindStringSubmatch(asset.Name)
+		if m == nil {
+			continue
+		}
+
+		if assets == nil {
+			assets = make(map[string]string)
+		}
+		assets[normalizeLocale(m[1])] = asset.URL
+	}
+
+	return
+}
+
+// normalizeLocale converts locales like "de_de" to the "de-DE" form used by F-Droid
+func normalizeLocale(locale string) string {
+	split := strings.Split(strings.ReplaceAll(locale, "_", "-"), "-")
+
+	split[0] = strings.ToLower(split[0])
+	for i := 1; i < len(split); i++ {
+		if len(split[i]) == 2 {
+			split[i] = strings.ToUpper(split[i])
+		}
+	}
+
+	return strings.Join(split, "-")
+}
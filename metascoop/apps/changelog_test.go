@@ -0,0 +1,19 @@
+package apps
+
+import "testing"
+
+func TestFormatChangelog(t *testing.T) {
+	tests := []struct {
+		notes string
+		want  string
+	}{
+		{"Fixed a crash\r\n\r\n* Faster sync\r\n", "Fixed a crash\n\n• Faster sync"},
+		{"Old Mac\r\rline endings", "Old Mac\n\nline endings"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatChangelog(tt.notes, ""); got != tt.want {
+			t.Errorf("FormatChangelog(%q) = %q, want %q", tt.notes, got, tt.want)
+		}
+	}
+}
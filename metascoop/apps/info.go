@@ -1,25 +1,22 @@
 package apps
 
 import (
-	"context"
 	"fmt"
 	"strings"
 	"unicode"
 
-	"github.com/google/go-github/v39/github"
 	"golang.org/x/text/runes"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
-)
 
-func FindAPKRelease(release *github.RepositoryRelease) *github.ReleaseAsset {
-	for _, asset := range release.Assets {
-		if asset.State == nil || *asset.State != "uploaded" {
-			continue
-		}
+	"metascoop/forge"
+)
 
-		if asset.Name != nil && strings.HasSuffix(*asset.Name, ".apk") {
-			return asset
+// FindAPKRelease returns the first APK attached to release, or nil if it has none
+func FindAPKRelease(release forge.Release) *forge.Asset {
+	for i, asset := range release.Assets {
+		if strings.HasSuffix(asset.Name, ".apk") {
+			return &release.Assets[i]
 		}
 	}
 
@@ -51,23 +48,3 @@ func GenerateReleaseFilename(appName string, tagName string) string {
 		return -1
 	}, cleaned)
 }
-
-func ListAllReleases(githubClient *github.Client, appRepoAuthor, appRepoName string) (allReleases []*github.RepositoryRelease, err error) {
-	var currentPage int = 1
-
-	for {
-		rels, _, ierr := githubClient.Repositories.ListReleases(context.Background(), appRepoAuthor, appRepoName, &github.ListOptions{
-			Page:    currentPage,
-			PerPage: 100,
-		})
-		if ierr != nil || len(rels) == 0 {
-			err = ierr
-			break
-		}
-
-		allReleases = append(allReleases, rels...)
-		currentPage++
-	}
-
-	return
-}
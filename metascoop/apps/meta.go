@@ -1,31 +1,253 @@
 package apps
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
-func ReadMetaFile(path string) (d map[string]interface{}, err error) {
+// Metadata is the content of an app's metadata/<packageName>.yml file,
+// see https://f-droid.org/en/docs/Build_Metadata_Reference/ for all fields.
+//
+// Files are read into a yaml.Node and only the fields that actually changed are written back,
+// so keys unknown to this struct, comments, key order and formatting are preserved
+type Metadata struct {
+	Disabled     string       `yaml:"Disabled,omitempty"`
+	AntiFeatures AntiFeatures `yaml:"AntiFeatures,omitempty"`
+	Provides     string       `yaml:"Provides,omitempty"`
+	Categories   []string     `yaml:"Categories,omitempty"`
+	License      string       `yaml:"License,omitempty"`
+
+	AuthorName    string `yaml:"AuthorName,omitempty"`
+	AuthorEmail   string `yaml:"AuthorEmail,omitempty"`
+	AuthorWebSite string `yaml:"AuthorWebSite,omitempty"`
+
+	WebSite        string `yaml:"WebSite,omitempty"`
+	SourceCode     string `yaml:"SourceCode,omitempty"`
+	IssueTracker   string `yaml:"IssueTracker,omitempty"`
+	Translation    string `yaml:"Translation,omitempty"`
+	Changelog      string `yaml:"Changelog,omitempty"`
+	Donate         string `yaml:"Donate,omitempty"`
+	Liberapay      string `yaml:"Liberapay,omitempty"`
+	OpenCollective string `yaml:"OpenCollective,omitempty"`
+	Bitcoin        string `yaml:"Bitcoin,omitempty"`
+	Litecoin       string `yaml:"Litecoin,omitempty"`
+
+	Name            string `yaml:"Name,omitempty"`
+	AutoName        string `yaml:"AutoName,omitempty"`
+	Summary         string `yaml:"Summary,omitempty"`
+	Description     string `yaml:"Description,omitempty"`
+	MaintainerNotes string `yaml:"MaintainerNotes,omitempty"`
+
+	RepoType string `yaml:"RepoType,omitempty"`
+	Repo     string `yaml:"Repo,omitempty"`
+	Binaries string `yaml:"Binaries,omitempty"`
+
+	AllowedAPKSigningKeys []string `yaml:"AllowedAPKSigningKeys,omitempty"`
+
+	RequiresRoot       bool   `yaml:"RequiresRoot,omitempty"`
+	ArchivePolicy      string `yaml:"ArchivePolicy,omitempty"`
+	AutoUpdateMode     string `yaml:"AutoUpdateMode,omitempty"`
+	UpdateCheckMode    string `yaml:"UpdateCheckMode,omitempty"`
+	UpdateCheckData    string `yaml:"UpdateCheckData,omitempty"`
+	UpdateCheckIgnore  string `yaml:"UpdateCheckIgnore,omitempty"`
+	VercodeOperation   string `yaml:"VercodeOperation,omitempty"`
+	NoSourceSince      string `yaml:"NoSourceSince,omitempty"`
+	CurrentVersion     string `yaml:"CurrentVersion,omitempty"`
+	CurrentVersionCode int    `yaml:"CurrentVersionCode,omitempty"`
+
+	// doc is the document this metadata was read from
+	doc *yaml.Node
+}
+
+// AntiFeatures can be written as a list, a comma-separated string or a mapping of anti-features to
+// the reasons for them. Reasons are only kept from the mapping form, which is written back then
+type AntiFeatures struct {
+	Names []string
+	// Reasons are the texts explaining each anti-feature by locale. They are nil if the list form was used
+	Reasons map[string]map[string]string
+
+	// nodes are the reasons as they were read, so that unchanged reasons are written back in the same form
+	nodes map[string]*yaml.Node
+}
+
+// defaultLocale is the locale of reasons that are written as a plain text, like fdroid does
+const defaultLocale = "en-US"
+
+func (a *AntiFeatures) UnmarshalYAML(value *yaml.Node) (err error) {
+	*a = AntiFeatures{}
+
+	switch value.Kind {
+	case yaml.ScalarNode:
+		for _, s := range strings.Split(value.Value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				a.Names = append(a.Names, s)
+			}
+		}
+		return nil
+	case yaml.MappingNode:
+		a.Reasons = make(map[string]map[string]string)
+		a.nodes = make(map[string]*yaml.Node)
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			name, node := value.Content[i].Value, value.Content[i+1]
+			a.Names = append(a.Names, name)
+			a.nodes[name] = node
+
+			reason, err := decodeReason(node)
+			if err != nil {
+				return fmt.Errorf("reason for anti-feature %s: %w", name, err)
+			}
+			if len(reason) > 0 {
+				a.Reasons[name] = reason
+			}
+		}
+		return nil
+	}
+
+	return value.Decode(&a.Names)
+}
+
+// decodeReason returns the reason of an anti-feature by locale. It is nil if there is no reason
+func decodeReason(node *yaml.Node) (reason map[string]string, err error) {
+	switch {
+	case node.Kind == yaml.ScalarNode && node.Tag != "!!null":
+		return map[string]string{defaultLocale: node.Value}, nil
+	case node.Kind == yaml.MappingNode:
+		err = node.Decode(&reason)
+		if len(reason) == 0 {
+			reason = nil
+		}
+	}
+	return
+}
+
+func (a AntiFeatures) MarshalYAML() (interface{}, error) {
+	if a.Reasons == nil {
+		return a.Names, nil
+	}
+
+	var mapping = &yaml.Node{Kind: yaml.MappingNode}
+	for _, name := range a.Names {
+		reason, err := a.reasonNode(name)
+		if err != nil {
+			return nil, err
+		}
+
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, reason)
+	}
+
+	return mapping, nil
+}
+
+// reasonNode returns the reason for name as it was read if it didn't change. New reasons are written
+// as a mapping of locales, and anti-features without a reason get an empty value
+func (a AntiFeatures) reasonNode(name string) (node *yaml.Node, err error) {
+	reason := a.Reasons[name]
+
+	if old, ok := a.nodes[name]; ok {
+		oldReason, err := decodeReason(old)
+		if err == nil && reflect.DeepEqual(oldReason, reason) {
+			return old, nil
+		}
+	}
+
+	if len(reason) == 0 {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}, nil
+	}
+
+	node = &yaml.Node{}
+	err = node.Encode(reason)
+	return
+}
+
+// equal returns whether a and b have the same anti-features and reasons, no matter how they were written
+func (a AntiFeatures) equal(b AntiFeatures) bool {
+	return reflect.DeepEqual(a.Names, b.Names) && reflect.DeepEqual(a.Reasons, b.Reasons)
+}
+
+// withReasonsOf returns a with the reasons of old, if a has none and old used the mapping form
+func (a AntiFeatures) withReasonsOf(old AntiFeatures) AntiFeatures {
+	if a.Reasons != nil || old.Reasons == nil {
+		return a
+	}
+
+	a.Reasons = make(map[string]map[string]string)
+	a.nodes = make(map[string]*yaml.Node)
+	for _, name := range a.Names {
+		if reason, ok := old.Reasons[name]; ok {
+			a.Reasons[name] = reason
+		}
+		if node, ok := old.nodes[name]; ok {
+			a.nodes[name] = node
+		}
+	}
+
+	return a
+}
+
+func ReadMetaFile(path string) (m *Metadata, err error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return
 	}
 	defer f.Close()
 
-	err = yaml.NewDecoder(f).Decode(&d)
+	var doc yaml.Node
+
+	err = yaml.NewDecoder(f).Decode(&doc)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return
+	}
+
+	m = new(Metadata)
+
+	// An empty file doesn't contain any node, so we start a new document
+	if doc.Kind == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a mapping at the top level of %q", path)
+	}
+
+	err = doc.Decode(m)
+	if err != nil {
+		return nil, err
+	}
+
+	m.doc = &doc
 
 	return
 }
 
-func WriteMetaFile(path string, data map[string]interface{}) (err error) {
+func WriteMetaFile(path string, m *Metadata) (err error) {
+	if m.doc == nil {
+		m.doc = &yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+
+	_, err = m.updateNode(m.doc.Content[0])
+	if err != nil {
+		return
+	}
+
 	tmpPath := path + ".tmp"
 	f, err := os.Create(tmpPath)
 	if err != nil {
 		return
 	}
 
-	err = yaml.NewEncoder(f).Encode(data)
+	err = yaml.NewEncoder(f).Encode(m.doc)
 	if err != nil {
 		_ = f.Close()
 		return
@@ -38,3 +260,98 @@ func WriteMetaFile(path string, data map[string]interface{}) (err error) {
 
 	return os.Rename(tmpPath, path)
 }
+
+// Changes returns the fields whose value differs from the file the metadata was read from, which are the
+// fields WriteMetaFile changes
+func (m *Metadata) Changes() (fields []string) {
+	var mapping = &yaml.Node{Kind: yaml.MappingNode}
+	if m.doc != nil {
+		mapping.Content = append(mapping.Content, m.doc.Content[0].Content...)
+	}
+
+	// The copy of the content keeps the document from being changed
+	fields, _ = m.updateNode(mapping)
+
+	return
+}
+
+// updateNode writes all fields of m whose value differs from the one in mapping into it and returns their names.
+// Values that didn't change are left alone, which keeps their formatting and comments
+func (m *Metadata) updateNode(mapping *yaml.Node) (changed []string, err error) {
+	var (
+		v = reflect.ValueOf(m).Elem()
+		t = v.Type()
+	)
+
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" {
+			continue
+		}
+
+		value := v.Field(i)
+
+		keyIndex := -1
+		for j := 0; j+1 < len(mapping.Content); j += 2 {
+			if mapping.Content[j].Value == key {
+				keyIndex = j
+				break
+			}
+		}
+
+		if keyIndex < 0 {
+			if value.IsZero() {
+				continue
+			}
+
+			var newValue yaml.Node
+			err = newValue.Encode(value.Interface())
+			if err != nil {
+				return changed, fmt.Errorf("encoding %s: %w", key, err)
+			}
+
+			mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, &newValue)
+			changed = append(changed, key)
+			continue
+		}
+
+		oldValue := mapping.Content[keyIndex+1]
+
+		current := reflect.New(value.Type())
+		if oldValue.Decode(current.Interface()) == nil && sameValue(current.Elem().Interface(), value.Interface()) {
+			continue
+		}
+
+		changed = append(changed, key)
+
+		if value.IsZero() {
+			mapping.Content = append(mapping.Content[:keyIndex], mapping.Content[keyIndex+2:]...)
+			continue
+		}
+
+		var newValue yaml.Node
+		err = newValue.Encode(value.Interface())
+		if err != nil {
+			return changed, fmt.Errorf("encoding %s: %w", key, err)
+		}
+
+		newValue.HeadComment = oldValue.HeadComment
+		newValue.LineComment = oldValue.LineComment
+		newValue.FootComment = oldValue.FootComment
+		if newValue.Kind == yaml.ScalarNode && oldValue.Kind == yaml.ScalarNode && oldValue.Style == yaml.LiteralStyle && strings.Contains(newValue.Value, "\n") {
+			newValue.Style = yaml.LiteralStyle
+		}
+
+		mapping.Content[keyIndex+1] = &newValue
+	}
+
+	return
+}
+
+// sameValue returns whether two values of a metadata field are the same
+func sameValue(a, b interface{}) bool {
+	if af, ok := a.(AntiFeatures); ok {
+		return af.equal(b.(AntiFeatures))
+	}
+	return reflect.DeepEqual(a, b)
+}
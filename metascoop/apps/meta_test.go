@@ -0,0 +1,159 @@
+package apps
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMetaFileRoundTrip(t *testing.T) {
+	const input = `# Maintained by hand
+Categories:
+    - System
+UnknownKey: keep me
+Description: |
+    First line
+    Second line
+Summary: 'Old summary ' # comment
+AntiFeatures:
+    NonFreeNet:
+        en-US: Talks to a server
+CurrentVersionCode: 1
+`
+
+	const want = `# Maintained by hand
+Categories:
+    - System
+UnknownKey: keep me
+Description: |
+    First line
+    Second line
+Summary: New summary # comment
+AntiFeatures:
+    NonFreeNet:
+        en-US: Talks to a server
+CurrentVersionCode: 2
+CurrentVersion: 1.0.1
+`
+
+	path := filepath.Join(t.TempDir(), "com.example.app.yml")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := ReadMetaFile(path)
+	if err != nil {
+		t.Fatalf("reading meta file: %s", err.Error())
+	}
+
+	if !reflect.DeepEqual(meta.AntiFeatures.Names, []string{"NonFreeNet"}) || meta.AntiFeatures.Reasons["NonFreeNet"]["en-US"] != "Talks to a server" {
+		t.Errorf("unexpected anti-features %+v", meta.AntiFeatures)
+	}
+
+	meta.Summary = "New summary"
+	meta.Categories = []string{"System"}
+	meta.AntiFeatures = AntiFeatures{Names: []string{"NonFreeNet"}, Reasons: map[string]map[string]string{"NonFreeNet": {"en-US": "Talks to a server"}}}
+	meta.CurrentVersion = "1.0.1"
+	meta.CurrentVersionCode = 2
+
+	// The fields are in the order of the struct
+	if changes := meta.Changes(); !reflect.DeepEqual(changes, []string{"Summary", "CurrentVersion", "CurrentVersionCode"}) {
+		t.Errorf("Changes() = %v, want [Summary CurrentVersion CurrentVersionCode]", changes)
+	}
+
+	if err := WriteMetaFile(path, meta); err != nil {
+		t.Fatalf("writing meta file: %s", err.Error())
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != want {
+		t.Errorf("unexpected meta file content:\n%s\nwanted:\n%s", got, want)
+	}
+
+	if changes := meta.Changes(); len(changes) != 0 {
+		t.Errorf("Changes() after writing = %v, want none", changes)
+	}
+}
+
+func TestAntiFeatureReasonsRoundTrip(t *testing.T) {
+	const input = `AntiFeatures:
+    NonFreeNet:
+        en-US: Talks to a server
+        de: Spricht mit einem Server
+    Ads: Shows ads
+    NonFreeDep:
+Name: App
+`
+
+	// The new anti-feature from apps.yaml has no reason, the others are written like they were read
+	const want = `AntiFeatures:
+    NonFreeNet:
+        en-US: Talks to a server
+        de: Spricht mit einem Server
+    Ads: Shows ads
+    NonFreeDep:
+    Tracking:
+Name: App
+`
+
+	path := filepath.Join(t.TempDir(), "com.example.app.yml")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		antiFeatures []string
+		want         string
+	}{
+		{[]string{"NonFreeNet", "Ads", "NonFreeDep"}, input},
+		{[]string{"NonFreeNet", "Ads", "NonFreeDep", "Tracking"}, want},
+	} {
+		meta, err := ReadMetaFile(path)
+		if err != nil {
+			t.Fatalf("reading meta file: %s", err.Error())
+		}
+
+		Resolve(meta, []Layer{{Source: SourceAppsFile, Metadata: AppInfo{AntiFeatures: tc.antiFeatures}.Metadata()}}, Metadata{})
+
+		if err := WriteMetaFile(path, meta); err != nil {
+			t.Fatalf("writing meta file: %s", err.Error())
+		}
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("unexpected meta file content with anti-features %q:\n%s\nwanted:\n%s", tc.antiFeatures, got, tc.want)
+		}
+
+		// Reading the file again gives the same anti-features
+		again, err := ReadMetaFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(again.AntiFeatures.Names, meta.AntiFeatures.Names) || !reflect.DeepEqual(again.AntiFeatures.Reasons, meta.AntiFeatures.Reasons) {
+			t.Errorf("anti-features changed after writing: %+v, wanted %+v", again.AntiFeatures, meta.AntiFeatures)
+		}
+	}
+
+	// Re-encoding the anti-features doesn't change their form either
+	meta, err := ReadMetaFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := yaml.Marshal(meta.AntiFeatures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wantAntiFeatures := "NonFreeNet:\n    en-US: Talks to a server\n    de: Spricht mit einem Server\nAds: Shows ads\nNonFreeDep:\nTracking:\n"; string(got) != wantAntiFeatures {
+		t.Errorf("encoded anti-features:\n%s\nwanted:\n%s", got, wantAntiFeatures)
+	}
+}
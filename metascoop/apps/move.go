@@ -0,0 +1,148 @@
+package apps
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Move is a new location of the repository of an app, e.g. because it was renamed or transferred to another owner
+type Move struct {
+	// App is the key of the app in the app file
+	App  string `json:"app"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// MoveRepo changes the git URL of the app, which also changes the author derived from it
+func (a *AppInfo) MoveRepo(gitURL string) (err error) {
+	u, err := url.ParseRequestURI(gitURL)
+	if err != nil {
+		return
+	}
+
+	a.GitURL = gitURL
+	a.repoAuthor = strings.Split(strings.Trim(u.Path, "/"), "/")[0]
+
+	return
+}
+
+// RewriteAppFile replaces the git URLs of the moved apps in the content of an app file. Only the URLs are
+// replaced, so comments and formatting are kept
+func RewriteAppFile(content []byte, moves []Move) (rewritten []byte, err error) {
+	var doc yaml.Node
+	err = yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("app file is not a mapping of apps")
+	}
+
+	var to = make(map[string]string)
+	for _, m := range moves {
+		to[m.App] = m.To
+	}
+
+	lines := strings.Split(string(content), "\n")
+
+	apps := doc.Content[0].Content
+	for i := 0; i+1 < len(apps); i += 2 {
+		newURL, ok := to[apps[i].Value]
+		if !ok || apps[i+1].Kind != yaml.MappingNode {
+			continue
+		}
+
+		fields := apps[i+1].Content
+		for j := 0; j+1 < len(fields); j += 2 {
+			if fields[j].Value != "git" {
+				continue
+			}
+
+			v := fields[j+1]
+			line := lines[v.Line-1]
+
+			// The column is counted in characters and points at the quote if the URL is quoted
+			offset := len(string([]rune(line)[:v.Column-1]))
+			k := strings.Index(line[offset:], v.Value)
+			if k < 0 {
+				return nil, fmt.Errorf("cannot find git URL of app %q in line %d", apps[i].Value, v.Line)
+			}
+			k += offset
+
+			lines[v.Line-1] = line[:k] + newURL + line[k+len(v.Value):]
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// Patch returns a unified diff from old to new content of the file name, which can be applied with
+// "git apply" or "patch -p1". Both must have the same number of lines, as RewriteAppFile only changes lines
+func Patch(name string, old, new []byte) string {
+	oldLines := strings.Split(string(old), "\n")
+	newLines := strings.Split(string(new), "\n")
+	if len(oldLines) != len(newLines) {
+		return ""
+	}
+
+	var changed []int
+	for i := range oldLines {
+		if oldLines[i] != newLines[i] {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	// The last element is empty if the file ends with a newline, it isn't a line of its own
+	n := len(oldLines)
+	if oldLines[n-1] == "" && newLines[n-1] == "" {
+		n--
+	}
+
+	const context = 3
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", name, name)
+
+	for len(changed) > 0 {
+		start := changed[0] - context
+		if start < 0 {
+			start = 0
+		}
+		end := hunkEnd(changed[0], context, n)
+
+		// Changes that are close to each other share a hunk
+		var k = 1
+		for k < len(changed) && changed[k]-context <= end {
+			end = hunkEnd(changed[k], context, n)
+			k++
+		}
+		inHunk := changed[:k]
+		changed = changed[k:]
+
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", start+1, end-start, start+1, end-start)
+		for i := start; i < end; i++ {
+			if len(inHunk) > 0 && inHunk[0] == i {
+				fmt.Fprintf(&sb, "-%s\n+%s\n", oldLines[i], newLines[i])
+				inHunk = inHunk[1:]
+				continue
+			}
+			fmt.Fprintf(&sb, " %s\n", oldLines[i])
+		}
+	}
+
+	return sb.String()
+}
+
+// hunkEnd is the end of a hunk with the changed line i, which doesn't go past the last line n
+func hunkEnd(i, context, n int) int {
+	if i+context+1 > n {
+		return n
+	}
+	return i + context + 1
+}
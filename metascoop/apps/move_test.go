@@ -0,0 +1,59 @@
+package apps
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewriteAppFile(t *testing.T) {
+	content := `# Apps in the repo
+notes:
+  git: https://github.com/example/notes # moved
+  name: Notes
+timer:
+  git: "https://codeberg.org/example/timer"
+scanner:
+  name: Scänner
+  git: https://gitlab.com/example/scanner
+`
+
+	rewritten, err := RewriteAppFile([]byte(content), []Move{
+		{App: "notes", From: "https://github.com/example/notes", To: "https://github.com/org/notes"},
+		{App: "scanner", From: "https://gitlab.com/example/scanner", To: "https://gitlab.com/org/scanner"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.NewReplacer(
+		"github.com/example/notes", "github.com/org/notes",
+		"gitlab.com/example/scanner", "gitlab.com/org/scanner",
+	).Replace(content)
+	if string(rewritten) != want {
+		t.Errorf("RewriteAppFile() =\n%s\nwant\n%s", rewritten, want)
+	}
+
+	patch := Patch("apps.yaml", []byte(content), rewritten)
+	wantPatch := `--- a/apps.yaml
++++ b/apps.yaml
+@@ -1,9 +1,9 @@
+ # Apps in the repo
+ notes:
+-  git: https://github.com/example/notes # moved
++  git: https://github.com/org/notes # moved
+   name: Notes
+ timer:
+   git: "https://codeberg.org/example/timer"
+ scanner:
+   name: Scänner
+-  git: https://gitlab.com/example/scanner
++  git: https://gitlab.com/org/scanner
+`
+	if patch != wantPatch {
+		t.Errorf("Patch() =\n%s\nwant\n%s", patch, wantPatch)
+	}
+
+	if patch := Patch("apps.yaml", []byte(content), []byte(content)); patch != "" {
+		t.Errorf("Patch() of unchanged content = %q, want empty", patch)
+	}
+}
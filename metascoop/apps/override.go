@@ -0,0 +1,137 @@
+package apps
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source describes where the value of a metadata field came from
+type Source string
+
+// Sources in order of precedence, the first one that has a value for a field wins.
+// Fields that are locked keep the value of the metadata file
+const (
+	SourceLocked   Source = "locked"
+	SourceAppsFile Source = "apps.yaml"
+	SourceOverride Source = "override file"
+	SourceForge    Source = "forge"
+	// SourceMetadataFile values were already in the metadata file and no other source has one
+	SourceMetadataFile Source = "metadata file"
+	// SourceDefault values are derived from the app, e.g. the author from the repository owner
+	SourceDefault Source = "default"
+)
+
+// Override is a hand-written file with metadata that should be applied to an app on every run.
+// It has the same fields as a metadata file, plus a list of fields that metascoop must not touch
+type Override struct {
+	Metadata `yaml:",inline"`
+
+	Lock []string `yaml:"lock"`
+}
+
+// ReadOverrideFile reads the override file at path. If the file doesn't exist, o is nil
+func ReadOverrideFile(path string) (o *Override, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+
+	o = new(Override)
+	err = yaml.Unmarshal(content, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// Layer is the metadata provided by a source
+type Layer struct {
+	Source   Source
+	Metadata Metadata
+}
+
+// Resolution records which source won for a field
+type Resolution struct {
+	Field  string
+	Source Source
+}
+
+// IsLocked returns whether field is in one of the lock lists
+func IsLocked(field string, locks ...[]string) bool {
+	for _, list := range locks {
+		for _, l := range list {
+			if strings.EqualFold(strings.TrimSpace(l), field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Resolve sets the fields of meta from the given layers, which must be ordered by precedence.
+// The current values of meta are the fdroid defaults; they are only replaced by a layer
+// value or, if they are empty or "Unknown", by the value of defaults.
+// Fields that are locked or that no source has a value for are left alone
+func Resolve(meta *Metadata, layers []Layer, defaults Metadata, locks ...[]string) (resolutions []Resolution) {
+	var (
+		v = reflect.ValueOf(meta).Elem()
+		t = v.Type()
+	)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if IsLocked(field.Name, locks...) {
+			resolutions = append(resolutions, Resolution{Field: field.Name, Source: SourceLocked})
+			continue
+		}
+
+		var found bool
+		for _, l := range layers {
+			lv := reflect.ValueOf(l.Metadata).Field(i)
+			if lv.IsZero() {
+				continue
+			}
+
+			if old, ok := v.Field(i).Interface().(AntiFeatures); ok {
+				// The reasons of the metadata file stay, unless the layer has its own
+				lv = reflect.ValueOf(lv.Interface().(AntiFeatures).withReasonsOf(old))
+			}
+
+			v.Field(i).Set(lv)
+			resolutions = append(resolutions, Resolution{Field: field.Name, Source: l.Source})
+			found = true
+			break
+		}
+		if found {
+			continue
+		}
+
+		current := v.Field(i)
+		if !current.IsZero() && !(current.Kind() == reflect.String && current.String() == "Unknown") {
+			resolutions = append(resolutions, Resolution{Field: field.Name, Source: SourceMetadataFile})
+			continue
+		}
+
+		dv := reflect.ValueOf(defaults).Field(i)
+		if dv.IsZero() {
+			continue
+		}
+
+		current.Set(dv)
+		resolutions = append(resolutions, Resolution{Field: field.Name, Source: SourceDefault})
+	}
+
+	return
+}
@@ -0,0 +1,51 @@
+package apps
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	meta := Metadata{
+		Name:       "Unknown",
+		Summary:    "Hand-written summary",
+		License:    "Unknown",
+		WebSite:    "https://example.com",
+		AuthorName: "",
+	}
+
+	layers := []Layer{
+		{Source: SourceAppsFile, Metadata: Metadata{Description: "From apps.yaml"}},
+		{Source: SourceOverride, Metadata: Metadata{License: "MIT", Description: "From override"}},
+		{Source: SourceForge, Metadata: Metadata{Summary: "From forge", License: "GPL-3.0-only"}},
+	}
+
+	resolutions := Resolve(&meta, layers, Metadata{Name: "app", AuthorName: "author"}, []string{"summary"})
+
+	want := Metadata{
+		Name:        "app",
+		Summary:     "Hand-written summary",
+		License:     "MIT",
+		Description: "From apps.yaml",
+		WebSite:     "https://example.com",
+		AuthorName:  "author",
+	}
+	if meta.Name != want.Name || meta.Summary != want.Summary || meta.License != want.License ||
+		meta.Description != want.Description || meta.WebSite != want.WebSite || meta.AuthorName != want.AuthorName {
+		t.Errorf("unexpected metadata %+v, wanted %+v", meta, want)
+	}
+
+	sources := map[string]Source{}
+	for _, r := range resolutions {
+		sources[r.Field] = r.Source
+	}
+
+	for field, source := range map[string]Source{
+		"Summary":     SourceLocked,
+		"License":     SourceOverride,
+		"Description": SourceAppsFile,
+		"Name":        SourceDefault,
+		"WebSite":     SourceMetadataFile,
+	} {
+		if sources[field] != source {
+			t.Errorf("field %s: got source %q, wanted %q", field, sources[field], source)
+		}
+	}
+}
@@ -1,13 +1,51 @@
 package apps
 
 import (
+	"context"
+	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+
+	"metascoop/forge"
 )
 
 type RepoMetadata struct {
 	Screenshots []string
+
+	// Changelogs are the paths of changelog files from the fastlane metadata tree, by locale and versionCode
+	Changelogs map[string]map[int]string
+}
+
+// fastlaneChangelogRegex matches changelogs in the fastlane directory structure supported by F-Droid,
+// see https://f-droid.org/en/docs/All_About_Descriptions_Graphics_and_Screenshots/
+var fastlaneChangelogRegex = regexp.MustCompile(`(?:^|/)fastlane/metadata/android/([^/]+)/changelogs/(\d+)\.txt$`)
+
+func fastlaneChangelog(path string) (locale string, versionCode int, ok bool) {
+	m := fastlaneChangelogRegex.FindStringSubmatch(filepath.ToSlash(path))
+	if m == nil {
+		return
+	}
+
+	versionCode, err := strconv.Atoi(m[2])
+	if err != nil {
+		return
+	}
+
+	return m[1], versionCode, true
+}
+
+func (r *RepoMetadata) addChangelog(locale string, versionCode int, path string) {
+	if r.Changelogs == nil {
+		r.Changelogs = make(map[string]map[int]string)
+	}
+	if r.Changelogs[locale] == nil {
+		r.Changelogs[locale] = make(map[int]string)
+	}
+	r.Changelogs[locale][versionCode] = path
 }
 
 var imageSuffixes = map[string]bool{
@@ -20,6 +58,10 @@ func hasImageSuffix(path string) bool {
 	return imageSuffixes[strings.TrimPrefix(filepath.Ext(path), ".")]
 }
 
+func isScreenshot(path string) bool {
+	return strings.Contains(strings.ToLower(path), "screenshot") && hasImageSuffix(path)
+}
+
 func FindMetadata(clonedRepoPath string) (r RepoMetadata, err error) {
 	abs, err := filepath.Abs(clonedRepoPath)
 	if err != nil {
@@ -31,15 +73,75 @@ func FindMetadata(clonedRepoPath string) (r RepoMetadata, err error) {
 			return err
 		}
 
-		lp := strings.ToLower(path)
-
-		if strings.Contains(lp, "screenshot") && hasImageSuffix(path) {
+		if isScreenshot(path) {
 			r.Screenshots = append(r.Screenshots, path)
 			return nil
 		}
 
+		if locale, versionCode, ok := fastlaneChangelog(strings.TrimPrefix(path, abs)); ok {
+			r.addChangelog(locale, versionCode, path)
+		}
+
 		return nil
 	})
 
 	return
 }
+
+// FetchMetadata finds the same files as FindMetadata, but lists and downloads only those files
+// from the forge API instead of requiring a clone. The files are written to a new temporary
+// directory that the caller must remove
+func FetchMetadata(ctx context.Context, f forge.Forge, repo Repo, ref string) (dirPath string, r RepoMetadata, err error) {
+	files, err := f.ListFiles(ctx, repo.Author, repo.Name, ref)
+	if err != nil {
+		return
+	}
+
+	dirPath, err = os.MkdirTemp("", "meta-*")
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		locale, versionCode, isChangelog := fastlaneChangelog(file.Path)
+		if !isScreenshot(file.Path) && !isChangelog {
+			continue
+		}
+
+		localPath := filepath.Join(dirPath, filepath.FromSlash(file.Path))
+
+		err = downloadRepoFile(ctx, f, repo, ref, file, localPath)
+		if err != nil {
+			_ = os.RemoveAll(dirPath)
+			return "", RepoMetadata{}, fmt.Errorf("downloading %q: %w", file.Path, err)
+		}
+
+		if isChangelog {
+			r.addChangelog(locale, versionCode, localPath)
+		} else {
+			r.Screenshots = append(r.Screenshots, localPath)
+		}
+	}
+
+	return
+}
+
+func downloadRepoFile(ctx context.Context, f forge.Forge, repo Repo, ref string, file forge.File, localPath string) (err error) {
+	err = os.MkdirAll(filepath.Dir(localPath), os.ModePerm)
+	if err != nil {
+		return
+	}
+
+	out, err := os.Create(localPath)
+	if err != nil {
+		return
+	}
+
+	err = f.DownloadFile(ctx, repo.Author, repo.Name, ref, file, out)
+	if err != nil {
+		_ = out.Close()
+		return
+	}
+
+	return out.Close()
+}
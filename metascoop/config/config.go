@@ -0,0 +1,522 @@
+// Package config reads the settings of metascoop from command line flags, environment variables and
+// the metascoop.yaml file. Flags take precedence over environment variables, which take precedence over
+// the file, which takes precedence over the defaults
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"metascoop/credentials"
+	"metascoop/download"
+	"metascoop/feed"
+	"metascoop/forge"
+	"metascoop/md"
+)
+
+// DefaultFile is the config file that is read if it exists and no other file is given
+const DefaultFile = "metascoop.yaml"
+
+// EnvPrefix is the prefix of all environment variables read by metascoop
+const EnvPrefix = "METASCOOP_"
+
+type Config struct {
+	// AppsFile is the path of the apps.yaml file
+	AppsFile string `yaml:"apps_file"`
+	// RewriteAppFile updates the git URLs of apps whose repositories were renamed or transferred in the app file
+	RewriteAppFile bool `yaml:"rewrite_app_file"`
+	// RepoDir is the fdroid "repo" directory
+	RepoDir string `yaml:"repo_dir"`
+	// ReadmePath is the README with the apps table. Defaults to README.md next to the fdroid directory
+	ReadmePath string `yaml:"readme_path"`
+	// ReadmeTemplate is a file with the template of the apps table in the README. The built-in table is used if it is empty
+	ReadmeTemplate string `yaml:"readme_template"`
+	// Outputs are more files, or regions of files, that are generated from templates
+	Outputs []md.Output `yaml:"outputs"`
+	// Site is the static website of the repo
+	Site Site `yaml:"site"`
+	// Feed lists new app versions in Atom and JSON feeds
+	Feed Feed `yaml:"feed"`
+	// Stats records the stars, downloads and health of the apps over time
+	Stats Stats `yaml:"stats"`
+	// Health checks whether the app repositories are still maintained
+	Health Health `yaml:"health"`
+
+	// Credentials authenticate requests to forges and git clones, keyed by host like "github.com"
+	Credentials credentials.Store `yaml:"credentials"`
+	// CredentialsFile is a file with more credentials, see credentials.ReadFile
+	CredentialsFile string `yaml:"credentials_file"`
+	// Forges tells which forge runs on self-hosted hosts like "gitlab.example.com"
+	Forges forge.Hosts `yaml:"forges"`
+
+	// Concurrency is how many APKs are downloaded at the same time
+	Concurrency int `yaml:"concurrency"`
+	// Retention is how many of the latest releases of each app are kept in the repo, 0 keeps all
+	Retention int `yaml:"retention"`
+	// MaxFailedApps stops the run without updating the repo if more apps fail, 0 means no limit
+	MaxFailedApps int `yaml:"max_failed_apps"`
+	// Report is a file the JSON report of the run is written to, none is written if empty
+	Report string `yaml:"report"`
+
+	Timeouts  Timeouts  `yaml:"timeouts"`
+	Downloads Downloads `yaml:"downloads"`
+	Fdroid    Fdroid    `yaml:"fdroid"`
+
+	// Debug skips building the index
+	Debug bool `yaml:"debug"`
+}
+
+type Site struct {
+	// Enabled generates the site
+	Enabled bool `yaml:"enabled"`
+	// Dir is where the site is written, defaults to the fdroid directory
+	Dir string `yaml:"dir"`
+	// QRCode is an image of the QR code for adding the repo, which is shown on the index page
+	QRCode string `yaml:"qr_code"`
+}
+
+type Feed struct {
+	// Enabled writes the feeds
+	Enabled bool `yaml:"enabled"`
+	// Dir is where the feeds are written, defaults to the fdroid directory
+	Dir string `yaml:"dir"`
+	// Size is how many of the newest versions the feeds list
+	Size int `yaml:"size"`
+}
+
+type Stats struct {
+	// Enabled records the stats
+	Enabled bool `yaml:"enabled"`
+	// Dir is where the history and summary are written, defaults to the "stats" directory in the fdroid directory
+	Dir string `yaml:"dir"`
+	// Readme writes the summary table into the README, between "<!-- begin stats -->" and "<!-- end stats -->"
+	Readme bool `yaml:"readme"`
+}
+
+type Health struct {
+	// InactiveAfter warns about repositories without a push for this long, 0 disables the check
+	InactiveAfter time.Duration `yaml:"inactive_after"`
+	// NoReleaseAfter warns about repositories without a release for this long, 0 disables the check
+	NoReleaseAfter time.Duration `yaml:"no_release_after"`
+	// Action is "warn", "mark" to set NoSourceSince of apps whose repository was deleted, or "disable" to also
+	// disable apps whose repository is abandoned
+	Action string `yaml:"action"`
+	// GracePeriod is how long the problems must last before the action is taken
+	GracePeriod time.Duration `yaml:"grace_period"`
+}
+
+type Timeouts struct {
+	// HTTP limits each request to a forge API, 0 means no limit
+	HTTP time.Duration `yaml:"http"`
+	// Download limits each attempt to download an APK
+	Download time.Duration `yaml:"download"`
+	// Fdroid stops "fdroid update" if it takes longer, 0 means no limit
+	Fdroid time.Duration `yaml:"fdroid"`
+}
+
+type Downloads struct {
+	// Retries is how often a failed download is retried, 0 disables retries
+	Retries int `yaml:"retries"`
+	// Backoff is the wait before the first retry, it is doubled for every further retry
+	Backoff time.Duration `yaml:"backoff"`
+}
+
+type Fdroid struct {
+	// Backend is "fdroid" to run fdroidserver or "native" to build the index without external tools
+	Backend string `yaml:"backend"`
+	// Binary is the fdroid executable
+	Binary string `yaml:"binary"`
+	// Args are passed to "fdroid update"
+	Args []string `yaml:"args"`
+}
+
+// Default returns the settings used if nothing else is configured
+func Default() Config {
+	return Config{
+		AppsFile:    "apps.yaml",
+		RepoDir:     "fdroid/repo",
+		Concurrency: 1,
+		Feed:        Feed{Size: feed.DefaultSize},
+		Health: Health{
+			InactiveAfter:  365 * 24 * time.Hour,
+			NoReleaseAfter: 365 * 24 * time.Hour,
+			Action:         "warn",
+			GracePeriod:    30 * 24 * time.Hour,
+		},
+		Timeouts: Timeouts{
+			HTTP:     time.Minute,
+			Download: download.DefaultAttemptTimeout,
+			Fdroid:   30 * time.Minute,
+		},
+		Downloads: Downloads{
+			Retries: download.DefaultRetries,
+			Backoff: download.DefaultBackoff,
+		},
+		Fdroid: Fdroid{
+			Backend: "fdroid",
+			Binary:  "fdroid",
+		},
+	}
+}
+
+// Load reads the config from the file given with -config or $METASCOOP_CONFIG, or from DefaultFile if
+// it exists, then the credentials file, then the environment variables in environ ("key=value" like
+// os.Environ returns them) and then the flags in args
+func Load(name string, args []string, environ []string) (cfg Config, err error) {
+	var env = make(map[string]string)
+	for _, kv := range environ {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	// The first pass only finds the config and credentials files, the flags are parsed again to override the files
+	var path string
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	first := Default()
+	first.register(fs, &path)
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	credentialsPath := first.CredentialsFile
+
+	// Only a config file that was asked for must exist, an empty variable is the same as none
+	if path == "" {
+		path = env[EnvPrefix+"CONFIG"]
+	}
+	required := path != ""
+	if path == "" {
+		path = DefaultFile
+	}
+
+	cfg = Default()
+
+	err = cfg.readFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		err = nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("reading config file: %w", err)
+	}
+
+	if credentialsPath == "" {
+		credentialsPath = env[EnvPrefix+"CREDENTIALS_FILE"]
+	}
+	if credentialsPath == "" {
+		credentialsPath = cfg.CredentialsFile
+	}
+	if credentialsPath != "" {
+		store, err := credentials.ReadFile(credentialsPath)
+		if err != nil {
+			return cfg, fmt.Errorf("reading credentials file: %w", err)
+		}
+		cfg.credentials().Merge(store)
+	}
+
+	err = cfg.readEnv(env)
+	if err != nil {
+		return
+	}
+
+	fs = flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg.register(fs, &path)
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+
+	return cfg, cfg.validate()
+}
+
+// register defines the command line flags, which write to c
+func (c *Config) register(fs *flag.FlagSet, configPath *string) {
+	fs.StringVar(configPath, "config", "", "Path to the config file, defaults to "+DefaultFile+" if it exists")
+
+	fs.StringVar(&c.AppsFile, "ap", c.AppsFile, "Path to apps.yaml file")
+	fs.BoolVar(&c.RewriteAppFile, "rewrite-app-file", c.RewriteAppFile, "Update the git URLs of renamed or transferred repositories in the apps.yaml file, instead of only suggesting a patch")
+	fs.StringVar(&c.RepoDir, "rd", c.RepoDir, "Path to fdroid \"repo\" directory")
+	fs.StringVar(&c.ReadmePath, "readme", c.ReadmePath, "Path to the README with the apps table, defaults to README.md next to the fdroid directory")
+	fs.StringVar(&c.ReadmeTemplate, "readme-template", c.ReadmeTemplate, "Path to a template file for the apps table in the README")
+	fs.BoolVar(&c.Site.Enabled, "site", c.Site.Enabled, "Generate a static website for the repo")
+	fs.StringVar(&c.Site.QRCode, "site-qr-code", c.Site.QRCode, "Path to an image of the QR code for adding the repo, shown on the website")
+	fs.BoolVar(&c.Feed.Enabled, "feed", c.Feed.Enabled, "Write Atom and JSON feeds of new app versions")
+	fs.IntVar(&c.Feed.Size, "feed-size", c.Feed.Size, "How many of the newest versions the feeds list")
+	fs.BoolVar(&c.Stats.Enabled, "stats", c.Stats.Enabled, "Record the stars, downloads and health of the apps")
+	fs.BoolVar(&c.Stats.Readme, "stats-readme", c.Stats.Readme, "Write the stats summary into the README")
+	fs.DurationVar(&c.Health.InactiveAfter, "health-inactive-after", c.Health.InactiveAfter, "Warn about app repositories without a push for this long, 0 disables the check")
+	fs.DurationVar(&c.Health.NoReleaseAfter, "health-no-release-after", c.Health.NoReleaseAfter, "Warn about app repositories without a release for this long, 0 disables the check")
+	fs.StringVar(&c.Health.Action, "health-action", c.Health.Action, "What happens to apps with abandoned repositories: \"warn\", \"mark\" sets NoSourceSince if the repository was deleted, \"disable\" also removes them from the index")
+	fs.DurationVar(&c.Health.GracePeriod, "health-grace-period", c.Health.GracePeriod, "How long repository problems must last before the health action is taken")
+	fs.StringVar(&c.CredentialsFile, "credentials", c.CredentialsFile, "Path to a file with the credentials of forges by host")
+	fs.Func("pat", "GitHub personal access token. Prefer setting "+EnvPrefix+"TOKEN_GITHUB_COM, flags show up in process listings", func(s string) error {
+		c.credentials().Merge(credentials.Store{"github.com": {Token: s}})
+		return nil
+	})
+	fs.Func("github-app-id", "ID of the GitHub App to authenticate as instead of using a personal access token", func(s string) error {
+		return setApp(c.credentials(), "github.com", s, func(a *credentials.GitHubApp, id int64) { a.AppID = id })
+	})
+	fs.Func("github-app-installation-id", "ID of the installation of the GitHub App", func(s string) error {
+		return setApp(c.credentials(), "github.com", s, func(a *credentials.GitHubApp, id int64) { a.InstallationID = id })
+	})
+	fs.Func("github-app-key", "Path to the private key of the GitHub App", func(s string) error {
+		c.credentials().Merge(credentials.Store{"github.com": {App: &credentials.GitHubApp{PrivateKeyFile: s}}})
+		return nil
+	})
+
+	fs.IntVar(&c.Concurrency, "concurrency", c.Concurrency, "How many APKs are downloaded at the same time")
+	fs.IntVar(&c.Retention, "retention", c.Retention, "How many of the latest releases of each app are kept, 0 keeps all")
+	fs.IntVar(&c.MaxFailedApps, "max-failed-apps", c.MaxFailedApps, "Stop without updating the repo if more apps fail, 0 means no limit")
+	fs.StringVar(&c.Report, "report", c.Report, "Write a JSON report of the run to this file")
+
+	fs.DurationVar(&c.Timeouts.HTTP, "http-timeout", c.Timeouts.HTTP, "Timeout of forge API requests, 0 disables the timeout")
+	fs.DurationVar(&c.Timeouts.Download, "download-timeout", c.Timeouts.Download, "Timeout of each attempt to download an APK")
+	fs.IntVar(&c.Downloads.Retries, "download-retries", c.Downloads.Retries, "How often a failed APK download is retried")
+	fs.DurationVar(&c.Downloads.Backoff, "download-backoff", c.Downloads.Backoff, "Wait before retrying a failed download, doubled for every further retry")
+
+	fs.StringVar(&c.Fdroid.Backend, "backend", c.Fdroid.Backend, "How the index is built: \"fdroid\" runs fdroidserver, \"native\" builds and signs it without external tools")
+	fs.StringVar(&c.Fdroid.Binary, "fdroid-bin", c.Fdroid.Binary, "Path to the fdroid executable")
+	fs.Func("fdroid-args", "Additional space-separated arguments for \"fdroid update\"", func(s string) error {
+		c.Fdroid.Args = strings.Fields(s)
+		return nil
+	})
+	fs.DurationVar(&c.Timeouts.Fdroid, "fdroid-timeout", c.Timeouts.Fdroid, "Stop \"fdroid update\" if it takes longer than this, 0 disables the timeout")
+
+	fs.BoolVar(&c.Debug, "debug", c.Debug, "Debug mode won't run the fdroid command")
+}
+
+func (c *Config) readFile(path string) (err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+
+	err = dec.Decode(c)
+	if errors.Is(err, io.EOF) {
+		// The file is empty
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("parsing %q: %w", path, err)
+	}
+
+	return
+}
+
+// readEnv reads METASCOOP_* variables. Credentials are read from METASCOOP_TOKEN_<HOST>, METASCOOP_USERNAME_<HOST>,
+// METASCOOP_PASSWORD_<HOST> and METASCOOP_APP_*_<HOST>, where the dots and dashes of the host are replaced with
+// underscores, e.g. METASCOOP_TOKEN_GITHUB_COM
+func (c *Config) readEnv(env map[string]string) (err error) {
+	var vars = []struct {
+		name string
+		set  func(string) error
+	}{
+		{"APPS_FILE", stringVar(&c.AppsFile)},
+		{"REWRITE_APP_FILE", boolVar(&c.RewriteAppFile)},
+		{"REPO_DIR", stringVar(&c.RepoDir)},
+		{"README_PATH", stringVar(&c.ReadmePath)},
+		{"README_TEMPLATE", stringVar(&c.ReadmeTemplate)},
+		{"SITE", boolVar(&c.Site.Enabled)},
+		{"SITE_DIR", stringVar(&c.Site.Dir)},
+		{"SITE_QR_CODE", stringVar(&c.Site.QRCode)},
+		{"FEED", boolVar(&c.Feed.Enabled)},
+		{"FEED_DIR", stringVar(&c.Feed.Dir)},
+		{"FEED_SIZE", intVar(&c.Feed.Size)},
+		{"STATS", boolVar(&c.Stats.Enabled)},
+		{"STATS_DIR", stringVar(&c.Stats.Dir)},
+		{"STATS_README", boolVar(&c.Stats.Readme)},
+		{"HEALTH_INACTIVE_AFTER", durationVar(&c.Health.InactiveAfter)},
+		{"HEALTH_NO_RELEASE_AFTER", durationVar(&c.Health.NoReleaseAfter)},
+		{"HEALTH_ACTION", stringVar(&c.Health.Action)},
+		{"HEALTH_GRACE_PERIOD", durationVar(&c.Health.GracePeriod)},
+		{"CREDENTIALS_FILE", stringVar(&c.CredentialsFile)},
+		{"CONCURRENCY", intVar(&c.Concurrency)},
+		{"RETENTION", intVar(&c.Retention)},
+		{"MAX_FAILED_APPS", intVar(&c.MaxFailedApps)},
+		{"REPORT", stringVar(&c.Report)},
+		{"HTTP_TIMEOUT", durationVar(&c.Timeouts.HTTP)},
+		{"DOWNLOAD_TIMEOUT", durationVar(&c.Timeouts.Download)},
+		{"DOWNLOAD_RETRIES", intVar(&c.Downloads.Retries)},
+		{"DOWNLOAD_BACKOFF", durationVar(&c.Downloads.Backoff)},
+		{"FDROID_BACKEND", stringVar(&c.Fdroid.Backend)},
+		{"FDROID_BINARY", stringVar(&c.Fdroid.Binary)},
+		{"FDROID_ARGS", func(s string) error {
+			c.Fdroid.Args = strings.Fields(s)
+			return nil
+		}},
+		{"FDROID_TIMEOUT", durationVar(&c.Timeouts.Fdroid)},
+		{"DEBUG", boolVar(&c.Debug)},
+	}
+
+	for _, v := range vars {
+		value, ok := env[EnvPrefix+v.name]
+		if !ok {
+			continue
+		}
+
+		err = v.set(value)
+		if err != nil {
+			return fmt.Errorf("invalid value of %s%s: %w", EnvPrefix, v.name, err)
+		}
+	}
+
+	var store = make(credentials.Store)
+	for name, value := range env {
+		switch {
+		case strings.HasPrefix(name, EnvPrefix+"APP_ID_"):
+			host := hostFromEnv(strings.TrimPrefix(name, EnvPrefix+"APP_ID_"))
+			err = setApp(store, host, value, func(a *credentials.GitHubApp, id int64) { a.AppID = id })
+		case strings.HasPrefix(name, EnvPrefix+"APP_INSTALLATION_ID_"):
+			host := hostFromEnv(strings.TrimPrefix(name, EnvPrefix+"APP_INSTALLATION_ID_"))
+			err = setApp(store, host, value, func(a *credentials.GitHubApp, id int64) { a.InstallationID = id })
+		// The file variable must be checked first, as its prefix starts with the other one
+		case strings.HasPrefix(name, EnvPrefix+"APP_PRIVATE_KEY_FILE_"):
+			host := hostFromEnv(strings.TrimPrefix(name, EnvPrefix+"APP_PRIVATE_KEY_FILE_"))
+			store.Merge(credentials.Store{host: {App: &credentials.GitHubApp{PrivateKeyFile: value}}})
+		case strings.HasPrefix(name, EnvPrefix+"APP_PRIVATE_KEY_"):
+			host := hostFromEnv(strings.TrimPrefix(name, EnvPrefix+"APP_PRIVATE_KEY_"))
+			store.Merge(credentials.Store{host: {App: &credentials.GitHubApp{PrivateKey: value}}})
+		case strings.HasPrefix(name, EnvPrefix+"TOKEN_"):
+			host := hostFromEnv(strings.TrimPrefix(name, EnvPrefix+"TOKEN_"))
+			store.Merge(credentials.Store{host: {Token: value}})
+		case strings.HasPrefix(name, EnvPrefix+"USERNAME_"):
+			host := hostFromEnv(strings.TrimPrefix(name, EnvPrefix+"USERNAME_"))
+			store.Merge(credentials.Store{host: {Username: value}})
+		case strings.HasPrefix(name, EnvPrefix+"PASSWORD_"):
+			host := hostFromEnv(strings.TrimPrefix(name, EnvPrefix+"PASSWORD_"))
+			store.Merge(credentials.Store{host: {Password: value}})
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+	}
+	c.credentials().Merge(store)
+
+	return
+}
+
+// setApp parses the GitHub App or installation id s and sets it on the app credential of host in store
+func setApp(store credentials.Store, host, s string, set func(a *credentials.GitHubApp, id int64)) error {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	var app credentials.GitHubApp
+	set(&app, id)
+	store.Merge(credentials.Store{host: {App: &app}})
+
+	return nil
+}
+
+// credentials returns c.Credentials, which is created if it is nil
+func (c *Config) credentials() credentials.Store {
+	if c.Credentials == nil {
+		c.Credentials = make(credentials.Store)
+	}
+	return c.Credentials
+}
+
+func (c *Config) validate() error {
+	switch c.Fdroid.Backend {
+	case "fdroid", "native":
+	default:
+		return fmt.Errorf("unknown backend %q, must be \"fdroid\" or \"native\"", c.Fdroid.Backend)
+	}
+
+	if c.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", c.Concurrency)
+	}
+	if c.Retention < 0 {
+		return fmt.Errorf("retention must not be negative, got %d", c.Retention)
+	}
+	if c.MaxFailedApps < 0 {
+		return fmt.Errorf("max failed apps must not be negative, got %d", c.MaxFailedApps)
+	}
+	switch c.Health.Action {
+	case "warn", "mark", "disable":
+	default:
+		return fmt.Errorf("unknown health action %q, must be \"warn\", \"mark\" or \"disable\"", c.Health.Action)
+	}
+	if c.Health.InactiveAfter < 0 || c.Health.NoReleaseAfter < 0 || c.Health.GracePeriod < 0 {
+		return errors.New("health durations must not be negative")
+	}
+
+	if c.Feed.Size < 1 {
+		return fmt.Errorf("feed size must be at least 1, got %d", c.Feed.Size)
+	}
+
+	for _, out := range c.Outputs {
+		if out.Path == "" {
+			return errors.New("output without path")
+		}
+		if out.Template == "" && len(out.Regions) == 0 {
+			return fmt.Errorf("output %q has neither a template nor regions", out.Path)
+		}
+		for _, region := range out.Regions {
+			if region.Name == "" || region.Template == "" {
+				return fmt.Errorf("region of output %q needs a name and a template", out.Path)
+			}
+		}
+	}
+
+	err := c.Credentials.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid credentials: %w", err)
+	}
+
+	err = c.Forges.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid forges: %w", err)
+	}
+
+	return nil
+}
+
+// hostFromEnv converts the host part of a credential variable name back to a host, e.g. GITHUB_COM to github.com.
+// Underscores can be dots or dashes, so two underscores stand for a dash: MY__GITEA_COM is my-gitea.com
+func hostFromEnv(s string) string {
+	s = strings.ToLower(s)
+	s = strings.ReplaceAll(s, "__", "-")
+	return strings.ReplaceAll(s, "_", ".")
+}
+
+func stringVar(p *string) func(string) error {
+	return func(s string) error {
+		*p = s
+		return nil
+	}
+}
+
+func intVar(p *int) func(string) error {
+	return func(s string) (err error) {
+		*p, err = strconv.Atoi(s)
+		return
+	}
+}
+
+func boolVar(p *bool) func(string) error {
+	return func(s string) (err error) {
+		*p, err = strconv.ParseBool(s)
+		return
+	}
+}
+
+func durationVar(p *time.Duration) func(string) error {
+	return func(s string) (err error) {
+		*p, err = time.ParseDuration(s)
+		return
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metascoop.yaml")
+	err := os.WriteFile(path, []byte(`apps_file: file.yaml
+repo_dir: file/repo
+concurrency: 2
+retention: 5
+credentials:
+  github.com:
+    token: file-token
+timeouts:
+  http: 10s
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := []string{
+		"METASCOOP_CONFIG=" + path,
+		"METASCOOP_REPO_DIR=env/repo",
+		"METASCOOP_CONCURRENCY=3",
+		"METASCOOP_TOKEN_GITHUB_COM=env-token",
+		"METASCOOP_TOKEN_MY__GITEA_EXAMPLE_ORG=gitea-token",
+		"OTHER=ignored",
+	}
+	args := []string{"-concurrency", "4"}
+
+	cfg, err := Load("metascoop", args, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.AppsFile != "file.yaml" || cfg.RepoDir != "env/repo" || cfg.Concurrency != 4 || cfg.Retention != 5 {
+		t.Errorf("got apps file %q, repo dir %q, concurrency %d, retention %d, want file.yaml, env/repo, 4, 5",
+			cfg.AppsFile, cfg.RepoDir, cfg.Concurrency, cfg.Retention)
+	}
+	if cfg.Timeouts.HTTP != 10*time.Second || cfg.Timeouts.Fdroid != 30*time.Minute {
+		t.Errorf("got timeouts %+v, want HTTP from the file and fdroid default", cfg.Timeouts)
+	}
+	if cfg.Credentials["github.com"].Token != "env-token" || cfg.Credentials["my-gitea.example.org"].Token != "gitea-token" {
+		t.Errorf("got credentials %v, want tokens of github.com and my-gitea.example.org from the environment", cfg.Credentials)
+	}
+
+	cfg, err = Load("metascoop", []string{"-pat", "flag-token"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Credentials["github.com"].Token != "flag-token" {
+		t.Errorf("-pat didn't override the token from the environment")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Load("metascoop", []string{"-config", filepath.Join(dir, "missing.yaml")}, nil)
+	if err == nil {
+		t.Errorf("missing config file given with -config didn't return an error")
+	}
+
+	path := filepath.Join(dir, "metascoop.yaml")
+	err = os.WriteFile(path, []byte("concurency: 2\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load("metascoop", []string{"-config", path}, nil)
+	if err == nil {
+		t.Errorf("misspelled key in config file didn't return an error")
+	}
+
+	_, err = Load("metascoop", nil, []string{"METASCOOP_CONCURRENCY=0"})
+	if err == nil {
+		t.Errorf("concurrency of 0 didn't return an error")
+	}
+
+	// The default file is optional, also if the variable naming the file is empty
+	_, err = Load("metascoop", nil, []string{"METASCOOP_CONFIG="})
+	if err != nil {
+		t.Errorf("empty METASCOOP_CONFIG without %s returned %v, want no error", DefaultFile, err)
+	}
+}
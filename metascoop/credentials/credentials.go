@@ -0,0 +1,247 @@
+// Package credentials holds the credentials of forges by host and applies them to HTTP requests and
+// git commands. Credentials are never printed: String and GoString only tell which kind of credential
+// is set
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultGitUsername is used as git username with a token if no username is set. GitHub requires it
+// for GitHub App installation tokens, other forges accept any username with a token
+const DefaultGitUsername = "x-access-token"
+
+// Credential authenticates requests to one host
+type Credential struct {
+	// Token is an access token, e.g. a personal access token or a GitHub App installation token. It is
+	// sent as bearer token
+	Token string `yaml:"token"`
+	// Username and Password are sent with basic auth if there is no token. With a token, Username is
+	// only used for git
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// App authenticates as a GitHub App installation. Its installation tokens are used instead of the other fields
+	App *GitHubApp `yaml:"app"`
+}
+
+// IsZero returns whether no credential is set
+func (c Credential) IsZero() bool {
+	return c.Token == "" && c.Username == "" && c.Password == "" && c.App == nil
+}
+
+// String describes the credential without revealing it
+func (c Credential) String() string {
+	switch {
+	case c.App != nil:
+		return fmt.Sprintf("GitHub App %d installation %d", c.App.AppID, c.App.InstallationID)
+	case c.Token != "":
+		return "token"
+	case c.Username != "" || c.Password != "":
+		return fmt.Sprintf("basic auth of %q", c.Username)
+	default:
+		return "none"
+	}
+}
+
+// GoString is used by %#v, which would otherwise print the fields
+func (c Credential) GoString() string {
+	return "credentials.Credential(" + c.String() + ")"
+}
+
+// Authorization returns the value of the Authorization header, or "" if no credential is set. GitHub App
+// credentials must be exchanged for a token first, see Transport.Credential
+func (c Credential) Authorization() string {
+	switch {
+	case c.Token != "":
+		return "Bearer " + c.Token
+	case c.Username != "" || c.Password != "":
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password))
+	default:
+		return ""
+	}
+}
+
+// Git returns the username and password for git over HTTPS
+func (c Credential) Git() (username, password string) {
+	if c.Token == "" {
+		return c.Username, c.Password
+	}
+
+	username = c.Username
+	if username == "" {
+		username = DefaultGitUsername
+	}
+
+	return username, c.Token
+}
+
+// Store maps hosts like "github.com" to their credentials
+type Store map[string]Credential
+
+// Lookup returns the credential of host. The credential of a host is also used for its API subdomain,
+// e.g. the one of github.com for api.github.com
+func (s Store) Lookup(host string) (c Credential, ok bool) {
+	_, c, ok = s.lookup(host)
+	return
+}
+
+// lookup also returns the host the credential is stored for
+func (s Store) lookup(host string) (key string, c Credential, ok bool) {
+	key = strings.ToLower(host)
+
+	c, ok = s[key]
+	if !ok && strings.HasPrefix(key, "api.") {
+		key = strings.TrimPrefix(key, "api.")
+		c, ok = s[key]
+	}
+
+	return key, c, ok && !c.IsZero()
+}
+
+// Validate checks that the GitHub App credentials are complete
+func (s Store) Validate() error {
+	for host, c := range s {
+		if c.App == nil {
+			continue
+		}
+
+		err := c.App.validate()
+		if err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+	}
+	return nil
+}
+
+// Merge sets the fields of the credentials in other that are not empty
+func (s Store) Merge(other Store) {
+	for host, o := range other {
+		host = strings.ToLower(host)
+
+		c := s[host]
+		if o.Token != "" {
+			c.Token = o.Token
+		}
+		if o.Username != "" {
+			c.Username = o.Username
+		}
+		if o.Password != "" {
+			c.Password = o.Password
+		}
+		if o.App != nil {
+			c.App = o.App.merged(c.App)
+		}
+		s[host] = c
+	}
+}
+
+// ReadFile reads a credentials file, which maps hosts to credentials:
+//
+//	codeberg.org:
+//	  token: ...
+//	git.example.org:
+//	  username: ...
+//	  password: ...
+func ReadFile(path string) (s Store, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+
+	s = make(Store)
+
+	err = dec.Decode(&s)
+	if errors.Is(err, io.EOF) {
+		return s, nil
+	}
+	if err != nil {
+		// Type errors quote the values, which are secrets
+		var terr *yaml.TypeError
+		if errors.As(err, &terr) {
+			return nil, fmt.Errorf("parsing credentials file %q: %d values have the wrong type or are unknown fields", path, len(terr.Errors))
+		}
+		return nil, fmt.Errorf("parsing credentials file %q: %w", path, err)
+	}
+
+	return
+}
+
+// Transport authenticates requests to hosts that have credentials. Requests to other hosts, e.g. after a
+// redirect to a CDN, and requests that already have an Authorization header are sent unchanged
+type Transport struct {
+	Store Store
+	// Base sends the requests, http.DefaultTransport is used if it is nil
+	Base http.RoundTripper
+
+	mu sync.Mutex
+	// appTokens are the token sources of the GitHub App credentials by host
+	appTokens map[string]*appTokenSource
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.base().RoundTrip(req)
+	}
+
+	c, ok, err := t.Credential(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return t.base().RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", c.Authorization())
+
+	return t.base().RoundTrip(req)
+}
+
+// Credential returns the credential of host. GitHub App credentials are exchanged for an installation token,
+// which is reused until shortly before it expires. A new token is requested with ctx
+func (t *Transport) Credential(ctx context.Context, host string) (c Credential, ok bool, err error) {
+	key, c, ok := t.Store.lookup(host)
+	if !ok || c.App == nil {
+		return
+	}
+
+	t.mu.Lock()
+	src, exists := t.appTokens[key]
+	if !exists {
+		if t.appTokens == nil {
+			t.appTokens = make(map[string]*appTokenSource)
+		}
+		src = newAppTokenSource(c.App, key, &http.Client{Transport: t.base()})
+		t.appTokens[key] = src
+	}
+	t.mu.Unlock()
+
+	token, err := src.Token(ctx)
+	if err != nil {
+		return c, false, err
+	}
+
+	return Credential{Token: token.AccessToken}, true, nil
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
@@ -0,0 +1,99 @@
+package credentials
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type recordingTransport struct {
+	authorization map[string]string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.authorization[req.URL.Host] = req.Header.Get("Authorization")
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestTransport(t *testing.T) {
+	base := &recordingTransport{authorization: make(map[string]string)}
+	client := &http.Client{Transport: &Transport{
+		Store: Store{
+			"github.com":      {Token: "gh-token"},
+			"git.example.org": {Username: "user", Password: "secret"},
+		},
+		Base: base,
+	}}
+
+	for _, u := range []string{
+		"https://api.github.com/repos/example/notes",
+		"https://git.example.org/api/v1/repos/example/timer",
+		"https://objects.githubusercontent.com/asset",
+	} {
+		resp, err := client.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	var want = map[string]string{
+		"api.github.com":                "Bearer gh-token",
+		"git.example.org":               "Basic dXNlcjpzZWNyZXQ=",
+		"objects.githubusercontent.com": "",
+	}
+	for host, auth := range want {
+		if got := base.authorization[host]; got != auth {
+			t.Errorf("request to %s had Authorization %q, want %q", host, got, auth)
+		}
+	}
+}
+
+func TestCredentialsAreNotPrinted(t *testing.T) {
+	store := Store{
+		"github.com":      {Token: "gh-token"},
+		"git.example.org": {Username: "user", Password: "secret"},
+	}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		s := fmt.Sprintf(format, store)
+		if strings.Contains(s, "gh-token") || strings.Contains(s, "secret") {
+			t.Errorf("%s printed credentials: %s", format, s)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.yaml")
+	err := os.WriteFile(path, []byte("codeberg.org:\n  token: cb-token\ngit.example.org:\n  username: user\n  pasword: secret\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ReadFile(path)
+	if err == nil {
+		t.Fatalf("unknown field didn't return an error")
+	}
+	if strings.Contains(err.Error(), "secret") || strings.Contains(err.Error(), "cb-token") {
+		t.Errorf("error contains credentials: %s", err.Error())
+	}
+
+	err = os.WriteFile(path, []byte("codeberg.org:\n  token: cb-token\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := store.Lookup("codeberg.org"); !ok || c.Token != "cb-token" {
+		t.Errorf("got credential %v, want token of codeberg.org", c)
+	}
+	if user, password := store["codeberg.org"].Git(); user != DefaultGitUsername || password != "cb-token" {
+		t.Errorf("git credentials of token are %q and %q, want %q and the token", user, password, DefaultGitUsername)
+	}
+}
@@ -0,0 +1,227 @@
+package credentials
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// jwtLifetime is how long the JWT that authenticates as the app is valid. GitHub allows at most 10 minutes
+	jwtLifetime = 9 * time.Minute
+	// tokenRefreshMargin is how long before its expiry an installation token is replaced, so that it doesn't
+	// expire during a request or clone
+	tokenRefreshMargin = 5 * time.Minute
+	// tokenRequestTimeout limits the request for an installation token
+	tokenRequestTimeout = time.Minute
+)
+
+// GitHubApp authenticates as an installation of a GitHub App
+type GitHubApp struct {
+	AppID          int64 `yaml:"app_id"`
+	InstallationID int64 `yaml:"installation_id"`
+	// PrivateKey is the private key of the app in PEM format
+	PrivateKey string `yaml:"private_key"`
+	// PrivateKeyFile is read if PrivateKey is empty
+	PrivateKeyFile string `yaml:"private_key_file"`
+}
+
+// merged returns a copy of a with the empty fields taken from other
+func (a *GitHubApp) merged(other *GitHubApp) *GitHubApp {
+	m := *a
+	if other == nil {
+		return &m
+	}
+
+	if m.AppID == 0 {
+		m.AppID = other.AppID
+	}
+	if m.InstallationID == 0 {
+		m.InstallationID = other.InstallationID
+	}
+	if m.PrivateKey == "" && m.PrivateKeyFile == "" {
+		m.PrivateKey, m.PrivateKeyFile = other.PrivateKey, other.PrivateKeyFile
+	}
+	return &m
+}
+
+func (a *GitHubApp) validate() error {
+	switch {
+	case a.AppID == 0:
+		return errors.New("GitHub App credential has no app id")
+	case a.InstallationID == 0:
+		return errors.New("GitHub App credential has no installation id")
+	case a.PrivateKey == "" && a.PrivateKeyFile == "":
+		return errors.New("GitHub App credential has no private key")
+	}
+	return nil
+}
+
+func (a *GitHubApp) key() (key *rsa.PrivateKey, err error) {
+	data := []byte(a.PrivateKey)
+	if a.PrivateKey == "" {
+		data, err = os.ReadFile(a.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading private key of GitHub App: %w", err)
+		}
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key of GitHub App is not in PEM format")
+	}
+
+	// GitHub hands out PKCS #1 keys, but converted keys are often PKCS #8
+	key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err == nil {
+		return
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("parsing private key of GitHub App failed")
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key of GitHub App is not an RSA key")
+	}
+
+	return
+}
+
+// jwt returns a JSON Web Token that authenticates as the app
+func (a *GitHubApp) jwt(now time.Time) (token string, err error) {
+	key, err := a.key()
+	if err != nil {
+		return
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		// The clocks of GitHub and the runner can differ a bit
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": strconv.FormatInt(a.AppID, 10),
+	})
+	if err != nil {
+		return
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// appTokenSource exchanges the JWT of an app for installation tokens, and reuses a token until shortly
+// before it expires
+type appTokenSource struct {
+	app *GitHubApp
+	// apiURL is the GitHub API, with trailing slash
+	apiURL string
+	client *http.Client
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// newAppTokenSource returns a token source for the GitHub App on host
+func newAppTokenSource(app *GitHubApp, host string, client *http.Client) *appTokenSource {
+	apiURL := "https://api.github.com/"
+	if host != "github.com" {
+		// GitHub Enterprise Server
+		apiURL = "https://" + host + "/api/v3/"
+	}
+
+	return &appTokenSource{app: app, apiURL: apiURL, client: client}
+}
+
+// Token returns the current installation token, or requests a new one with ctx, so that the request is
+// canceled with the request or clone that needs the token
+func (s *appTokenSource) Token(ctx context.Context) (token *oauth2.Token, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.Valid() {
+		return s.token, nil
+	}
+
+	token, err = s.requestToken(ctx)
+	if err != nil {
+		return
+	}
+	s.token = token
+
+	return
+}
+
+func (s *appTokenSource) requestToken(ctx context.Context) (token *oauth2.Token, err error) {
+	jwt, err := s.app.jwt(time.Now())
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tokenRequestTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("%sapp/installations/%d/access_tokens", s.apiURL, s.app.InstallationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting installation token of GitHub App %d: %w", s.app.AppID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("requesting installation token of GitHub App %d: unexpected status code %d", s.app.AppID, resp.StatusCode)
+	}
+
+	var result struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("decoding installation token of GitHub App %d: %w", s.app.AppID, err)
+	}
+	if strings.TrimSpace(result.Token) == "" {
+		return nil, fmt.Errorf("GitHub App %d got an empty installation token", s.app.AppID)
+	}
+
+	return &oauth2.Token{
+		AccessToken: result.Token,
+		TokenType:   "Bearer",
+		Expiry:      result.ExpiresAt.Add(-tokenRefreshMargin),
+	}, nil
+}
@@ -0,0 +1,158 @@
+package credentials
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGitHubApps hands out installation tokens for requests with a valid JWT
+type fakeGitHubApps struct {
+	key       *rsa.PublicKey
+	expiresIn time.Duration
+
+	mu     sync.Mutex
+	issued int
+}
+
+func (f *fakeGitHubApps) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/app/installations/42/access_tokens" {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+	if len(parts) != 3 {
+		http.Error(w, "no JWT", http.StatusUnauthorized)
+		return
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(f.key, crypto.SHA256, hash[:], sig) != nil {
+		http.Error(w, "wrong signature", http.StatusUnauthorized)
+		return
+	}
+
+	var claims struct {
+		Issuer    string `json:"iss"`
+		ExpiresAt int64  `json:"exp"`
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if json.Unmarshal(payload, &claims) != nil || claims.Issuer != "7" || claims.ExpiresAt < time.Now().Unix() {
+		http.Error(w, "bad claims", http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	f.issued++
+	token := fmt.Sprintf("installation-token-%d", f.issued)
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      token,
+		"expires_at": time.Now().Add(f.expiresIn).UTC().Format(time.RFC3339),
+	})
+}
+
+func newTestApp(t *testing.T, expiresIn time.Duration) (app *GitHubApp, apps *fakeGitHubApps, apiURL string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apps = &fakeGitHubApps{key: &key.PublicKey, expiresIn: expiresIn}
+	srv := httptest.NewServer(apps)
+	t.Cleanup(srv.Close)
+
+	app = &GitHubApp{
+		AppID:          7,
+		InstallationID: 42,
+		PrivateKey:     string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+	}
+
+	return app, apps, srv.URL + "/"
+}
+
+func TestGitHubAppTokens(t *testing.T) {
+	app, apps, apiURL := newTestApp(t, time.Hour)
+
+	base := &recordingTransport{authorization: make(map[string]string)}
+	transport := &Transport{
+		Store: Store{"github.com": {App: app}},
+		Base:  base,
+		appTokens: map[string]*appTokenSource{
+			"github.com": {app: app, apiURL: apiURL, client: http.DefaultClient},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos/example/private", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if got := base.authorization["api.github.com"]; got != "Bearer installation-token-1" {
+		t.Errorf("request had Authorization %q, want the installation token", got)
+	}
+	if apps.issued != 1 {
+		t.Errorf("%d installation tokens were requested, want 1 that is reused", apps.issued)
+	}
+
+	c, ok, err := transport.Credential(context.Background(), "github.com")
+	if err != nil || !ok {
+		t.Fatalf("no credential for git: %v", err)
+	}
+	if user, password := c.Git(); user != DefaultGitUsername || password != "installation-token-1" {
+		t.Errorf("git credentials are %q and %q, want %q and the installation token", user, password, DefaultGitUsername)
+	}
+}
+
+func TestGitHubAppTokenRefresh(t *testing.T) {
+	// Tokens that expire within the refresh margin are replaced right away
+	app, _, apiURL := newTestApp(t, tokenRefreshMargin)
+
+	src := &appTokenSource{app: app, apiURL: apiURL, client: http.DefaultClient}
+	for i := 1; i <= 2; i++ {
+		token, err := src.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("installation-token-%d", i); token.AccessToken != want {
+			t.Errorf("got token %q, want %q", token.AccessToken, want)
+		}
+	}
+
+	// The token request is canceled with the request that needs the token
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := src.Token(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("token request with canceled context returned %v, want context.Canceled", err)
+	}
+
+	app.PrivateKey = "not a key"
+	if _, err := src.Token(context.Background()); err == nil || strings.Contains(err.Error(), "not a key") {
+		t.Errorf("invalid key returned %v, want error without the key", err)
+	}
+}
@@ -0,0 +1,266 @@
+// Package download downloads files over HTTP with retries, resuming partial downloads where the server
+// supports it. It can be used for release assets of any forge
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"metascoop/text"
+)
+
+// Default values for the fields of Client
+const (
+	DefaultRetries          = 3
+	DefaultBackoff          = 2 * time.Second
+	DefaultMaxBackoff       = time.Minute
+	DefaultProgressInterval = 10 * time.Second
+	DefaultAttemptTimeout   = 5 * time.Minute
+)
+
+// Client downloads files. The zero value uses http.DefaultClient and the default values
+type Client struct {
+	// HTTPClient sends the requests
+	HTTPClient *http.Client
+	// Retries is how often a failed download is retried, a negative value disables retries
+	Retries int
+	// Backoff is the wait before the first retry, it is doubled for every further retry
+	Backoff time.Duration
+	// MaxBackoff is the longest wait between retries
+	MaxBackoff time.Duration
+	// ProgressInterval is how often the progress of a download is logged
+	ProgressInterval time.Duration
+	// AttemptTimeout stops an attempt that takes longer, so that a stalled connection is retried
+	AttemptTimeout time.Duration
+}
+
+// permanentError is an error that doesn't go away by retrying
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// IsPermanent returns whether err is a download error that retrying won't fix, e.g. because the file doesn't exist
+func IsPermanent(err error) bool {
+	var perr *permanentError
+	return errors.As(err, &perr)
+}
+
+// File downloads url to path. The data is written to path + ".tmp" first, which is kept between retries
+// so that they can continue where the last attempt stopped. It is also kept if the download is canceled
+// or runs out of retries, so that a later call can resume it. If size is greater than 0, the downloaded
+// file must have exactly that size
+func (c *Client) File(ctx context.Context, url string, header http.Header, path string, size int64) (err error) {
+	var (
+		retries = c.Retries
+		backoff = c.Backoff
+		tmpPath = path + ".tmp"
+	)
+	if retries == 0 {
+		retries = DefaultRetries
+	}
+	if backoff == 0 {
+		backoff = DefaultBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = c.attempt(ctx, url, header, tmpPath, size)
+		if err == nil {
+			return os.Rename(tmpPath, path)
+		}
+
+		if IsPermanent(err) {
+			_ = os.Remove(tmpPath)
+			return
+		}
+		if attempt >= retries || ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("Download of %q failed (attempt %d of %d), retrying in %s: %s", url, attempt+1, retries+1, backoff, err.Error())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if maxBackoff := c.maxBackoff(); backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// attempt downloads url to tmpPath, resuming from the data that is already in the file
+func (c *Client) attempt(ctx context.Context, url string, header http.Header, tmpPath string, size int64) (err error) {
+	var offset int64
+	if fi, err := os.Stat(tmpPath); err == nil {
+		offset = fi.Size()
+	}
+	// A file that is too large is broken, it's better to start over
+	if size > 0 && offset > size {
+		offset = 0
+	}
+	if size > 0 && offset == size {
+		return nil
+	}
+
+	timeout := c.AttemptTimeout
+	if timeout == 0 {
+		timeout = DefaultAttemptTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &permanentError{err}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var flags = os.O_WRONLY | os.O_CREATE
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && rangeStart(resp.Header.Get("Content-Range")) == offset:
+		flags |= os.O_APPEND
+		log.Printf("Resuming download of %q at %s", url, text.FormatSize(offset))
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the range, so we start over
+		flags |= os.O_TRUNC
+		offset = 0
+	case resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The next attempt starts over
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("server can't continue download at %s", text.FormatSize(offset))
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	default:
+		return &permanentError{fmt.Errorf("unexpected status code %d", resp.StatusCode)}
+	}
+
+	f, err := os.OpenFile(tmpPath, flags, 0o644)
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	total := size
+	if total <= 0 && resp.ContentLength > 0 {
+		total = offset + resp.ContentLength
+	}
+
+	p := &progress{
+		total:    total,
+		offset:   offset,
+		written:  offset,
+		start:    time.Now(),
+		interval: c.progressInterval(),
+	}
+	p.last = p.start
+
+	n, err := io.Copy(io.MultiWriter(f, p), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+
+	written := offset + n
+	if size > 0 && written != size {
+		if written > size {
+			_ = os.Remove(tmpPath)
+		}
+		return fmt.Errorf("downloaded %d bytes, but expected %d", written, size)
+	}
+
+	log.Printf("Downloaded %s in %s", text.FormatSize(written), time.Since(p.start).Round(time.Millisecond))
+
+	return nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+func (c *Client) maxBackoff() time.Duration {
+	if c.MaxBackoff == 0 {
+		return DefaultMaxBackoff
+	}
+	return c.MaxBackoff
+}
+
+func (c *Client) progressInterval() time.Duration {
+	if c.ProgressInterval == 0 {
+		return DefaultProgressInterval
+	}
+	return c.ProgressInterval
+}
+
+// rangeStart returns the first byte of a Content-Range header like "bytes 100-199/200", or -1
+func rangeStart(contentRange string) int64 {
+	s := strings.TrimPrefix(contentRange, "bytes ")
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		start, err := strconv.ParseInt(s[:i], 10, 64)
+		if err == nil {
+			return start
+		}
+	}
+	return -1
+}
+
+// progress logs how much of a download is done every interval
+type progress struct {
+	total int64
+	// offset is where the download was resumed
+	offset   int64
+	written  int64
+	start    time.Time
+	last     time.Time
+	interval time.Duration
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+
+	if now := time.Now(); now.Sub(p.last) >= p.interval {
+		p.last = now
+
+		rate := float64(p.written-p.offset) / now.Sub(p.start).Seconds()
+		if p.total > 0 {
+			log.Printf("Downloaded %s of %s (%d%%) at %s/s", text.FormatSize(p.written), text.FormatSize(p.total), p.written*100/p.total, text.FormatSize(int64(rate)))
+		} else {
+			log.Printf("Downloaded %s at %s/s", text.FormatSize(p.written), text.FormatSize(int64(rate)))
+		}
+	}
+
+	return len(b), nil
+}
@@ -0,0 +1,112 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var (
+		mu     sync.Mutex
+		ranges []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+
+		if r.Header.Get("Accept") != "application/octet-stream" {
+			http.Error(w, "missing header", http.StatusBadRequest)
+			return
+		}
+
+		// The first response breaks off in the middle
+		if first {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:4000])
+			return
+		}
+
+		http.ServeContent(w, r, "app.apk", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "app.apk")
+
+	c := &Client{Backoff: time.Millisecond}
+	err := c.File(context.Background(), srv.URL, http.Header{"Accept": {"application/octet-stream"}}, path, int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded file has wrong content")
+	}
+
+	if len(ranges) != 2 || ranges[1] != "bytes=4000-" {
+		t.Errorf("requests had ranges %q, want second request to resume at 4000", ranges)
+	}
+
+	if _, err := os.Stat(path + ".tmp"); err == nil {
+		t.Errorf("temporary file wasn't removed")
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte("too short"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c := &Client{Retries: 2, Backoff: time.Millisecond}
+
+	// Missing files are not retried
+	err := c.File(context.Background(), srv.URL+"/missing", nil, filepath.Join(dir, "missing.apk"), 0)
+	if err == nil || requests != 1 {
+		t.Errorf("download of missing file returned %v after %d requests, want error after 1 request", err, requests)
+	}
+
+	requests = 0
+	path := filepath.Join(dir, "short.apk")
+
+	err = c.File(context.Background(), srv.URL+"/short", nil, path, 100)
+	if err == nil || requests != 3 {
+		t.Errorf("download with wrong size returned %v after %d requests, want error after 3 requests", err, requests)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Errorf("%s exists after failed download", path)
+	}
+	// The partial file is kept for the next run
+	if _, err := os.Stat(path + ".tmp"); err != nil {
+		t.Errorf("partial download was removed: %s", err.Error())
+	}
+}
@@ -0,0 +1,93 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+)
+
+// atomFeed is a feed in the Atom format, see RFC 4287
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   atomAuthor  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Links     []atomLink `xml:"link"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// atom converts the JSON feed to Atom. It is updated when its newest item was published, so it only
+// changes if there are new items
+func atom(f jsonFeed, base string) []byte {
+	a := atomFeed{
+		ID:       "urn:fdroid:feed",
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Updated:  formatTime(time.Unix(0, 0)),
+		Author:   atomAuthor{Name: f.Title},
+	}
+	if base != "" {
+		a.ID = base + "/" + AtomName
+		a.Links = []atomLink{
+			{Href: base + "/" + AtomName, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.HomePageURL, Rel: "alternate", Type: "text/html"},
+		}
+	}
+	if len(f.Items) > 0 {
+		a.Updated = formatTime(f.Items[0].DatePublished)
+	}
+
+	for _, item := range f.Items {
+		e := atomEntry{
+			ID:        item.ID,
+			Title:     item.Title,
+			Updated:   formatTime(item.DatePublished),
+			Published: formatTime(item.DatePublished),
+			Content:   atomText{Type: "text", Text: item.ContentText},
+		}
+		for _, att := range item.Attachments {
+			e.Links = append(e.Links, atomLink{Href: att.URL, Rel: "enclosure", Type: att.MimeType, Length: strconv.FormatInt(att.Size, 10)})
+		}
+
+		a.Entries = append(a.Entries, e)
+	}
+
+	content, err := xml.MarshalIndent(a, "", "\t")
+	if err != nil {
+		// All fields are strings, so this can't happen
+		panic("encoding Atom feed: " + err.Error())
+	}
+
+	return append([]byte(xml.Header), append(content, '\n')...)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
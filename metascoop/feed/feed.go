@@ -0,0 +1,215 @@
+// Package feed writes Atom and JSON feeds of the app versions that were added to the repo. The JSON feed
+// also keeps the entries of earlier runs, so each run only adds the versions that are new in the index
+package feed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"metascoop/apps"
+	"metascoop/md"
+)
+
+const (
+	// JSONName and AtomName are the files of the feeds
+	JSONName = "feed.json"
+	AtomName = "feed.xml"
+
+	// DefaultSize is how many versions the feeds list if Options.Size isn't set
+	DefaultSize = 50
+
+	jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+	apkMimeType     = "application/vnd.android.package-archive"
+)
+
+// Options configures the feeds
+type Options struct {
+	// Dir is where the feeds are written. It should be the fdroid directory, which is published
+	Dir string
+	// Size is how many of the newest versions the feeds list
+	Size int
+}
+
+// jsonFeed is a feed in the JSON Feed format, see https://www.jsonfeed.org/version/1.1/
+type jsonFeed struct {
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	HomePageURL string `json:"home_page_url,omitempty"`
+	FeedURL     string `json:"feed_url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Items       []Item `json:"items"`
+}
+
+// Item is a version of an app in the feed
+type Item struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url,omitempty"`
+	Title         string       `json:"title"`
+	ContentText   string       `json:"content_text"`
+	DatePublished time.Time    `json:"date_published"`
+	Attachments   []attachment `json:"attachments,omitempty"`
+	// Version identifies the version, so it isn't added again by later runs
+	Version version `json:"_metascoop"`
+}
+
+type attachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size_in_bytes,omitempty"`
+}
+
+type version struct {
+	PackageName string `json:"package_name"`
+	AppName     string `json:"app_name"`
+	VersionName string `json:"version_name"`
+	VersionCode int    `json:"version_code"`
+}
+
+func (v version) key() string {
+	return v.PackageName + ":" + strconv.Itoa(v.VersionCode)
+}
+
+// Update adds the versions that are in index, but not in oldIndex, to the feeds in opts.Dir and keeps the
+// newest opts.Size of them. If there is no feed yet, it starts with the newest versions of index. The APKs
+// and changelogs are looked up in repoDir
+func Update(opts Options, repoDir string, oldIndex, index *apps.RepoIndex) (added int, err error) {
+	if opts.Size <= 0 {
+		opts.Size = DefaultSize
+	}
+
+	jsonPath := filepath.Join(opts.Dir, JSONName)
+
+	var f jsonFeed
+	content, err := os.ReadFile(jsonPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		oldIndex = nil
+	case err != nil:
+		return
+	default:
+		err = json.Unmarshal(content, &f)
+		if err != nil {
+			return 0, fmt.Errorf("parsing %q: %w", jsonPath, err)
+		}
+	}
+
+	data, err := md.NewData(index, repoDir, opts.Dir)
+	if err != nil {
+		return
+	}
+
+	var known = make(map[string]bool)
+	for _, item := range f.Items {
+		known[item.Version.key()] = true
+	}
+	if oldIndex != nil {
+		for pkg, packages := range oldIndex.Packages {
+			for _, p := range packages {
+				known[version{PackageName: pkg, VersionCode: p.VersionCode}.key()] = true
+			}
+		}
+	}
+
+	var items []Item
+	for _, app := range data.Apps {
+		for _, v := range app.Versions {
+			item := newItem(data.Repo, app, v)
+			if !known[item.Version.key()] {
+				items = append(items, item)
+			}
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].DatePublished.Equal(items[j].DatePublished) {
+			return items[i].DatePublished.After(items[j].DatePublished)
+		}
+		return items[i].ID < items[j].ID
+	})
+	added = len(items)
+
+	f.Items = append(items, f.Items...)
+	if len(f.Items) > opts.Size {
+		f.Items = f.Items[:opts.Size]
+	}
+
+	base := baseURL(data.Repo.Address)
+
+	f.Version = jsonFeedVersion
+	f.Title = data.Repo.Name
+	f.Description = data.Repo.Description
+	if base != "" {
+		f.HomePageURL = base + "/"
+		f.FeedURL = base + "/" + JSONName
+	}
+
+	content, err = json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return
+	}
+
+	err = writeFile(jsonPath, append(content, '\n'))
+	if err != nil {
+		return
+	}
+
+	err = writeFile(filepath.Join(opts.Dir, AtomName), atom(f, base))
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func newItem(repo md.Repo, app md.App, v md.Version) (item Item) {
+	item = Item{
+		Title:         strings.TrimSpace(app.Name + " " + v.Name),
+		ContentText:   strings.TrimSpace(v.Changelog),
+		DatePublished: v.Added,
+		Version: version{
+			PackageName: app.PackageName,
+			AppName:     app.Name,
+			VersionName: v.Name,
+			VersionCode: v.Code,
+		},
+	}
+
+	if item.ContentText == "" {
+		item.ContentText = fmt.Sprintf("%s version %s (%d) is available", app.Name, v.Name, v.Code)
+	}
+
+	// Items need an ID that doesn't change, the link to the APK is one if the repo has an address
+	if repo.Address != "" && v.ApkName != "" {
+		item.URL = strings.TrimSuffix(repo.Address, "/") + "/" + v.ApkName
+		item.ID = item.URL
+		item.Attachments = []attachment{{URL: item.URL, MimeType: apkMimeType, Size: v.Size}}
+	} else {
+		item.ID = "urn:fdroid:" + item.Version.key()
+	}
+
+	return
+}
+
+// baseURL is the address of the fdroid directory, which contains the repo directory and the feeds
+func baseURL(address string) string {
+	address = strings.TrimSuffix(address, "/")
+	if i := strings.LastIndex(address, "/"); i > len("https://") {
+		return address[:i]
+	}
+	return ""
+}
+
+func writeFile(path string, content []byte) (err error) {
+	err = os.WriteFile(path+".tmp", content, 0o644)
+	if err != nil {
+		return
+	}
+
+	return os.Rename(path+".tmp", path)
+}
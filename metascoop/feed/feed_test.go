@@ -0,0 +1,114 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"metascoop/apps"
+)
+
+func testIndex(versionCodes ...int) *apps.RepoIndex {
+	index := &apps.RepoIndex{
+		Repo: map[string]interface{}{"name": "Test repo", "address": "https://example.com/fdroid/repo"},
+		Apps: []map[string]interface{}{
+			{"packageName": "com.example.notes", "name": "Notes"},
+		},
+		Packages: make(map[string][]apps.PackageInfo),
+	}
+
+	for _, code := range versionCodes {
+		index.Packages["com.example.notes"] = append(index.Packages["com.example.notes"], apps.PackageInfo{
+			VersionCode: code,
+			VersionName: "1." + string(rune('0'+code)),
+			ApkName:     "notes_" + string(rune('0'+code)) + ".apk",
+			Added:       int64(code) * 86400000,
+			Size:        1024,
+		})
+	}
+
+	return index
+}
+
+func TestUpdate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "fdroid")
+	repoDir := filepath.Join(dir, "repo")
+
+	err := os.MkdirAll(filepath.Join(dir, "metadata", "com.example.notes", apps.DefaultLocale, "changelogs"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(apps.ChangelogPath(filepath.Join(dir, "metadata"), "com.example.notes", apps.DefaultLocale, 3), []byte("Fixed <bugs>\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Dir: dir, Size: 2}
+
+	// The first run starts with the versions in the index
+	added, err := Update(opts, repoDir, testIndex(1), testIndex(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 {
+		t.Errorf("first run added %d versions, want 1", added)
+	}
+
+	added, err = Update(opts, repoDir, testIndex(1), testIndex(1, 2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 2 {
+		t.Errorf("second run added %d versions, want 2", added)
+	}
+
+	// Nothing is new, version 1 was in the feed before and isn't added again
+	added, err = Update(opts, repoDir, testIndex(1, 2, 3), testIndex(1, 2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 0 {
+		t.Errorf("third run added %d versions, want 0", added)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, JSONName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var f jsonFeed
+	err = json.Unmarshal(content, &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.FeedURL != "https://example.com/fdroid/feed.json" || len(f.Items) != 2 {
+		t.Fatalf("feed has URL %q and %d items, want 2:\n%s", f.FeedURL, len(f.Items), content)
+	}
+	if item := f.Items[0]; item.Title != "Notes 1.3" || item.ContentText != "Fixed <bugs>" || item.URL != "https://example.com/fdroid/repo/notes_3.apk" {
+		t.Errorf("first item is %+v, want version 3 with its changelog", item)
+	}
+	if item := f.Items[1]; item.Version.VersionCode != 2 {
+		t.Errorf("second item is version %d, want 2", item.Version.VersionCode)
+	}
+
+	atom, err := os.ReadFile(filepath.Join(dir, AtomName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a atomFeed
+	err = xml.Unmarshal(atom, &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Entries) != 2 || a.Updated != "1970-01-04T00:00:00Z" {
+		t.Errorf("Atom feed has %d entries and was updated %s, want 2 entries updated with version 3", len(a.Entries), a.Updated)
+	}
+	if !strings.Contains(string(atom), `<link href="https://example.com/fdroid/repo/notes_3.apk" rel="enclosure" type="application/vnd.android.package-archive" length="1024"></link>`) {
+		t.Errorf("Atom feed doesn't link the APK:\n%s", atom)
+	}
+}
@@ -0,0 +1,230 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// ErrNotFound is returned if the forge doesn't know the repository, e.g. because it was deleted
+var ErrNotFound = errors.New("repository not found")
+
+// StatusError is an unexpected status code of a forge API. A 404 is also an ErrNotFound
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from %s", e.StatusCode, e.URL)
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// File is a file in the tree of a repository
+type File struct {
+	Path string
+	// ID identifies the content of the file, e.g. the git blob SHA
+	ID string
+}
+
+// Repository is what a forge tells about a repository
+type Repository struct {
+	// FullName is "owner/name" as the forge knows it, which changes if the repository was renamed or transferred
+	FullName    string
+	Description string
+	// License is the SPDX identifier of the license the forge detected
+	License    string
+	Stars      int
+	Forks      int
+	OpenIssues int
+	Archived   bool
+	// PushedAt is the last push, or the last activity if the forge doesn't tell about pushes
+	PushedAt time.Time
+	// LatestRelease is the tag of the newest release, if there is one
+	LatestRelease   string
+	LatestReleaseAt time.Time
+}
+
+// Release is a published version of a repository with the files attached to it
+type Release struct {
+	Tag string
+	// URL is the web page of the release
+	URL string
+	// Notes are the release notes, usually written in Markdown
+	Notes       string
+	Draft       bool
+	Prerelease  bool
+	PublishedAt time.Time
+	Assets      []Asset
+}
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name string
+	// URL downloads the asset if it is requested with "Accept: application/octet-stream". It can redirect
+	// to another host
+	URL string
+	// Size is 0 if the forge doesn't tell it
+	Size int64
+	// Downloads is how often the asset was downloaded, if the forge counts downloads
+	Downloads int
+}
+
+// Forge gives access to a repository through the API of the site hosting it. Listing and
+// downloading files is a lot cheaper than cloning the whole repository just to find a few of them
+type Forge interface {
+	// Repository returns the details of the repository owner/name, or an ErrNotFound if it doesn't exist
+	Repository(ctx context.Context, owner, name string) (Repository, error)
+	// Releases returns all releases of the repository owner/name, newest first
+	Releases(ctx context.Context, owner, name string) ([]Release, error)
+	// ListFiles returns all files in the repository owner/name at the given git ref
+	ListFiles(ctx context.Context, owner, name, ref string) ([]File, error)
+	// DownloadFile writes the content of f to w
+	DownloadFile(ctx context.Context, owner, name, ref string, f File, w io.Writer) error
+}
+
+// Types of forge software
+const (
+	TypeGitHub = "github"
+	TypeGitLab = "gitlab"
+	// TypeGitea also covers Forgejo
+	TypeGitea = "gitea"
+)
+
+// Host tells which forge runs on a host, e.g. a self-hosted GitLab instance
+type Host struct {
+	// Type is TypeGitHub for GitHub Enterprise Server, TypeGitLab or TypeGitea
+	Type string `yaml:"type"`
+	// URL is the base URL of the instance, https://<host> if it is empty
+	URL string `yaml:"url"`
+}
+
+// DefaultHosts are the forges that are known without configuration
+var DefaultHosts = Hosts{
+	"github.com":   {Type: TypeGitHub},
+	"gitlab.com":   {Type: TypeGitLab},
+	"codeberg.org": {Type: TypeGitea},
+}
+
+// Hosts are the forges by host. Hosts that are missing are looked up in DefaultHosts
+type Hosts map[string]Host
+
+// Validate returns an error if a host has an unknown type or an invalid URL
+func (h Hosts) Validate() error {
+	for host, f := range h {
+		switch f.Type {
+		case TypeGitHub, TypeGitLab, TypeGitea:
+		default:
+			return fmt.Errorf("unknown forge type %q of %s, must be %q, %q or %q", f.Type, host, TypeGitHub, TypeGitLab, TypeGitea)
+		}
+
+		if f.URL != "" {
+			u, err := url.Parse(f.URL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("invalid URL %q of forge %s", f.URL, host)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ForHost returns the Forge for repositories on the given host, or nil if the host is unknown.
+// githubClient is used for github.com, httpClient for all other forges, nil means http.DefaultClient
+func (h Hosts) ForHost(host string, githubClient *github.Client, httpClient *http.Client) Forge {
+	f, ok := h[host]
+	if !ok {
+		f, ok = DefaultHosts[host]
+	}
+	if !ok {
+		return nil
+	}
+
+	baseURL := strings.TrimSuffix(f.URL, "/")
+	if baseURL == "" {
+		baseURL = "https://" + host
+	}
+
+	switch f.Type {
+	case TypeGitHub:
+		if host == "github.com" && f.URL == "" {
+			return &GitHub{Client: githubClient}
+		}
+
+		client, err := github.NewEnterpriseClient(baseURL+"/api/v3/", baseURL+"/api/uploads/", httpClient)
+		if err != nil {
+			return nil
+		}
+		return &GitHub{Client: client}
+	case TypeGitLab:
+		return &GitLab{BaseURL: baseURL, Client: httpClient}
+	case TypeGitea:
+		return &Gitea{BaseURL: baseURL, Client: httpClient}
+	}
+
+	return nil
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
+
+func get(ctx context.Context, client *http.Client, url string) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err = httpClient(client).Do(req)
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, &StatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	return
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) (header http.Header, err error) {
+	resp, err := get(ctx, client, url)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return nil, fmt.Errorf("decoding response from %s: %w", url, err)
+	}
+
+	return resp.Header, nil
+}
+
+func download(ctx context.Context, client *http.Client, url string, w io.Writer) (err error) {
+	resp, err := get(ctx, client, url)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+
+	return
+}
@@ -0,0 +1,154 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// fakeAPI serves the responses by request URI, e.g. "/api/v1/repos/example/app", and 404 for everything else
+func fakeAPI(t *testing.T, responses map[string]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func newGitHub(t *testing.T, srv *httptest.Server) *GitHub {
+	client := github.NewClient(srv.Client())
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	return &GitHub{Client: client}
+}
+
+func TestForges(t *testing.T) {
+	githubAPI := fakeAPI(t, map[string]string{
+		"/repos/example/app/git/trees/v1.0?recursive=1": `{"tree": [{"path": "README.md", "type": "blob", "sha": "abc"}, {"path": "docs", "type": "tree", "sha": "def"}]}`,
+		"/repos/example/app/git/blobs/abc":              "# App",
+		"/repos/example/app/releases?page=1&per_page=100": `[{"tag_name": "v1.0", "html_url": "https://github.com/example/app/releases/tag/v1.0", "body": "Notes", "prerelease": true,
+			"assets": [{"id": 7, "name": "app.apk", "size": 3, "download_count": 2, "state": "uploaded"}, {"id": 8, "name": "broken.apk", "state": "open"}]}]`,
+		"/repos/example/app/releases?page=2&per_page=100": `[]`,
+	})
+	giteaAPI := fakeAPI(t, map[string]string{
+		"/api/v1/repos/example/app/git/trees/v1.0?recursive=true&page=1&per_page=1000": `{"tree": [{"path": "README.md", "type": "blob", "sha": "abc"}], "truncated": false}`,
+		"/api/v1/repos/example/app/raw/README.md?ref=v1.0":                             "# App",
+		"/api/v1/repos/example/app/releases?page=1&limit=50": `[{"tag_name": "v1.0", "html_url": "https://codeberg.org/example/app/releases/tag/v1.0", "body": "Notes", "prerelease": true,
+			"assets": [{"name": "app.apk", "size": 3, "download_count": 2, "browser_download_url": "https://codeberg.org/example/app/releases/download/v1.0/app.apk"}]}]`,
+		"/api/v1/repos/example/app/releases?page=2&limit=50": `[]`,
+	})
+	gitlabAPI := fakeAPI(t, map[string]string{
+		"/api/v4/projects/example%2Fapp/repository/tree?recursive=true&per_page=100&page=1&ref=v1.0": `[{"id": "abc", "path": "README.md", "type": "blob"}, {"id": "def", "path": "docs", "type": "tree"}]`,
+		"/api/v4/projects/example%2Fapp/repository/blobs/abc/raw":                                    "# App",
+		"/api/v4/projects/example%2Fapp/releases?per_page=100&page=1": `[{"tag_name": "v1.0", "description": "Notes", "upcoming_release": true, "_links": {"self": "https://gitlab.com/example/app/-/releases/v1.0"},
+			"assets": {"links": [{"name": "Android app", "url": "https://gitlab.com/example/app/-/releases/v1.0/downloads/app.apk"}]}}]`,
+	})
+
+	for _, tc := range []struct {
+		name    string
+		forge   Forge
+		release Release
+	}{
+		{
+			name:  "GitHub",
+			forge: newGitHub(t, githubAPI),
+			release: Release{Tag: "v1.0", URL: "https://github.com/example/app/releases/tag/v1.0", Notes: "Notes", Prerelease: true, Assets: []Asset{
+				{Name: "app.apk", URL: githubAPI.URL + "/repos/example/app/releases/assets/7", Size: 3, Downloads: 2},
+			}},
+		},
+		{
+			name:  "Gitea",
+			forge: &Gitea{BaseURL: giteaAPI.URL, Client: giteaAPI.Client()},
+			release: Release{Tag: "v1.0", URL: "https://codeberg.org/example/app/releases/tag/v1.0", Notes: "Notes", Prerelease: true, Assets: []Asset{
+				{Name: "app.apk", URL: "https://codeberg.org/example/app/releases/download/v1.0/app.apk", Size: 3, Downloads: 2},
+			}},
+		},
+		{
+			name:  "GitLab",
+			forge: &GitLab{BaseURL: gitlabAPI.URL, Client: gitlabAPI.Client()},
+			release: Release{Tag: "v1.0", URL: "https://gitlab.com/example/app/-/releases/v1.0", Notes: "Notes", Draft: true, Assets: []Asset{
+				{Name: "app.apk", URL: "https://gitlab.com/example/app/-/releases/v1.0/downloads/app.apk"},
+			}},
+		},
+	} {
+		ctx := context.Background()
+
+		_, err := tc.forge.Repository(ctx, "example", "missing")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Repository of missing repository returned %v, want ErrNotFound", tc.name, err)
+		}
+
+		files, err := tc.forge.ListFiles(ctx, "example", "app", "v1.0")
+		if err != nil {
+			t.Errorf("%s: ListFiles: %s", tc.name, err.Error())
+			continue
+		}
+		if want := []File{{Path: "README.md", ID: "abc"}}; !reflect.DeepEqual(files, want) {
+			t.Errorf("%s: ListFiles returned %+v, want %+v", tc.name, files, want)
+			continue
+		}
+
+		var buf bytes.Buffer
+		err = tc.forge.DownloadFile(ctx, "example", "app", "v1.0", files[0], &buf)
+		if err != nil || buf.String() != "# App" {
+			t.Errorf("%s: DownloadFile wrote %q, %v, want the content of README.md", tc.name, buf.String(), err)
+		}
+
+		releases, err := tc.forge.Releases(ctx, "example", "app")
+		if err != nil {
+			t.Errorf("%s: Releases: %s", tc.name, err.Error())
+		} else if !reflect.DeepEqual(releases, []Release{tc.release}) {
+			t.Errorf("%s: Releases returned\n%+v\nwant\n%+v", tc.name, releases, []Release{tc.release})
+		}
+	}
+}
+
+func TestForHost(t *testing.T) {
+	hosts := Hosts{
+		"git.example.com":   {Type: TypeGitLab},
+		"code.example.com":  {Type: TypeGitea, URL: "https://example.com/code/"},
+		"ghe.example.com":   {Type: TypeGitHub},
+		"codeberg.org":      {Type: TypeGitea, URL: "https://mirror.example.com"},
+		"unknown.example.*": {Type: "svn"},
+	}
+
+	if err := hosts.Validate(); err == nil {
+		t.Errorf("hosts with unknown type are valid")
+	}
+	delete(hosts, "unknown.example.*")
+	if err := hosts.Validate(); err != nil {
+		t.Errorf("valid hosts returned %s", err.Error())
+	}
+
+	if f, ok := hosts.ForHost("git.example.com", nil, nil).(*GitLab); !ok || f.BaseURL != "https://git.example.com" {
+		t.Errorf("self-hosted GitLab got forge %#v", f)
+	}
+	if f, ok := hosts.ForHost("code.example.com", nil, nil).(*Gitea); !ok || f.BaseURL != "https://example.com/code" {
+		t.Errorf("Gitea with URL got forge %#v", f)
+	}
+	if f, ok := hosts.ForHost("codeberg.org", nil, nil).(*Gitea); !ok || f.BaseURL != "https://mirror.example.com" {
+		t.Errorf("configured host doesn't replace the default: %#v", f)
+	}
+	if f, ok := hosts.ForHost("ghe.example.com", nil, nil).(*GitHub); !ok || f.Client.BaseURL.String() != "https://ghe.example.com/api/v3/" {
+		t.Errorf("GitHub Enterprise Server got forge %#v", f)
+	}
+	if f, ok := hosts.ForHost("gitlab.com", nil, nil).(*GitLab); !ok || f.BaseURL != "https://gitlab.com" {
+		t.Errorf("default host got forge %#v", f)
+	}
+	if f := hosts.ForHost("example.org", nil, nil); f != nil {
+		t.Errorf("unknown host got forge %#v", f)
+	}
+}
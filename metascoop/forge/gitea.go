@@ -0,0 +1,181 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Gitea supports Gitea and Forgejo instances such as Codeberg
+type Gitea struct {
+	// BaseURL is the URL of the instance, e.g. https://codeberg.org
+	BaseURL string
+
+	Client *http.Client
+}
+
+type giteaTree struct {
+	Tree []struct {
+		Path string `json:"path"`
+		Type string `json:"type"`
+		SHA  string `json:"sha"`
+	} `json:"tree"`
+	Truncated  bool `json:"truncated"`
+	TotalCount int  `json:"total_count"`
+}
+
+func (g *Gitea) repoURL(owner, name string) string {
+	return fmt.Sprintf("%s/api/v1/repos/%s/%s", strings.TrimSuffix(g.BaseURL, "/"), url.PathEscape(owner), url.PathEscape(name))
+}
+
+func (g *Gitea) Repository(ctx context.Context, owner, name string) (repo Repository, err error) {
+	var r struct {
+		FullName    string    `json:"full_name"`
+		Description string    `json:"description"`
+		Stars       int       `json:"stars_count"`
+		Forks       int       `json:"forks_count"`
+		OpenIssues  int       `json:"open_issues_count"`
+		Archived    bool      `json:"archived"`
+		UpdatedAt   time.Time `json:"updated_at"`
+	}
+
+	_, err = getJSON(ctx, g.Client, g.repoURL(owner, name), &r)
+	if err != nil {
+		return
+	}
+
+	repo = Repository{
+		FullName:    r.FullName,
+		Description: r.Description,
+		Stars:       r.Stars,
+		Forks:       r.Forks,
+		OpenIssues:  r.OpenIssues,
+		Archived:    r.Archived,
+		PushedAt:    r.UpdatedAt,
+	}
+
+	// The newest release is enough here, all of them are only listed for the apps
+	var releases []giteaRelease
+
+	_, err = getJSON(ctx, g.Client, g.repoURL(owner, name)+"/releases?limit=1", &releases)
+	if errors.Is(err, ErrNotFound) {
+		// Releases can be disabled for a repository
+		return repo, nil
+	}
+	if err != nil {
+		return repo, fmt.Errorf("listing releases: %w", err)
+	}
+
+	if len(releases) > 0 {
+		repo.LatestRelease = releases[0].TagName
+		repo.LatestReleaseAt = releases[0].PublishedAt
+	}
+
+	return
+}
+
+type giteaRelease struct {
+	TagName     string    `json:"tag_name"`
+	HTMLURL     string    `json:"html_url"`
+	Body        string    `json:"body"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	PublishedAt time.Time `json:"published_at"`
+	Assets      []struct {
+		Name          string `json:"name"`
+		Size          int64  `json:"size"`
+		DownloadCount int    `json:"download_count"`
+		DownloadURL   string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// Releases returns no releases if they are disabled for the repository
+func (g *Gitea) Releases(ctx context.Context, owner, name string) (releases []Release, err error) {
+	const perPage = 50
+
+	for page := 1; ; page++ {
+		var rels []giteaRelease
+
+		_, err = getJSON(ctx, g.Client, fmt.Sprintf("%s/releases?page=%d&limit=%d", g.repoURL(owner, name), page, perPage), &rels)
+		if errors.Is(err, ErrNotFound) && page == 1 {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rels) == 0 {
+			break
+		}
+
+		for _, rel := range rels {
+			release := Release{
+				Tag:         rel.TagName,
+				URL:         rel.HTMLURL,
+				Notes:       rel.Body,
+				Draft:       rel.Draft,
+				Prerelease:  rel.Prerelease,
+				PublishedAt: rel.PublishedAt,
+			}
+			for _, asset := range rel.Assets {
+				release.Assets = append(release.Assets, Asset{
+					Name:      asset.Name,
+					URL:       asset.DownloadURL,
+					Size:      asset.Size,
+					Downloads: asset.DownloadCount,
+				})
+			}
+
+			releases = append(releases, release)
+		}
+	}
+
+	return
+}
+
+func (g *Gitea) ListFiles(ctx context.Context, owner, name, ref string) (files []File, err error) {
+	const perPage = 1000
+
+	// The trees endpoint resolves branch and tag names, not only commit SHAs
+	for page := 1; ; page++ {
+		var tree giteaTree
+
+		_, err = getJSON(ctx, g.Client, fmt.Sprintf("%s/git/trees/%s?recursive=true&page=%d&per_page=%d", g.repoURL(owner, name), url.PathEscape(ref), page, perPage), &tree)
+		if err != nil {
+			return
+		}
+
+		for _, e := range tree.Tree {
+			if e.Type != "blob" {
+				continue
+			}
+
+			files = append(files, File{
+				Path: e.Path,
+				ID:   e.SHA,
+			})
+		}
+
+		if !tree.Truncated || len(tree.Tree) == 0 {
+			break
+		}
+	}
+
+	return
+}
+
+func (g *Gitea) DownloadFile(ctx context.Context, owner, name, ref string, f File, w io.Writer) error {
+	return download(ctx, g.Client, fmt.Sprintf("%s/raw/%s?ref=%s", g.repoURL(owner, name), escapePath(f.Path), url.QueryEscape(ref)), w)
+}
+
+func escapePath(p string) string {
+	split := strings.Split(p, "/")
+	for i, s := range split {
+		split[i] = url.PathEscape(s)
+	}
+	return strings.Join(split, "/")
+}
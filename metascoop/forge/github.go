@@ -0,0 +1,134 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// GitHub lists files using the git trees API and downloads them as raw blobs
+type GitHub struct {
+	Client *github.Client
+}
+
+func (g *GitHub) Repository(ctx context.Context, owner, name string) (repo Repository, err error) {
+	r, resp, err := g.Client.Repositories.Get(ctx, owner, name)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return repo, ErrNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	repo = Repository{
+		FullName:    r.GetFullName(),
+		Description: r.GetDescription(),
+		License:     r.GetLicense().GetSPDXID(),
+		Stars:       r.GetStargazersCount(),
+		Forks:       r.GetForksCount(),
+		OpenIssues:  r.GetOpenIssuesCount(),
+		Archived:    r.GetArchived(),
+		PushedAt:    r.GetPushedAt().Time,
+	}
+
+	release, _, err := g.Client.Repositories.GetLatestRelease(ctx, owner, name)
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound {
+		// The repository has no releases
+		return repo, nil
+	}
+	if err != nil {
+		return repo, fmt.Errorf("fetching latest release: %w", err)
+	}
+
+	repo.LatestRelease = release.GetTagName()
+	repo.LatestReleaseAt = release.GetPublishedAt().Time
+
+	return
+}
+
+// Releases includes drafts, which are only listed with push access. Assets that were not completely
+// uploaded are left out
+func (g *GitHub) Releases(ctx context.Context, owner, name string) (releases []Release, err error) {
+	for page := 1; ; page++ {
+		rels, _, err := g.Client.Repositories.ListReleases(ctx, owner, name, &github.ListOptions{
+			Page:    page,
+			PerPage: 100,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(rels) == 0 {
+			break
+		}
+
+		for _, rel := range rels {
+			release := Release{
+				Tag:         rel.GetTagName(),
+				URL:         rel.GetHTMLURL(),
+				Notes:       rel.GetBody(),
+				Draft:       rel.GetDraft(),
+				Prerelease:  rel.GetPrerelease(),
+				PublishedAt: rel.GetPublishedAt().Time,
+			}
+
+			for _, asset := range rel.Assets {
+				if asset.GetState() != "uploaded" {
+					continue
+				}
+
+				release.Assets = append(release.Assets, Asset{
+					Name: asset.GetName(),
+					// The API URL of the asset redirects to the file, which can be resumed there
+					URL:       fmt.Sprintf("%srepos/%s/%s/releases/assets/%d", g.Client.BaseURL, owner, name, asset.GetID()),
+					Size:      int64(asset.GetSize()),
+					Downloads: asset.GetDownloadCount(),
+				})
+			}
+
+			releases = append(releases, release)
+		}
+	}
+
+	return
+}
+
+func (g *GitHub) ListFiles(ctx context.Context, owner, name, ref string) (files []File, err error) {
+	tree, _, err := g.Client.Git.GetTree(ctx, owner, name, ref, true)
+	if err != nil {
+		return
+	}
+
+	// A truncated tree would silently miss files, so the caller should rather clone the repository
+	if tree.GetTruncated() {
+		return nil, fmt.Errorf("tree of %s/%s at %q is too large to be listed via the API", owner, name, ref)
+	}
+
+	for _, e := range tree.Entries {
+		if e.GetType() != "blob" {
+			continue
+		}
+
+		files = append(files, File{
+			Path: e.GetPath(),
+			ID:   e.GetSHA(),
+		})
+	}
+
+	return
+}
+
+func (g *GitHub) DownloadFile(ctx context.Context, owner, name, ref string, f File, w io.Writer) (err error) {
+	content, _, err := g.Client.Git.GetBlobRaw(ctx, owner, name, f.ID)
+	if err != nil {
+		return
+	}
+
+	_, err = w.Write(content)
+
+	return
+}
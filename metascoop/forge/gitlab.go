@@ -0,0 +1,172 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// GitLab supports gitlab.com and self-hosted GitLab instances
+type GitLab struct {
+	// BaseURL is the URL of the instance, e.g. https://gitlab.com
+	BaseURL string
+
+	Client *http.Client
+}
+
+func (g *GitLab) projectURL(owner, name string) string {
+	return fmt.Sprintf("%s/api/v4/projects/%s", strings.TrimSuffix(g.BaseURL, "/"), url.PathEscape(owner+"/"+name))
+}
+
+// Repository uses the newest tag as the latest release, as GitLab projects often only tag their versions
+func (g *GitLab) Repository(ctx context.Context, owner, name string) (repo Repository, err error) {
+	var p struct {
+		PathWithNamespace string    `json:"path_with_namespace"`
+		Description       string    `json:"description"`
+		Stars             int       `json:"star_count"`
+		Forks             int       `json:"forks_count"`
+		OpenIssues        int       `json:"open_issues_count"`
+		Archived          bool      `json:"archived"`
+		LastActivityAt    time.Time `json:"last_activity_at"`
+	}
+
+	_, err = getJSON(ctx, g.Client, g.projectURL(owner, name), &p)
+	if err != nil {
+		return
+	}
+
+	repo = Repository{
+		FullName:    p.PathWithNamespace,
+		Description: p.Description,
+		Stars:       p.Stars,
+		Forks:       p.Forks,
+		OpenIssues:  p.OpenIssues,
+		Archived:    p.Archived,
+		PushedAt:    p.LastActivityAt,
+	}
+
+	var tags []struct {
+		Name   string `json:"name"`
+		Commit struct {
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"commit"`
+	}
+
+	_, err = getJSON(ctx, g.Client, g.projectURL(owner, name)+"/repository/tags", &tags)
+	if errors.Is(err, ErrNotFound) {
+		// The repository can be disabled for a project
+		return repo, nil
+	}
+	if err != nil {
+		return repo, fmt.Errorf("listing tags: %w", err)
+	}
+
+	if len(tags) > 0 {
+		repo.LatestRelease = tags[0].Name
+		repo.LatestReleaseAt = tags[0].Commit.CreatedAt
+	}
+
+	return
+}
+
+// Releases lists the releases of the project, whose assets are links. Upcoming releases are drafts,
+// as they are not published yet
+func (g *GitLab) Releases(ctx context.Context, owner, name string) (releases []Release, err error) {
+	var page = "1"
+
+	for page != "" {
+		var rels []struct {
+			TagName         string    `json:"tag_name"`
+			Description     string    `json:"description"`
+			ReleasedAt      time.Time `json:"released_at"`
+			UpcomingRelease bool      `json:"upcoming_release"`
+			Links           struct {
+				Self string `json:"self"`
+			} `json:"_links"`
+			Assets struct {
+				Links []struct {
+					Name           string `json:"name"`
+					URL            string `json:"url"`
+					DirectAssetURL string `json:"direct_asset_url"`
+				} `json:"links"`
+			} `json:"assets"`
+		}
+
+		header, ierr := getJSON(ctx, g.Client, fmt.Sprintf("%s/releases?per_page=100&page=%s", g.projectURL(owner, name), page), &rels)
+		if ierr != nil {
+			return nil, ierr
+		}
+
+		for _, rel := range rels {
+			release := Release{
+				Tag:         rel.TagName,
+				URL:         rel.Links.Self,
+				Notes:       rel.Description,
+				Draft:       rel.UpcomingRelease,
+				PublishedAt: rel.ReleasedAt,
+			}
+			for _, link := range rel.Assets.Links {
+				u := link.DirectAssetURL
+				if u == "" {
+					u = link.URL
+				}
+				// Link names are free text, so the file name of the URL is used if the name has no extension
+				name := link.Name
+				if path.Ext(name) == "" {
+					if parsed, err := url.Parse(u); err == nil {
+						name = path.Base(parsed.Path)
+					}
+				}
+				release.Assets = append(release.Assets, Asset{Name: name, URL: u})
+			}
+
+			releases = append(releases, release)
+		}
+
+		page = header.Get("X-Next-Page")
+	}
+
+	return
+}
+
+func (g *GitLab) ListFiles(ctx context.Context, owner, name, ref string) (files []File, err error) {
+	var page = "1"
+
+	for page != "" {
+		var entries []struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+			Path string `json:"path"`
+		}
+
+		header, ierr := getJSON(ctx, g.Client, fmt.Sprintf("%s/repository/tree?recursive=true&per_page=100&page=%s&ref=%s", g.projectURL(owner, name), page, url.QueryEscape(ref)), &entries)
+		if ierr != nil {
+			return nil, ierr
+		}
+
+		for _, e := range entries {
+			if e.Type != "blob" {
+				continue
+			}
+
+			files = append(files, File{
+				Path: e.Path,
+				ID:   e.ID,
+			})
+		}
+
+		page = header.Get("X-Next-Page")
+	}
+
+	return
+}
+
+func (g *GitLab) DownloadFile(ctx context.Context, owner, name, ref string, f File, w io.Writer) error {
+	return download(ctx, g.Client, fmt.Sprintf("%s/repository/blobs/%s/raw", g.projectURL(owner, name), url.PathEscape(f.ID)), w)
+}
@@ -1,17 +1,44 @@
 package git
 
 import (
+	"context"
+	"net/url"
 	"os"
 	"os/exec"
+
+	"metascoop/credentials"
 )
 
-func CloneRepo(gitUrl string) (dirPath string, err error) {
+// credentialHelper answers git's requests for credentials with the environment variables set by CloneRepo,
+// so that the credentials appear neither in the URL, which git prints in errors, nor in the process list
+const credentialHelper = `!f() { test "$1" = get && printf 'username=%s\npassword=%s\n' "$METASCOOP_GIT_USERNAME" "$METASCOOP_GIT_PASSWORD"; }; f`
+
+// CloneRepo clones the repository into a new temporary directory. If cred is set, it is used for the host of
+// gitUrl. The clone is stopped if ctx is cancelled
+func CloneRepo(ctx context.Context, gitUrl string, cred credentials.Credential) (dirPath string, err error) {
 	dirPath, err = os.MkdirTemp("", "git-*")
 	if err != nil {
 		return
 	}
 
-	cloneCmd := exec.Command("git", "clone", gitUrl, dirPath)
+	var args []string
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	if u, perr := url.Parse(gitUrl); perr == nil && u.Scheme == "https" && !cred.IsZero() {
+		username, password := cred.Git()
+
+		// The empty helper drops the helpers from the git config, which could answer with other credentials
+		args = append(args,
+			"-c", "credential.helper=",
+			"-c", "credential.https://"+u.Host+".helper="+credentialHelper,
+		)
+		env = append(env, "METASCOOP_GIT_USERNAME="+username, "METASCOOP_GIT_PASSWORD="+password)
+	}
+
+	args = append(args, "clone", gitUrl, dirPath)
+
+	cloneCmd := exec.CommandContext(ctx, "git", args...)
+	cloneCmd.Env = env
 	err = cloneCmd.Run()
 	if err != nil {
 		_ = os.RemoveAll(dirPath)
@@ -16,7 +16,10 @@ func GetChangedFileNames(repoPath string) (paths []string, err error) {
 		return
 	}
 
-	paths = strings.Split(strings.TrimSpace(string(output)), "\n")
+	// Splitting an empty output would return one empty path
+	if trimmed := strings.TrimSpace(string(output)); trimmed != "" {
+		paths = strings.Split(trimmed, "\n")
+	}
 
 	return
 }
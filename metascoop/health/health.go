@@ -0,0 +1,223 @@
+// Package health checks whether the upstream repositories of apps are still maintained, and remembers since
+// when they have problems, so that apps are only disabled after a grace period
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StateName is the file the state is kept in, in the fdroid directory
+const StateName = "health.json"
+
+const dateFormat = "2006-01-02"
+
+// Problem is something that is wrong with a repository
+type Problem string
+
+const (
+	// Deleted means the forge doesn't know the repository anymore
+	Deleted Problem = "deleted"
+	// Archived repositories are read-only, they don't get any updates
+	Archived Problem = "archived"
+	// Renamed repositories were renamed or transferred to another owner, the forge redirects to them
+	Renamed Problem = "renamed"
+	// Inactive repositories had no push for a long time
+	Inactive Problem = "inactive"
+	// NoRelease means there was no release for a long time
+	NoRelease Problem = "no release"
+)
+
+// Abandoned returns whether the problem means that the app isn't maintained anymore. A renamed repository
+// is still maintained, it only needs to be updated in the app file
+func (p Problem) Abandoned() bool {
+	return p != Renamed
+}
+
+// Finding is a problem of a repository with details for the warning
+type Finding struct {
+	Problem Problem
+	Detail  string
+}
+
+func (f Finding) String() string {
+	return f.Detail
+}
+
+// Repository is what the forge tells about the repository of an app
+type Repository struct {
+	// Name is "owner/name" as in the app file
+	Name string
+	// Deleted is set if the forge doesn't know the repository, then the other fields are empty
+	Deleted bool
+	// FullName is "owner/name" as the forge knows it
+	FullName        string
+	Archived        bool
+	PushedAt        time.Time
+	LatestRelease   string
+	LatestReleaseAt time.Time
+}
+
+// Checks are the thresholds of the checks. Zero durations disable a check
+type Checks struct {
+	// InactiveAfter is how long a repository can go without a push
+	InactiveAfter time.Duration
+	// NoReleaseAfter is how long a repository can go without a release
+	NoReleaseAfter time.Duration
+}
+
+// Check returns the problems of the repository at the time now
+func (c Checks) Check(now time.Time, repo Repository) (findings []Finding) {
+	if repo.Deleted {
+		return []Finding{{Deleted, fmt.Sprintf("repository %s doesn't exist anymore", repo.Name)}}
+	}
+
+	if repo.Archived {
+		findings = append(findings, Finding{Archived, fmt.Sprintf("repository %s is archived", repo.Name)})
+	}
+	if repo.FullName != "" && !strings.EqualFold(repo.FullName, repo.Name) {
+		findings = append(findings, Finding{Renamed, fmt.Sprintf("repository %s was renamed or transferred to %s", repo.Name, repo.FullName)})
+	}
+	if c.InactiveAfter > 0 && !repo.PushedAt.IsZero() && now.Sub(repo.PushedAt) > c.InactiveAfter {
+		findings = append(findings, Finding{Inactive, fmt.Sprintf("repository %s had no push since %s", repo.Name, repo.PushedAt.Format(dateFormat))})
+	}
+	if c.NoReleaseAfter > 0 && !repo.LatestReleaseAt.IsZero() && now.Sub(repo.LatestReleaseAt) > c.NoReleaseAfter {
+		findings = append(findings, Finding{NoRelease, fmt.Sprintf("repository %s had no release since %s (%s)", repo.Name, repo.LatestReleaseAt.Format(dateFormat), repo.LatestRelease)})
+	}
+
+	return
+}
+
+// State remembers the problems of the apps between runs, and which metadata fields were changed because of them
+type State struct {
+	Apps map[string]*AppState `json:"apps"`
+}
+
+// AppState is the state of an app
+type AppState struct {
+	// Since is the first run that found the current problems
+	Since    time.Time `json:"since,omitempty"`
+	Problems []Problem `json:"problems,omitempty"`
+
+	// Disabled and NoSourceSince are the values that were written to the metadata, so they can be removed
+	// when the problems are gone
+	Disabled      string `json:"disabled,omitempty"`
+	NoSourceSince string `json:"no_source_since,omitempty"`
+	// Packages are the packages whose metadata was changed. They aren't in the index anymore if they are disabled
+	Packages []string `json:"packages,omitempty"`
+}
+
+// Abandoned returns whether the app has problems that mean it isn't maintained anymore
+func (a *AppState) Abandoned() bool {
+	for _, p := range a.Problems {
+		if p.Abandoned() {
+			return true
+		}
+	}
+	return false
+}
+
+// Has returns whether the app has the problem
+func (a *AppState) Has(problem Problem) bool {
+	for _, p := range a.Problems {
+		if p == problem {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPackage adds the package to Packages, or removes it if changed is false
+func (a *AppState) SetPackage(pkgname string, changed bool) {
+	var packages []string
+	for _, p := range a.Packages {
+		if p != pkgname {
+			packages = append(packages, p)
+		}
+	}
+	if changed {
+		packages = append(packages, pkgname)
+		sort.Strings(packages)
+	}
+	a.Packages = packages
+}
+
+func (a *AppState) empty() bool {
+	return len(a.Problems) == 0 && a.Disabled == "" && a.NoSourceSince == "" && len(a.Packages) == 0
+}
+
+// ReadState reads the state from path. It is empty if the file doesn't exist
+func ReadState(path string) (s *State, err error) {
+	s = &State{Apps: make(map[string]*AppState)}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(content, s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", path, err)
+	}
+	if s.Apps == nil {
+		s.Apps = make(map[string]*AppState)
+	}
+
+	return
+}
+
+// Write writes the state to path
+func (s *State) Write(path string) (err error) {
+	for name, a := range s.Apps {
+		if a.empty() {
+			delete(s.Apps, name)
+		}
+	}
+
+	content, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return
+	}
+
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
+
+// App returns the state of an app, which is created if it doesn't exist
+func (s *State) App(name string) *AppState {
+	a, ok := s.Apps[name]
+	if !ok {
+		a = &AppState{}
+		s.Apps[name] = a
+	}
+	return a
+}
+
+// Update records the findings of a check of the app at the time now. The problems are considered to exist
+// since the first check that found any of them, until a check finds none
+func (s *State) Update(name string, findings []Finding, now time.Time) *AppState {
+	a := s.App(name)
+
+	var problems []Problem
+	for _, f := range findings {
+		problems = append(problems, f.Problem)
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i] < problems[j] })
+
+	switch {
+	case len(problems) == 0:
+		a.Since = time.Time{}
+	case len(a.Problems) == 0:
+		a.Since = now.UTC().Truncate(time.Second)
+	}
+	a.Problems = problems
+
+	return a
+}
@@ -0,0 +1,95 @@
+package health
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	checks := Checks{InactiveAfter: 365 * 24 * time.Hour, NoReleaseAfter: 180 * 24 * time.Hour}
+
+	tests := []struct {
+		name string
+		repo Repository
+		want []Problem
+	}{
+		{"healthy", Repository{Name: "example/notes", FullName: "Example/Notes", PushedAt: now.AddDate(0, -1, 0), LatestReleaseAt: now.AddDate(0, -2, 0)}, nil},
+		{"unknown dates", Repository{Name: "example/notes", FullName: "example/notes"}, nil},
+		{"deleted", Repository{Name: "example/notes", Deleted: true, Archived: true}, []Problem{Deleted}},
+		{"archived and renamed", Repository{Name: "example/notes", FullName: "other/notes", Archived: true}, []Problem{Archived, Renamed}},
+		{"inactive", Repository{Name: "example/notes", PushedAt: now.AddDate(-2, 0, 0), LatestRelease: "v1.0", LatestReleaseAt: now.AddDate(-2, 0, 0)}, []Problem{Inactive, NoRelease}},
+		{"disabled check", Repository{Name: "example/notes", PushedAt: now.AddDate(-2, 0, 0)}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := checks
+			if tt.name == "disabled check" {
+				c.InactiveAfter = 0
+			}
+
+			var got []Problem
+			for _, f := range c.Check(now, tt.repo) {
+				got = append(got, f.Problem)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() found %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), StateName)
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).AddDate(0, 0, d)
+	}
+
+	s, err := ReadState(path)
+	if err != nil || len(s.Apps) != 0 {
+		t.Fatalf("ReadState() of a missing file = %+v, %v, want an empty state", s, err)
+	}
+
+	a := s.Update("notes", []Finding{{Problem: Archived}}, day(0))
+	if !a.Since.Equal(day(0)) || !a.Abandoned() {
+		t.Errorf("app has problems since %s, abandoned %t, want since %s", a.Since, a.Abandoned(), day(0))
+	}
+
+	// Further problems don't restart the grace period
+	a = s.Update("notes", []Finding{{Problem: Inactive}, {Problem: Archived}}, day(5))
+	if !a.Since.Equal(day(0)) || !reflect.DeepEqual(a.Problems, []Problem{Archived, Inactive}) {
+		t.Errorf("app has problems %v since %s, want [archived inactive] since %s", a.Problems, a.Since, day(0))
+	}
+	a.Disabled = "Upstream repository is archived"
+	a.SetPackage("com.example.notes", true)
+
+	if a := s.Update("timer", []Finding{{Problem: Renamed}}, day(5)); a.Abandoned() {
+		t.Errorf("renamed repository is considered abandoned")
+	}
+	s.Update("scanner", nil, day(5))
+
+	err = s.Write(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = ReadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Apps["scanner"]; ok {
+		t.Errorf("healthy app was written to the state")
+	}
+	if a := s.Apps["notes"]; a == nil || a.Disabled == "" || !reflect.DeepEqual(a.Packages, []string{"com.example.notes"}) {
+		t.Errorf("state of notes wasn't read back: %+v", a)
+	}
+
+	// Once the problems are gone, the app is kept until its metadata is restored
+	a = s.Update("notes", nil, day(10))
+	if !a.Since.IsZero() || a.Abandoned() || a.empty() {
+		t.Errorf("healthy app has state %+v", a)
+	}
+}
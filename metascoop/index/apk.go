@@ -0,0 +1,325 @@
+package index
+
+import (
+	"archive/zip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Permission is a permission requested by an APK
+type Permission struct {
+	Name string
+	// MaxSdkVersion is the highest SDK version the permission is requested for, 0 if there is no limit
+	MaxSdkVersion int
+}
+
+// APK contains everything about an APK file that is needed for the index
+type APK struct {
+	// FileName is the name of the file in the repo directory
+	FileName string
+	Size     int64
+	// Hash is the hex encoded SHA-256 hash of the file
+	Hash string
+
+	PackageName string
+	VersionCode int
+	VersionName string
+	Label       string
+
+	MinSdkVersion    int
+	TargetSdkVersion int
+	MaxSdkVersion    int
+
+	Permissions      []Permission
+	PermissionsSdk23 []Permission
+	Features         []string
+	NativeCode       []string
+
+	// Signer is the hex encoded SHA-256 hash of the signing certificate
+	Signer string
+	// Sig is the legacy signature fingerprint, the MD5 hash of the hex encoded certificate
+	Sig string
+
+	// icons are the paths of PNG launcher icons in the APK by density
+	icons map[int]string
+
+	// path is where the APK currently is and added the time it was first added to the repo
+	path  string
+	added int64
+}
+
+// ParseAPK reads the manifest, resources and signature of the APK at apkPath
+func ParseAPK(apkPath string) (apk *APK, err error) {
+	f, err := os.Open(apkPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return
+	}
+
+	apk = &APK{
+		path:     apkPath,
+		FileName: stat.Name(),
+		Size:     stat.Size(),
+		Hash:     hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	zr, err := zip.NewReader(f, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest, resources []byte
+	for _, zf := range zr.File {
+		switch {
+		case zf.Name == "AndroidManifest.xml":
+			manifest, err = readZipFile(zf)
+		case zf.Name == "resources.arsc":
+			resources, err = readZipFile(zf)
+		case strings.HasPrefix(zf.Name, "lib/") && strings.Count(zf.Name, "/") == 2 && strings.HasSuffix(zf.Name, ".so"):
+			abi := path.Base(path.Dir(zf.Name))
+			if !contains(apk.NativeCode, abi) {
+				apk.NativeCode = append(apk.NativeCode, abi)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %w", zf.Name, err)
+		}
+	}
+	sort.Strings(apk.NativeCode)
+
+	if manifest == nil {
+		return nil, fmt.Errorf("%q doesn't contain an AndroidManifest.xml", apkPath)
+	}
+
+	var table *resourceTable
+	if resources != nil {
+		table, err = parseResourceTable(resources)
+		if err != nil {
+			return nil, fmt.Errorf("parsing resources.arsc: %w", err)
+		}
+	}
+
+	err = apk.readManifest(manifest, table, zr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing AndroidManifest.xml: %w", err)
+	}
+
+	cert, err := signerCertificate(apkPath, zr)
+	if err != nil {
+		return nil, fmt.Errorf("reading signature: %w", err)
+	}
+
+	signer := sha256.Sum256(cert)
+	apk.Signer = hex.EncodeToString(signer[:])
+	sig := md5.Sum([]byte(hex.EncodeToString(cert)))
+	apk.Sig = hex.EncodeToString(sig[:])
+
+	return
+}
+
+func (apk *APK) readManifest(manifest []byte, table *resourceTable, zr *zip.Reader) error {
+	elements, err := parseBinaryXML(manifest)
+	if err != nil {
+		return err
+	}
+
+	// stringValue resolves string resources if the attribute is a reference
+	stringValue := func(a xmlAttribute) string {
+		if a.dataType == typeReference && table != nil {
+			return table.resolveString(a.data)
+		}
+		return a.String()
+	}
+
+	for _, e := range elements {
+		switch strings.Join(e.path, "/") {
+		case "manifest":
+			if a, ok := e.attr(0, "package"); ok {
+				apk.PackageName = a.String()
+			}
+			if a, ok := e.attr(attrVersionCode, "versionCode"); ok {
+				apk.VersionCode, _ = a.Int()
+			}
+			if a, ok := e.attr(attrVersionName, "versionName"); ok {
+				apk.VersionName = stringValue(a)
+			}
+		case "manifest/uses-sdk":
+			if a, ok := e.attr(attrMinSdkVersion, "minSdkVersion"); ok {
+				apk.MinSdkVersion, _ = a.Int()
+			}
+			if a, ok := e.attr(attrTargetSdkVersion, "targetSdkVersion"); ok {
+				apk.TargetSdkVersion, _ = a.Int()
+			}
+			if a, ok := e.attr(attrMaxSdkVersion, "maxSdkVersion"); ok {
+				apk.MaxSdkVersion, _ = a.Int()
+			}
+		case "manifest/uses-permission", "manifest/uses-permission-sdk-23", "manifest/uses-permission-sdk-m":
+			name, ok := e.attr(attrName, "name")
+			if !ok {
+				continue
+			}
+
+			p := Permission{Name: name.String()}
+			if a, ok := e.attr(attrMaxSdkVersion, "maxSdkVersion"); ok {
+				p.MaxSdkVersion, _ = a.Int()
+			}
+
+			if e.name == "uses-permission" {
+				apk.Permissions = append(apk.Permissions, p)
+			} else {
+				apk.PermissionsSdk23 = append(apk.PermissionsSdk23, p)
+			}
+		case "manifest/uses-feature":
+			name, ok := e.attr(attrName, "name")
+			if !ok {
+				continue
+			}
+			// Optional features don't restrict on which devices the app can be installed
+			if required, ok := e.attr(attrRequired, "required"); ok && required.dataType == typeBoolean && required.data == 0 {
+				continue
+			}
+			apk.Features = append(apk.Features, name.String())
+		case "manifest/application":
+			if a, ok := e.attr(attrLabel, "label"); ok {
+				apk.Label = stringValue(a)
+			}
+			if a, ok := e.attr(attrIcon, "icon"); ok && a.dataType == typeReference && table != nil {
+				apk.icons = findIcons(zr, table.resolve(a.data))
+			}
+		}
+	}
+
+	if apk.PackageName == "" {
+		return fmt.Errorf("manifest doesn't contain a package name")
+	}
+
+	// The default for the target SDK version is the min SDK version, which defaults to 1
+	if apk.MinSdkVersion == 0 {
+		apk.MinSdkVersion = 1
+	}
+	if apk.TargetSdkVersion == 0 {
+		apk.TargetSdkVersion = apk.MinSdkVersion
+	}
+
+	return nil
+}
+
+// findIcons returns the paths of the PNG icons by density. Adaptive and vector icons are XML files which
+// we can't render, so like fdroidserver we look for PNG files with the same name in the other resource
+// directories instead
+func findIcons(zr *zip.Reader, values []resourceValue) (icons map[int]string) {
+	icons = pngIcons(values)
+
+	for _, v := range values {
+		if len(icons) > 0 {
+			break
+		}
+		if v.dataType == typeString && strings.HasSuffix(strings.ToLower(v.str), ".xml") {
+			icons = namedPNGIcons(zr, strings.TrimSuffix(path.Base(v.str), path.Ext(v.str)))
+		}
+	}
+
+	return
+}
+
+// pngIcons returns the paths of all PNG icons by density
+func pngIcons(values []resourceValue) (icons map[int]string) {
+	for _, v := range values {
+		if v.dataType != typeString || !strings.HasSuffix(strings.ToLower(v.str), ".png") {
+			continue
+		}
+
+		density := v.density
+		switch density {
+		case densityDefault, densityAny, densityNone:
+			density = densityMedium
+		}
+
+		if icons == nil {
+			icons = make(map[int]string)
+		}
+		if _, ok := icons[density]; !ok {
+			icons[density] = v.str
+		}
+	}
+
+	return
+}
+
+// namedPNGIcons returns the paths of the PNG files called name in the resource directories of the APK by
+// density, which is read from the directory name like "mipmap-xhdpi-v4"
+func namedPNGIcons(zr *zip.Reader, name string) (icons map[int]string) {
+	for _, f := range zr.File {
+		dir, file := path.Split(f.Name)
+		if file != name+".png" || path.Dir(path.Clean(dir)) != "res" {
+			continue
+		}
+
+		density := densityMedium
+		for _, qualifier := range strings.Split(path.Base(dir), "-")[1:] {
+			if d, ok := densityQualifiers[qualifier]; ok {
+				density = d
+			}
+		}
+
+		if icons == nil {
+			icons = make(map[int]string)
+		}
+		if _, ok := icons[density]; !ok {
+			icons[density] = f.Name
+		}
+	}
+
+	return
+}
+
+// iconFor returns the path of the icon in the APK that fits the given density best:
+// the smallest one that is at least as large, or the largest one available
+func (apk *APK) iconFor(density int) (iconPath string, ok bool) {
+	best, largest := -1, -1
+
+	for d := range apk.icons {
+		if d >= density && (best < 0 || d < best) {
+			best = d
+		}
+		if d > largest {
+			largest = d
+		}
+	}
+
+	if best < 0 {
+		best = largest
+	}
+	if best < 0 {
+		return "", false
+	}
+
+	return apk.icons[best], true
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
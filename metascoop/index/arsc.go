@@ -0,0 +1,241 @@
+package index
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Densities used by Android resource configurations
+const (
+	densityDefault = 0
+	densityMedium  = 160
+	densityAny     = 0xfffe
+	densityNone    = 0xffff
+)
+
+// densityQualifiers are the densities of the qualifiers in resource directory names
+var densityQualifiers = map[string]int{
+	"ldpi":    120,
+	"mdpi":    160,
+	"tvdpi":   213,
+	"hdpi":    240,
+	"xhdpi":   320,
+	"xxhdpi":  480,
+	"xxxhdpi": 640,
+}
+
+// resourceValue is one value of a resource for a specific configuration
+type resourceValue struct {
+	density  int
+	locale   string
+	dataType uint8
+	data     uint32
+	// str is set for string values
+	str string
+}
+
+// resourceTable is the parsed resources.arsc file of an APK.
+// Only the parts that are needed to resolve labels, version names and icons are decoded
+type resourceTable struct {
+	strings []string
+	// values maps resource IDs to their values in all configurations
+	values map[uint32][]resourceValue
+}
+
+func parseResourceTable(b []byte) (t *resourceTable, err error) {
+	h, err := readChunkHeader(b)
+	if err != nil {
+		return
+	}
+	if h.typ != chunkTable {
+		return nil, fmt.Errorf("not a resource table (chunk type 0x%04x)", h.typ)
+	}
+
+	t = &resourceTable{values: make(map[uint32][]resourceValue)}
+
+	for offset := int(h.headerSize); offset < int(h.size); {
+		ch, err := readChunkHeader(b[offset:])
+		if err != nil {
+			return nil, err
+		}
+		chunk := b[offset : offset+int(ch.size)]
+
+		switch ch.typ {
+		case chunkStringPool:
+			t.strings, err = parseStringPool(chunk)
+		case chunkTablePackage:
+			err = t.parsePackage(chunk, ch)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		offset += int(ch.size)
+	}
+
+	return
+}
+
+func (t *resourceTable) parsePackage(chunk []byte, h chunkHeader) error {
+	if len(chunk) < 12 {
+		return errInvalidChunk
+	}
+
+	packageID := binary.LittleEndian.Uint32(chunk[8:])
+
+	for offset := int(h.headerSize); offset < len(chunk); {
+		ch, err := readChunkHeader(chunk[offset:])
+		if err != nil {
+			return err
+		}
+
+		if ch.typ == chunkTableType {
+			err = t.parseType(packageID, chunk[offset:offset+int(ch.size)], ch)
+			if err != nil {
+				return err
+			}
+		}
+
+		offset += int(ch.size)
+	}
+
+	return nil
+}
+
+const (
+	typeFlagSparse   = 0x01
+	typeFlagOffset16 = 0x02
+
+	entryFlagComplex = 0x0001
+	entryFlagCompact = 0x0008
+
+	noEntry   = 0xffffffff
+	noEntry16 = 0xffff
+)
+
+func (t *resourceTable) parseType(packageID uint32, chunk []byte, h chunkHeader) error {
+	if len(chunk) < 20+28 {
+		return errInvalidChunk
+	}
+
+	var (
+		typeID       = uint32(chunk[8])
+		flags        = chunk[9]
+		entryCount   = int(binary.LittleEndian.Uint32(chunk[12:]))
+		entriesStart = int(binary.LittleEndian.Uint32(chunk[16:]))
+		config       = chunk[20:h.headerSize]
+		offsets      = chunk[h.headerSize:]
+	)
+
+	var (
+		density = int(binary.LittleEndian.Uint16(config[14:]))
+		locale  string
+	)
+	if config[8] != 0 && config[8]&0x80 == 0 {
+		locale = string(config[8:10])
+		if config[10] != 0 && config[10]&0x80 == 0 {
+			locale += "-" + string(config[10:12])
+		}
+	}
+
+	for i := 0; i < entryCount; i++ {
+		var (
+			index  = i
+			offset int
+		)
+
+		switch {
+		case flags&typeFlagSparse != 0:
+			if 4*i+4 > len(offsets) {
+				return errInvalidChunk
+			}
+			index = int(binary.LittleEndian.Uint16(offsets[4*i:]))
+			offset = 4 * int(binary.LittleEndian.Uint16(offsets[4*i+2:]))
+		case flags&typeFlagOffset16 != 0:
+			if 2*i+2 > len(offsets) {
+				return errInvalidChunk
+			}
+			o := binary.LittleEndian.Uint16(offsets[2*i:])
+			if o == noEntry16 {
+				continue
+			}
+			offset = 4 * int(o)
+		default:
+			if 4*i+4 > len(offsets) {
+				return errInvalidChunk
+			}
+			o := binary.LittleEndian.Uint32(offsets[4*i:])
+			if o == noEntry {
+				continue
+			}
+			offset = int(o)
+		}
+
+		entry := entriesStart + offset
+		if entry+8 > len(chunk) {
+			return errInvalidChunk
+		}
+
+		var (
+			size       = int(binary.LittleEndian.Uint16(chunk[entry:]))
+			entryFlags = binary.LittleEndian.Uint16(chunk[entry+2:])
+			value      = resourceValue{density: density, locale: locale}
+		)
+
+		switch {
+		case entryFlags&entryFlagCompact != 0:
+			value.dataType = uint8(entryFlags >> 8)
+			value.data = binary.LittleEndian.Uint32(chunk[entry+4:])
+		case entryFlags&entryFlagComplex != 0:
+			// Styles, arrays etc. are never needed for the manifest attributes we resolve
+			continue
+		default:
+			v := entry + size
+			if v+8 > len(chunk) {
+				return errInvalidChunk
+			}
+			value.dataType = chunk[v+3]
+			value.data = binary.LittleEndian.Uint32(chunk[v+4:])
+		}
+
+		if value.dataType == typeString {
+			value.str = stringAt(t.strings, value.data)
+		}
+
+		id := packageID<<24 | typeID<<16 | uint32(index)
+		t.values[id] = append(t.values[id], value)
+	}
+
+	return nil
+}
+
+// resolve follows references until it finds the values of a resource
+func (t *resourceTable) resolve(id uint32) []resourceValue {
+	for depth := 0; depth < 8; depth++ {
+		values := t.values[id]
+		if len(values) == 0 || values[0].dataType != typeReference {
+			return values
+		}
+		id = values[0].data
+	}
+	return nil
+}
+
+// resolveString returns the string value of a resource in the default configuration,
+// or in the first configuration that has a value
+func (t *resourceTable) resolveString(id uint32) string {
+	values := t.resolve(id)
+
+	for _, v := range values {
+		if v.locale == "" && v.dataType == typeString {
+			return v.str
+		}
+	}
+	for _, v := range values {
+		if v.dataType == typeString {
+			return v.str
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,338 @@
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Chunk types of Android's binary resource format, see
+// https://android.googlesource.com/platform/frameworks/base/+/master/libs/androidfw/include/androidfw/ResourceTypes.h
+const (
+	chunkStringPool   = 0x0001
+	chunkTable        = 0x0002
+	chunkXML          = 0x0003
+	chunkXMLStartElem = 0x0102
+	chunkXMLEndElem   = 0x0103
+	chunkXMLResMap    = 0x0180
+	chunkTablePackage = 0x0200
+	chunkTableType    = 0x0201
+)
+
+// Types of resource values
+const (
+	typeReference = 0x01
+	typeString    = 0x03
+	typeIntDec    = 0x10
+	typeIntHex    = 0x11
+	typeBoolean   = 0x12
+)
+
+// Resource IDs of the android namespace attributes we need. Attribute names can be
+// stripped or obfuscated in the binary format, their resource IDs can't
+const (
+	attrLabel            = 0x01010001
+	attrIcon             = 0x01010002
+	attrName             = 0x01010003
+	attrRequired         = 0x0101028e
+	attrMinSdkVersion    = 0x0101020c
+	attrVersionCode      = 0x0101021b
+	attrVersionName      = 0x0101021c
+	attrTargetSdkVersion = 0x01010270
+	attrMaxSdkVersion    = 0x01010271
+)
+
+var errInvalidChunk = errors.New("invalid chunk in binary resource")
+
+type chunkHeader struct {
+	typ        uint16
+	headerSize uint16
+	size       uint32
+}
+
+func readChunkHeader(b []byte) (h chunkHeader, err error) {
+	if len(b) < 8 {
+		return h, errInvalidChunk
+	}
+
+	h = chunkHeader{
+		typ:        binary.LittleEndian.Uint16(b),
+		headerSize: binary.LittleEndian.Uint16(b[2:]),
+		size:       binary.LittleEndian.Uint32(b[4:]),
+	}
+
+	if h.size < uint32(h.headerSize) || int(h.size) > len(b) || h.headerSize < 8 {
+		return h, errInvalidChunk
+	}
+
+	return
+}
+
+// parseStringPool decodes a string pool chunk, which may contain UTF-8 or UTF-16 strings
+func parseStringPool(chunk []byte) (strings []string, err error) {
+	if len(chunk) < 28 {
+		return nil, errInvalidChunk
+	}
+
+	var (
+		count        = int(binary.LittleEndian.Uint32(chunk[8:]))
+		flags        = binary.LittleEndian.Uint32(chunk[16:])
+		stringsStart = int(binary.LittleEndian.Uint32(chunk[20:]))
+		headerSize   = int(binary.LittleEndian.Uint16(chunk[2:]))
+		isUTF8       = flags&(1<<8) != 0
+	)
+
+	if headerSize+4*count > len(chunk) || stringsStart > len(chunk) {
+		return nil, errInvalidChunk
+	}
+
+	strings = make([]string, count)
+	for i := range strings {
+		offset := stringsStart + int(binary.LittleEndian.Uint32(chunk[headerSize+4*i:]))
+		if offset >= len(chunk) {
+			return nil, errInvalidChunk
+		}
+
+		if isUTF8 {
+			strings[i], err = decodeUTF8String(chunk[offset:])
+		} else {
+			strings[i], err = decodeUTF16String(chunk[offset:])
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func decodeUTF8String(b []byte) (string, error) {
+	// The UTF-16 length comes first, which we don't need
+	_, n := decodeLength8(b)
+	if n == 0 {
+		return "", errInvalidChunk
+	}
+	b = b[n:]
+
+	length, n := decodeLength8(b)
+	if n == 0 || n+length > len(b) {
+		return "", errInvalidChunk
+	}
+
+	return string(b[n : n+length]), nil
+}
+
+func decodeLength8(b []byte) (length int, n int) {
+	if len(b) < 1 {
+		return 0, 0
+	}
+	if b[0]&0x80 == 0 {
+		return int(b[0]), 1
+	}
+	if len(b) < 2 {
+		return 0, 0
+	}
+	return int(b[0]&0x7f)<<8 | int(b[1]), 2
+}
+
+func decodeUTF16String(b []byte) (string, error) {
+	if len(b) < 2 {
+		return "", errInvalidChunk
+	}
+
+	length, n := int(binary.LittleEndian.Uint16(b)), 2
+	if length&0x8000 != 0 {
+		if len(b) < 4 {
+			return "", errInvalidChunk
+		}
+		length = (length&0x7fff)<<16 | int(binary.LittleEndian.Uint16(b[2:]))
+		n = 4
+	}
+
+	if n+2*length > len(b) {
+		return "", errInvalidChunk
+	}
+
+	var units = make([]uint16, length)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[n+2*i:])
+	}
+
+	return string(utf16.Decode(units)), nil
+}
+
+// xmlAttribute is an attribute of an element in a binary XML document
+type xmlAttribute struct {
+	name  string
+	resID uint32
+
+	// raw is the original string value, which is only set for some attributes
+	raw      string
+	dataType uint8
+	data     uint32
+}
+
+// String returns a string representation of the value
+func (a xmlAttribute) String() string {
+	switch a.dataType {
+	case typeString:
+		return a.raw
+	case typeIntDec:
+		return strconv.FormatInt(int64(int32(a.data)), 10)
+	case typeIntHex:
+		return fmt.Sprintf("0x%x", a.data)
+	case typeBoolean:
+		return strconv.FormatBool(a.data != 0)
+	case typeReference:
+		return fmt.Sprintf("@0x%08x", a.data)
+	}
+
+	if a.raw != "" {
+		return a.raw
+	}
+
+	return strconv.FormatUint(uint64(a.data), 10)
+}
+
+// Int returns the value as integer. String values are parsed, which some build tools produce
+func (a xmlAttribute) Int() (int, bool) {
+	switch a.dataType {
+	case typeIntDec, typeIntHex:
+		return int(int32(a.data)), true
+	case typeString:
+		i, err := strconv.Atoi(a.raw)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// xmlElement is a start tag in a binary XML document
+type xmlElement struct {
+	name string
+	// path are the names of the element and all its parents, e.g. ["manifest", "application"]
+	path  []string
+	attrs []xmlAttribute
+}
+
+// attr returns the attribute with the given android resource ID, or with the given name
+// if the document doesn't contain resource IDs for the attribute
+func (e xmlElement) attr(resID uint32, name string) (xmlAttribute, bool) {
+	for _, a := range e.attrs {
+		if a.resID == resID {
+			return a, true
+		}
+	}
+	for _, a := range e.attrs {
+		if a.resID == 0 && a.name == name {
+			return a, true
+		}
+	}
+	return xmlAttribute{}, false
+}
+
+// parseBinaryXML returns all elements of a binary XML document like the AndroidManifest.xml of an APK
+func parseBinaryXML(b []byte) (elements []xmlElement, err error) {
+	h, err := readChunkHeader(b)
+	if err != nil {
+		return
+	}
+	if h.typ != chunkXML {
+		return nil, fmt.Errorf("not a binary XML document (chunk type 0x%04x)", h.typ)
+	}
+
+	var (
+		strings []string
+		resIDs  []uint32
+		path    []string
+	)
+
+	for offset := int(h.headerSize); offset < int(h.size); {
+		ch, err := readChunkHeader(b[offset:])
+		if err != nil {
+			return nil, err
+		}
+		chunk := b[offset : offset+int(ch.size)]
+
+		switch ch.typ {
+		case chunkStringPool:
+			strings, err = parseStringPool(chunk)
+			if err != nil {
+				return nil, err
+			}
+		case chunkXMLResMap:
+			for i := int(ch.headerSize); i+4 <= len(chunk); i += 4 {
+				resIDs = append(resIDs, binary.LittleEndian.Uint32(chunk[i:]))
+			}
+		case chunkXMLStartElem:
+			elem, err := parseStartElement(chunk, int(ch.headerSize), strings, resIDs)
+			if err != nil {
+				return nil, err
+			}
+
+			path = append(path, elem.name)
+			elem.path = append([]string(nil), path...)
+			elements = append(elements, elem)
+		case chunkXMLEndElem:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+
+		offset += int(ch.size)
+	}
+
+	return
+}
+
+func parseStartElement(chunk []byte, headerSize int, strings []string, resIDs []uint32) (e xmlElement, err error) {
+	if headerSize+20 > len(chunk) {
+		return e, errInvalidChunk
+	}
+
+	ext := chunk[headerSize:]
+
+	var (
+		name      = binary.LittleEndian.Uint32(ext[4:])
+		attrStart = int(binary.LittleEndian.Uint16(ext[8:]))
+		attrSize  = int(binary.LittleEndian.Uint16(ext[10:]))
+		attrCount = int(binary.LittleEndian.Uint16(ext[12:]))
+	)
+
+	e.name = stringAt(strings, name)
+
+	if attrSize < 20 || attrStart+attrCount*attrSize > len(ext) {
+		return e, errInvalidChunk
+	}
+
+	for i := 0; i < attrCount; i++ {
+		a := ext[attrStart+i*attrSize:]
+
+		nameIdx := binary.LittleEndian.Uint32(a[4:])
+
+		attr := xmlAttribute{
+			name:     stringAt(strings, nameIdx),
+			raw:      stringAt(strings, binary.LittleEndian.Uint32(a[8:])),
+			dataType: a[15],
+			data:     binary.LittleEndian.Uint32(a[16:]),
+		}
+		if int(nameIdx) < len(resIDs) {
+			attr.resID = resIDs[nameIdx]
+		}
+		if attr.dataType == typeString && attr.raw == "" {
+			attr.raw = stringAt(strings, attr.data)
+		}
+
+		e.attrs = append(e.attrs, attr)
+	}
+
+	return
+}
+
+func stringAt(strings []string, idx uint32) string {
+	if int(idx) < len(strings) && idx != 0xffffffff {
+		return strings[idx]
+	}
+	return ""
+}
@@ -0,0 +1,937 @@
+package index
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"metascoop/apps"
+)
+
+// iconDensities are the densities F-Droid clients request icons for, each has its own icons-<density> directory
+var iconDensities = []int{120, 160, 240, 320, 480, 640}
+
+// screenshotTypes maps the directory names of screenshots in metadata to their key in index-v2.json
+var screenshotTypes = []struct {
+	dir, v2Key string
+}{
+	{"phoneScreenshots", "phone"},
+	{"sevenInchScreenshots", "sevenInch"},
+	{"tenInchScreenshots", "tenInch"},
+	{"tvScreenshots", "tv"},
+	{"wearScreenshots", "wear"},
+}
+
+// section is either the repo or the archive with the APKs that belong to it
+type section struct {
+	dir         string
+	address     string
+	name        string
+	icon        string
+	description string
+	apks        map[string][]*APK
+}
+
+// app is an app with its metadata
+type app struct {
+	packageName string
+	meta        *apps.Metadata
+}
+
+// Native builds the index in Go and signs it with the repo key, without needing fdroidserver
+type Native struct{}
+
+// Build generates the index files of the F-Droid repo in fdroidDir and signs them with the repo key,
+// which is what "fdroid update" does. The APKs must already be in the repo directory
+func (Native) Build(ctx context.Context, fdroidDir string, opts Options) (err error) {
+	config, err := ReadConfig(fdroidDir)
+	if err != nil {
+		return
+	}
+
+	key, err := ReadKeystore(config.Keystore, config.KeystorePass, config.KeyPass, config.RepoKeyAlias)
+	if err != nil {
+		return
+	}
+	log.Printf("Creating signed index with this key (SHA256): %s", strings.ToUpper(key.Fingerprint()))
+
+	var (
+		repoDir     = filepath.Join(fdroidDir, "repo")
+		archiveDir  = filepath.Join(fdroidDir, "archive")
+		metadataDir = filepath.Join(fdroidDir, "metadata")
+	)
+
+	// The first time we saw an APK is taken from the previous index, so it doesn't change on every run
+	added := make(map[string]int64)
+	for _, dir := range []string{repoDir, archiveDir} {
+		readAddedTimes(filepath.Join(dir, "index-v1.json"), added)
+	}
+
+	var allAPKs = make(map[string][]*APK)
+	for _, dir := range []string{repoDir, archiveDir} {
+		err = scanAPKs(ctx, dir, allAPKs)
+		if err != nil {
+			return
+		}
+	}
+
+	knownApps, err := loadApps(allAPKs, metadataDir, opts)
+	if err != nil {
+		return
+	}
+
+	repo := section{
+		dir:         repoDir,
+		address:     config.RepoURL,
+		name:        config.RepoName,
+		icon:        config.RepoIcon,
+		description: config.RepoDescription,
+		apks:        make(map[string][]*APK),
+	}
+	archive := section{
+		dir:         archiveDir,
+		address:     config.ArchiveURL,
+		name:        config.ArchiveName,
+		icon:        config.ArchiveIcon,
+		description: config.ArchiveDescription,
+		apks:        make(map[string][]*APK),
+	}
+
+	for pkg := range knownApps {
+		apks := allAPKs[pkg]
+		sortNewestFirst(apks)
+
+		for i, apk := range apks {
+			target := &repo
+			if config.ArchiveOlder > 0 && i >= config.ArchiveOlder {
+				target = &archive
+			} else if config.ArchiveOlder == 0 && apkDir(apk) == archiveDir {
+				// Without an archive, APKs that were archived before stay where they are
+				target = &archive
+			}
+
+			err = moveAPK(apk, target.dir)
+			if err != nil {
+				return
+			}
+
+			if t, ok := added[apk.FileName]; ok {
+				apk.added = t
+			} else {
+				apk.added = indexTime(time.Now())
+			}
+
+			target.apks[pkg] = append(target.apks[pkg], apk)
+		}
+	}
+
+	timestamp := indexTime(time.Now())
+
+	err = repo.write(knownApps, metadataDir, key, config.RepoKeyAlias, timestamp)
+	if err != nil {
+		return
+	}
+
+	if config.ArchiveOlder > 0 || len(archive.apks) > 0 {
+		err = archive.write(knownApps, metadataDir, key, config.RepoKeyAlias, timestamp)
+	}
+
+	return
+}
+
+// loadApps reads the metadata of all apps that have APKs. Apps without metadata are skipped, or handled
+// as set in the options
+func loadApps(allAPKs map[string][]*APK, metadataDir string, opts Options) (knownApps map[string]app, err error) {
+	knownApps = make(map[string]app)
+
+	for pkg, apks := range allAPKs {
+		metaPath := filepath.Join(metadataDir, pkg+".yml")
+
+		meta, err := apps.ReadMetaFile(metaPath)
+		if errors.Is(err, os.ErrNotExist) {
+			switch {
+			case opts.CreateMetadata:
+				meta, err = createMetadata(metaPath, newestAPK(apks))
+			case opts.DeleteUnknown:
+				err = deleteAPKs(apks)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			default:
+				log.Printf("Skipping %s, it has no metadata file", pkg)
+				continue
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading metadata of %s: %w", pkg, err)
+		}
+
+		if meta.Disabled != "" {
+			log.Printf("Skipping %s, it is disabled: %s", pkg, meta.Disabled)
+			continue
+		}
+
+		knownApps[pkg] = app{packageName: pkg, meta: meta}
+	}
+
+	return
+}
+
+func readAddedTimes(indexPath string, added map[string]int64) {
+	index, err := apps.ReadIndex(indexPath)
+	if err != nil {
+		return
+	}
+
+	for _, pkgs := range index.Packages {
+		for _, p := range pkgs {
+			added[p.ApkName] = p.Added
+		}
+	}
+}
+
+func scanAPKs(ctx context.Context, dir string, apks map[string][]*APK) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.apk"))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		apk, err := ParseAPK(f)
+		if err != nil {
+			log.Printf("Skipping %q, it cannot be parsed: %s", f, err.Error())
+			continue
+		}
+
+		apks[apk.PackageName] = append(apks[apk.PackageName], apk)
+	}
+
+	return nil
+}
+
+func sortNewestFirst(apks []*APK) {
+	sort.SliceStable(apks, func(i, j int) bool {
+		if apks[i].VersionCode != apks[j].VersionCode {
+			return apks[i].VersionCode > apks[j].VersionCode
+		}
+		return apks[i].FileName < apks[j].FileName
+	})
+}
+
+func newestAPK(apks []*APK) *APK {
+	sortNewestFirst(apks)
+	return apks[0]
+}
+
+func apkDir(apk *APK) string {
+	return filepath.Dir(apk.path)
+}
+
+func moveAPK(apk *APK, dir string) (err error) {
+	if apkDir(apk) == dir {
+		return nil
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return
+	}
+
+	target := filepath.Join(dir, apk.FileName)
+	log.Printf("Moving %q to %q", apk.path, target)
+
+	err = os.Rename(apk.path, target)
+	if err != nil {
+		return
+	}
+	apk.path = target
+
+	return
+}
+
+func deleteAPKs(apks []*APK) error {
+	for _, apk := range apks {
+		log.Printf("Deleting %q, there is no metadata file for %s", apk.path, apk.PackageName)
+
+		err := os.Remove(apk.path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createMetadata writes a metadata stub for an app, like "fdroid update --create-metadata" does
+func createMetadata(metaPath string, apk *APK) (meta *apps.Metadata, err error) {
+	log.Printf("Creating metadata file %q", metaPath)
+
+	err = os.MkdirAll(filepath.Dir(metaPath), 0o755)
+	if err != nil {
+		return
+	}
+
+	meta = &apps.Metadata{
+		License:            "Unknown",
+		Name:               apk.Label,
+		CurrentVersion:     apk.VersionName,
+		CurrentVersionCode: apk.VersionCode,
+	}
+
+	err = apps.WriteMetaFile(metaPath, meta)
+
+	return
+}
+
+// write copies icons and screenshots into the section directory and writes the index files,
+// which are signed if key is set
+func (s *section) write(knownApps map[string]app, metadataDir string, key *Key, alias string, timestamp int64) (err error) {
+	err = os.MkdirAll(s.dir, 0o755)
+	if err != nil {
+		return
+	}
+
+	v1 := indexV1{
+		Repo: repoV1{
+			Timestamp:   timestamp,
+			Version:     formatVersion,
+			Name:        s.name,
+			Icon:        s.icon,
+			Address:     s.address,
+			Description: s.description,
+		},
+		Requests: requestsV1{Install: []string{}, Uninstall: []string{}},
+		Apps:     []appV1{},
+		Packages: make(map[string][]packageV1),
+	}
+
+	v2 := indexV2{
+		Repo: repoV2{
+			Name:      localizedText{apps.DefaultLocale: s.name},
+			Address:   s.address,
+			Timestamp: timestamp,
+		},
+		Packages: make(map[string]packageV2),
+	}
+	if s.description != "" {
+		v2.Repo.Description = localizedText{apps.DefaultLocale: s.description}
+	}
+	if icon, err := repoFile(s.dir, filepath.Join("icons", s.icon)); err == nil {
+		v2.Repo.Icon = map[string]fileV2{apps.DefaultLocale: icon}
+	}
+
+	var packageNames []string
+	for pkg := range s.apks {
+		packageNames = append(packageNames, pkg)
+	}
+	sort.Strings(packageNames)
+
+	for _, pkg := range packageNames {
+		var (
+			apks = s.apks[pkg]
+			a    = knownApps[pkg]
+		)
+
+		appV1, pkgV2, pkgsV1, err := s.app(a, apks, metadataDir)
+		if err != nil {
+			return fmt.Errorf("indexing %s: %w", pkg, err)
+		}
+
+		v1.Apps = append(v1.Apps, appV1)
+		v1.Packages[pkg] = pkgsV1
+		v2.Packages[pkg] = pkgV2
+	}
+
+	v1Path := filepath.Join(s.dir, "index-v1.json")
+	_, err = writeJSON(v1Path, v1)
+	if err != nil {
+		return
+	}
+
+	if key != nil {
+		err = WriteSignedJar(filepath.Join(s.dir, "index-v1.jar"), v1Path, key, alias)
+		if err != nil {
+			return
+		}
+	}
+
+	// Old clients only read the index.xml in index.jar
+	var pubkey string
+	if key != nil {
+		pubkey = hex.EncodeToString(key.Certificate.Raw)
+	}
+	xmlPath := filepath.Join(s.dir, "index.xml")
+	err = writeFileAtomic(xmlPath, indexXML(v1, pubkey))
+	if err != nil {
+		return
+	}
+
+	if key != nil {
+		err = WriteSignedJar(filepath.Join(s.dir, "index.jar"), xmlPath, key, alias)
+		if err != nil {
+			return
+		}
+	}
+
+	// Clients that have the previous index only download the diff to the new one
+	v2Path := filepath.Join(s.dir, "index-v2.json")
+	previous, _ := os.ReadFile(v2Path)
+
+	v2File, err := writeJSON(v2Path, v2)
+	if err != nil {
+		return
+	}
+
+	diffs := map[string]entryFile{}
+	if previous != nil {
+		current, err := os.ReadFile(v2Path)
+		if err != nil {
+			return err
+		}
+
+		diffs, err = writeDiffs(s.dir, previous, current)
+		if err != nil {
+			// Clients download the whole index then
+			log.Printf("Writing diff to the previous index in %q: %s", s.dir, err.Error())
+			diffs = map[string]entryFile{}
+		}
+	}
+
+	entryPath := filepath.Join(s.dir, "entry.json")
+	_, err = writeJSON(entryPath, entry{
+		Timestamp: timestamp,
+		Version:   formatVersion,
+		Index: entryFile{
+			fileV2:      v2File,
+			NumPackages: len(v2.Packages),
+		},
+		Diffs: diffs,
+	})
+	if err != nil {
+		return
+	}
+
+	if key != nil {
+		err = WriteSignedJar(filepath.Join(s.dir, "entry.jar"), entryPath, key, alias)
+		if err != nil {
+			return
+		}
+	}
+
+	log.Printf("Wrote index of %s with %d apps to %q", s.name, len(v2.Packages), s.dir)
+
+	return
+}
+
+// app builds the index entries of an app from its metadata and APKs, which must be sorted newest first
+func (s *section) app(a app, apks []*APK, metadataDir string) (v1 appV1, v2 packageV2, packages []packageV1, err error) {
+	meta := a.meta
+
+	// The suggested version is the one from the metadata if we have it, else the newest one
+	suggested := apks[0]
+	for _, apk := range apks {
+		if meta.CurrentVersionCode != 0 && apk.VersionCode == meta.CurrentVersionCode {
+			suggested = apk
+			break
+		}
+	}
+
+	var firstAdded, lastUpdated int64
+	for _, apk := range apks {
+		if firstAdded == 0 || apk.added < firstAdded {
+			firstAdded = apk.added
+		}
+		if apk.added > lastUpdated {
+			lastUpdated = apk.added
+		}
+	}
+
+	name := meta.Name
+	if name == "" {
+		name = meta.AutoName
+	}
+	if name == "" {
+		name = suggested.Label
+	}
+
+	v1 = appV1{
+		AntiFeatures:         meta.AntiFeatures.Names,
+		AuthorEmail:          meta.AuthorEmail,
+		AuthorName:           meta.AuthorName,
+		AuthorWebSite:        meta.AuthorWebSite,
+		Bitcoin:              meta.Bitcoin,
+		Categories:           meta.Categories,
+		Changelog:            meta.Changelog,
+		Donate:               meta.Donate,
+		IssueTracker:         meta.IssueTracker,
+		Liberapay:            meta.Liberapay,
+		Litecoin:             meta.Litecoin,
+		OpenCollective:       meta.OpenCollective,
+		SuggestedVersionName: suggested.VersionName,
+		SuggestedVersionCode: strconv.Itoa(suggested.VersionCode),
+		Translation:          meta.Translation,
+		Description:          meta.Description,
+		License:              meta.License,
+		Name:                 name,
+		SourceCode:           meta.SourceCode,
+		Summary:              meta.Summary,
+		WebSite:              meta.WebSite,
+		Added:                firstAdded,
+		PackageName:          a.packageName,
+		LastUpdated:          lastUpdated,
+	}
+
+	v2 = packageV2{
+		Metadata: metadataV2{
+			Added:           firstAdded,
+			Categories:      meta.Categories,
+			Changelog:       meta.Changelog,
+			IssueTracker:    meta.IssueTracker,
+			LastUpdated:     lastUpdated,
+			License:         meta.License,
+			SourceCode:      meta.SourceCode,
+			Translation:     meta.Translation,
+			WebSite:         meta.WebSite,
+			AuthorEmail:     meta.AuthorEmail,
+			AuthorName:      meta.AuthorName,
+			AuthorWebSite:   meta.AuthorWebSite,
+			Bitcoin:         meta.Bitcoin,
+			Liberapay:       meta.Liberapay,
+			Litecoin:        meta.Litecoin,
+			OpenCollective:  meta.OpenCollective,
+			Name:            optionalText(name),
+			Summary:         optionalText(meta.Summary),
+			Description:     optionalText(meta.Description),
+			PreferredSigner: suggested.Signer,
+		},
+		Versions: make(map[string]versionV2),
+	}
+	if meta.Donate != "" {
+		v2.Metadata.Donate = []string{meta.Donate}
+	}
+
+	// Icons
+	for _, apk := range apks {
+		err = s.writeIcons(apk)
+		if err != nil {
+			return
+		}
+	}
+
+	iconName := iconFileName(suggested)
+	if icon, err := repoFile(s.dir, filepath.Join("icons", iconName)); err == nil {
+		v1.Icon = iconName
+		v2.Metadata.Icon = map[string]fileV2{apps.DefaultLocale: icon}
+	}
+
+	// Localized screenshots and changelogs
+	locales, err := readLocalized(filepath.Join(metadataDir, a.packageName))
+	if err != nil {
+		return
+	}
+
+	for _, l := range locales {
+		var loc localized
+
+		for _, st := range screenshotTypes {
+			names, err := copyScreenshots(filepath.Join(metadataDir, a.packageName, l, st.dir), filepath.Join(s.dir, a.packageName, l, st.dir))
+			if err != nil {
+				return v1, v2, nil, err
+			}
+			if len(names) == 0 {
+				continue
+			}
+
+			switch st.dir {
+			case "phoneScreenshots":
+				loc.PhoneScreenshots = names
+			case "sevenInchScreenshots":
+				loc.SevenInchScreenshots = names
+			case "tenInchScreenshots":
+				loc.TenInchScreenshots = names
+			case "tvScreenshots":
+				loc.TvScreenshots = names
+			case "wearScreenshots":
+				loc.WearScreenshots = names
+			}
+
+			for _, n := range names {
+				f, err := repoFile(s.dir, filepath.Join(a.packageName, l, st.dir, n))
+				if err != nil {
+					return v1, v2, nil, err
+				}
+
+				if v2.Metadata.Screenshots == nil {
+					v2.Metadata.Screenshots = make(map[string]map[string][]fileV2)
+				}
+				if v2.Metadata.Screenshots[st.v2Key] == nil {
+					v2.Metadata.Screenshots[st.v2Key] = make(map[string][]fileV2)
+				}
+				v2.Metadata.Screenshots[st.v2Key][l] = append(v2.Metadata.Screenshots[st.v2Key][l], f)
+			}
+		}
+
+		loc.WhatsNew = readChangelog(metadataDir, a.packageName, l, suggested.VersionCode)
+
+		if !isEmptyLocalized(loc) {
+			if v1.Localized == nil {
+				v1.Localized = make(map[string]localized)
+			}
+			v1.Localized[l] = loc
+		}
+	}
+
+	// Versions
+	for _, apk := range apks {
+		packages = append(packages, apk.packageV1())
+
+		version := apk.versionV2()
+		for _, af := range meta.AntiFeatures.Names {
+			if version.AntiFeatures == nil {
+				version.AntiFeatures = make(map[string]map[string]interface{})
+			}
+			reasons := make(map[string]interface{})
+			for locale, reason := range meta.AntiFeatures.Reasons[af] {
+				reasons[locale] = reason
+			}
+			version.AntiFeatures[af] = reasons
+		}
+		for _, l := range locales {
+			if changelog := readChangelog(metadataDir, a.packageName, l, apk.VersionCode); changelog != "" {
+				if version.WhatsNew == nil {
+					version.WhatsNew = make(localizedText)
+				}
+				version.WhatsNew[l] = changelog
+			}
+		}
+
+		v2.Versions[apk.Hash] = version
+	}
+
+	return
+}
+
+func (apk *APK) packageV1() packageV1 {
+	p := packageV1{
+		Added:            apk.added,
+		ApkName:          apk.FileName,
+		Features:         apk.Features,
+		Hash:             apk.Hash,
+		HashType:         "sha256",
+		MaxSdkVersion:    apk.MaxSdkVersion,
+		MinSdkVersion:    apk.MinSdkVersion,
+		NativeCode:       apk.NativeCode,
+		PackageName:      apk.PackageName,
+		Sig:              apk.Sig,
+		Signer:           apk.Signer,
+		Size:             apk.Size,
+		TargetSdkVersion: apk.TargetSdkVersion,
+		VersionCode:      apk.VersionCode,
+		VersionName:      apk.VersionName,
+	}
+
+	// Permissions are pairs of the name and the max SDK version, which is null if there's none
+	permissionPairs := func(perms []Permission) (pairs [][]interface{}) {
+		for _, perm := range perms {
+			var maxSdk interface{}
+			if perm.MaxSdkVersion != 0 {
+				maxSdk = perm.MaxSdkVersion
+			}
+			pairs = append(pairs, []interface{}{perm.Name, maxSdk})
+		}
+		return
+	}
+	p.UsesPermission = permissionPairs(apk.Permissions)
+	p.UsesPermissionSdk23 = permissionPairs(apk.PermissionsSdk23)
+
+	return p
+}
+
+func (apk *APK) versionV2() versionV2 {
+	v := versionV2{
+		Added: apk.added,
+		File: fileV2{
+			Name:   "/" + apk.FileName,
+			SHA256: apk.Hash,
+			Size:   apk.Size,
+		},
+		Manifest: manifestV2{
+			VersionName: apk.VersionName,
+			VersionCode: apk.VersionCode,
+			UsesSdk: usesSdkV2{
+				MinSdkVersion:    apk.MinSdkVersion,
+				TargetSdkVersion: apk.TargetSdkVersion,
+			},
+			MaxSdkVersion: apk.MaxSdkVersion,
+			Signer:        signerV2{SHA256: []string{apk.Signer}},
+			NativeCode:    apk.NativeCode,
+		},
+	}
+
+	for _, perm := range apk.Permissions {
+		v.Manifest.UsesPermission = append(v.Manifest.UsesPermission, permissionV2(perm))
+	}
+	for _, perm := range apk.PermissionsSdk23 {
+		v.Manifest.UsesPermissionSdk23 = append(v.Manifest.UsesPermissionSdk23, permissionV2(perm))
+	}
+	for _, f := range apk.Features {
+		v.Manifest.Features = append(v.Manifest.Features, featureV2{Name: f})
+	}
+
+	return v
+}
+
+func iconFileName(apk *APK) string {
+	return fmt.Sprintf("%s.%d.png", apk.PackageName, apk.VersionCode)
+}
+
+// writeIcons extracts the launcher icon of an APK into the icons-<density> directories
+// and the largest one into the icons directory. Existing icons are kept
+func (s *section) writeIcons(apk *APK) (err error) {
+	if len(apk.icons) == 0 {
+		return nil
+	}
+
+	var (
+		name    = iconFileName(apk)
+		targets = map[string]int{"icons": iconDensities[len(iconDensities)-1]}
+	)
+	for _, d := range iconDensities {
+		targets[fmt.Sprintf("icons-%d", d)] = d
+	}
+
+	var zr *zip.ReadCloser
+	defer func() {
+		if zr != nil {
+			zr.Close()
+		}
+	}()
+
+	for dir, density := range targets {
+		iconPath := filepath.Join(s.dir, dir, name)
+		if _, err := os.Stat(iconPath); err == nil {
+			continue
+		}
+
+		src, ok := apk.iconFor(density)
+		if !ok {
+			continue
+		}
+
+		if zr == nil {
+			zr, err = zip.OpenReader(apk.path)
+			if err != nil {
+				return
+			}
+		}
+
+		err = extractFile(&zr.Reader, src, iconPath)
+		if err != nil {
+			return fmt.Errorf("extracting icon %q from %q: %w", src, apk.path, err)
+		}
+	}
+
+	return
+}
+
+func extractFile(zr *zip.Reader, name, target string) (err error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+
+		content, err := readZipFile(f)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(filepath.Dir(target), 0o755)
+		if err != nil {
+			return err
+		}
+
+		return writeFileAtomic(target, content)
+	}
+
+	return fmt.Errorf("%q not found", name)
+}
+
+// readLocalized returns the locales that have a directory in the metadata directory of an app
+func readLocalized(appMetadataDir string) (locales []string, err error) {
+	entries, err := os.ReadDir(appMetadataDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			locales = append(locales, e.Name())
+		}
+	}
+
+	return
+}
+
+// indexTime converts t to milliseconds for the index. fdroid keeps whole seconds, so we do too
+func indexTime(t time.Time) int64 {
+	return t.Truncate(time.Second).UnixMilli()
+}
+
+func readChangelog(metadataDir, pkg, locale string, versionCode int) string {
+	content, err := os.ReadFile(apps.ChangelogPath(metadataDir, pkg, locale, versionCode))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func isScreenshotFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".webp":
+		return true
+	}
+	return false
+}
+
+// copyScreenshots copies the screenshots from src to dst and removes screenshots from dst that are
+// no longer in src. It returns the sorted names of all screenshots
+func copyScreenshots(src, dst string) (names []string, err error) {
+	entries, err := os.ReadDir(src)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	var keep = make(map[string]bool)
+	for _, e := range entries {
+		if e.IsDir() || !isScreenshotFile(e.Name()) {
+			continue
+		}
+
+		err = copyFileIfChanged(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name()))
+		if err != nil {
+			return
+		}
+
+		keep[e.Name()] = true
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	existing, err := os.ReadDir(dst)
+	if errors.Is(err, os.ErrNotExist) {
+		return names, nil
+	}
+	if err != nil {
+		return
+	}
+	for _, e := range existing {
+		if !e.IsDir() && !keep[e.Name()] {
+			err = os.Remove(filepath.Join(dst, e.Name()))
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func copyFileIfChanged(src, dst string) (err error) {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return
+	}
+
+	if existing, err := os.ReadFile(dst); err == nil && bytes.Equal(existing, content) {
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(dst), 0o755)
+	if err != nil {
+		return
+	}
+
+	return writeFileAtomic(dst, content)
+}
+
+// repoFile describes a file in the repo directory for index-v2.json
+func repoFile(repoDir, relPath string) (f fileV2, err error) {
+	file, err := os.Open(filepath.Join(repoDir, relPath))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return
+	}
+
+	return fileV2{
+		Name:   "/" + filepath.ToSlash(relPath),
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+		Size:   size,
+	}, nil
+}
+
+// writeJSON writes v as indented JSON and returns the description of the written file
+func writeJSON(path string, v interface{}) (f fileV2, err error) {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	err = enc.Encode(v)
+	if err != nil {
+		return
+	}
+
+	content := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+
+	err = writeFileAtomic(path, content)
+	if err != nil {
+		return
+	}
+
+	sum := sha256.Sum256(content)
+
+	return fileV2{
+		Name:   "/" + filepath.Base(path),
+		SHA256: hex.EncodeToString(sum[:]),
+		Size:   int64(len(content)),
+	}, nil
+}
+
+func optionalText(s string) localizedText {
+	if s == "" {
+		return nil
+	}
+	return localizedText{apps.DefaultLocale: s}
+}
+
+func isEmptyLocalized(l localized) bool {
+	return len(l.PhoneScreenshots) == 0 && len(l.SevenInchScreenshots) == 0 && len(l.TenInchScreenshots) == 0 &&
+		len(l.TvScreenshots) == 0 && len(l.WearScreenshots) == 0 && l.WhatsNew == ""
+}
@@ -0,0 +1,104 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Options configure how the index is built
+type Options struct {
+	// CreateMetadata creates metadata files for apps that don't have one yet
+	CreateMetadata bool
+	// DeleteUnknown removes APKs of apps that have no metadata file
+	DeleteUnknown bool
+}
+
+// Builder generates the index files of an F-Droid repo from the APKs and metadata in fdroidDir,
+// which is the directory that contains config.yml, repo and metadata
+type Builder interface {
+	Build(ctx context.Context, fdroidDir string, opts Options) error
+}
+
+// Fdroid builds the index by running "fdroid update" from fdroidserver
+type Fdroid struct {
+	// Binary is the fdroid executable, it is looked up in $PATH if it isn't a path. Defaults to "fdroid"
+	Binary string
+	// Args are passed to "fdroid update" after the arguments for the options
+	Args []string
+	// Timeout stops fdroid if it runs longer, 0 means no timeout
+	Timeout time.Duration
+}
+
+// maxStderrLength is how much of the end of the fdroid error output is included in errors
+const maxStderrLength = 4096
+
+func (f *Fdroid) Build(ctx context.Context, fdroidDir string, opts Options) (err error) {
+	binary := f.Binary
+	if binary == "" {
+		binary = "fdroid"
+	}
+
+	args := []string{"update", "--pretty"}
+	if opts.CreateMetadata {
+		args = append(args, "--create-metadata")
+	}
+	if opts.DeleteUnknown {
+		args = append(args, "--delete-unknown")
+	}
+	args = append(args, f.Args...)
+
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+
+	var stderr tailBuffer
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	cmd.Dir = fdroidDir
+
+	log.Printf("Running %q in %s", cmd.String(), cmd.Dir)
+
+	err = cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() == context.DeadlineExceeded && f.Timeout > 0 {
+		err = fmt.Errorf("timed out after %s", f.Timeout)
+	}
+	if stderr.Len() > 0 {
+		return fmt.Errorf("running %q: %w, error output:\n%s", cmd.String(), err, stderr.String())
+	}
+	return fmt.Errorf("running %q: %w", cmd.String(), err)
+}
+
+// tailBuffer keeps the last maxStderrLength bytes written to it
+type tailBuffer struct {
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > maxStderrLength {
+		t.buf = t.buf[len(t.buf)-maxStderrLength:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) Len() int {
+	return len(t.buf)
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.buf)
+}
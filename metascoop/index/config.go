@@ -0,0 +1,133 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config contains the settings from the config.yml file of an F-Droid repo that are needed to build the index
+type Config struct {
+	RepoURL         string
+	RepoName        string
+	RepoIcon        string
+	RepoDescription string
+
+	ArchiveURL         string
+	ArchiveName        string
+	ArchiveIcon        string
+	ArchiveDescription string
+	// ArchiveOlder is the number of versions per app that are kept in the repo, older ones are moved
+	// to the archive. 0 disables the archive
+	ArchiveOlder int
+
+	Keystore     string
+	KeystorePass string
+	KeyPass      string
+	RepoKeyAlias string
+}
+
+// configValue is a string in config.yml, which can also be read from an environment variable with {env: NAME}
+type configValue string
+
+func (v *configValue) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		var ref struct {
+			Env string `yaml:"env"`
+		}
+		err := node.Decode(&ref)
+		if err != nil {
+			return err
+		}
+
+		*v = configValue(os.Getenv(ref.Env))
+		return nil
+	}
+
+	var s string
+	err := node.Decode(&s)
+	*v = configValue(s)
+	return err
+}
+
+// ReadConfig reads the config.yml file in the given F-Droid directory and fills in the defaults
+// fdroidserver uses for values that aren't set
+func ReadConfig(fdroidDir string) (c *Config, err error) {
+	content, err := os.ReadFile(filepath.Join(fdroidDir, "config.yml"))
+	if err != nil {
+		return
+	}
+
+	var f struct {
+		RepoURL            configValue `yaml:"repo_url"`
+		RepoName           configValue `yaml:"repo_name"`
+		RepoIcon           configValue `yaml:"repo_icon"`
+		RepoDescription    configValue `yaml:"repo_description"`
+		ArchiveURL         configValue `yaml:"archive_url"`
+		ArchiveName        configValue `yaml:"archive_name"`
+		ArchiveIcon        configValue `yaml:"archive_icon"`
+		ArchiveDescription configValue `yaml:"archive_description"`
+		ArchiveOlder       *int        `yaml:"archive_older"`
+		Keystore           configValue `yaml:"keystore"`
+		KeystorePass       configValue `yaml:"keystorepass"`
+		KeyPass            configValue `yaml:"keypass"`
+		RepoKeyAlias       configValue `yaml:"repo_keyalias"`
+	}
+	err = yaml.Unmarshal(content, &f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config.yml: %w", err)
+	}
+
+	c = &Config{
+		RepoURL:            string(f.RepoURL),
+		RepoName:           string(f.RepoName),
+		RepoIcon:           string(f.RepoIcon),
+		RepoDescription:    string(f.RepoDescription),
+		ArchiveURL:         string(f.ArchiveURL),
+		ArchiveName:        string(f.ArchiveName),
+		ArchiveIcon:        string(f.ArchiveIcon),
+		ArchiveDescription: string(f.ArchiveDescription),
+		Keystore:           string(f.Keystore),
+		KeystorePass:       string(f.KeystorePass),
+		KeyPass:            string(f.KeyPass),
+		RepoKeyAlias:       string(f.RepoKeyAlias),
+	}
+
+	if c.RepoURL == "" {
+		return nil, errors.New("config.yml doesn't contain repo_url")
+	}
+	if c.RepoName == "" {
+		c.RepoName = "My First F-Droid Repo Demo"
+	}
+	if c.RepoIcon == "" {
+		c.RepoIcon = "icon.png"
+	}
+	c.ArchiveOlder = 3
+	if f.ArchiveOlder != nil {
+		c.ArchiveOlder = *f.ArchiveOlder
+	}
+	if c.ArchiveURL == "" {
+		c.ArchiveURL = strings.TrimSuffix(strings.TrimSuffix(c.RepoURL, "/"), "/repo") + "/archive"
+	}
+	if c.ArchiveName == "" {
+		c.ArchiveName = c.RepoName + " Archive"
+	}
+	if c.ArchiveIcon == "" {
+		c.ArchiveIcon = c.RepoIcon
+	}
+	if c.ArchiveDescription == "" {
+		c.ArchiveDescription = c.RepoDescription
+	}
+	if c.Keystore == "" {
+		c.Keystore = "keystore.p12"
+	}
+	if !filepath.IsAbs(c.Keystore) {
+		c.Keystore = filepath.Join(fdroidDir, c.Keystore)
+	}
+
+	return
+}
@@ -0,0 +1,216 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+)
+
+// jsonObject is a decoded JSON object that remembers the order of its keys
+type jsonObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+// decodeObject decodes b if it is a JSON object, ok is false for all other values
+func decodeObject(b json.RawMessage) (obj jsonObject, ok bool, err error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+
+	tok, err := dec.Token()
+	if err != nil {
+		return
+	}
+	if delim, isDelim := tok.(json.Delim); !isDelim || delim != '{' {
+		return obj, false, nil
+	}
+
+	obj.values = make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return
+		}
+		key, _ := tok.(string)
+
+		var value json.RawMessage
+		err = dec.Decode(&value)
+		if err != nil {
+			return
+		}
+
+		if _, seen := obj.values[key]; !seen {
+			obj.keys = append(obj.keys, key)
+		}
+		obj.values[key] = value
+	}
+
+	return obj, true, nil
+}
+
+func (obj jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+	for i, key := range obj.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(obj.values[key])
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// mergePatch returns the JSON merge patch (RFC 7386) that turns from into to, which is what the index
+// diffs of fdroidserver contain. changed is false if both are the same
+func mergePatch(from, to json.RawMessage) (patch json.RawMessage, changed bool, err error) {
+	fromObj, fromIsObj, err := decodeObject(from)
+	if err != nil {
+		return
+	}
+	toObj, toIsObj, err := decodeObject(to)
+	if err != nil {
+		return
+	}
+
+	if !fromIsObj || !toIsObj {
+		// Values are compared by content, the same value can be written with other escapes or key order
+		var fromValue, toValue interface{}
+		if err = json.Unmarshal(from, &fromValue); err != nil {
+			return
+		}
+		if err = json.Unmarshal(to, &toValue); err != nil {
+			return
+		}
+
+		if reflect.DeepEqual(fromValue, toValue) {
+			return nil, false, nil
+		}
+		return to, true, nil
+	}
+
+	diff := jsonObject{values: make(map[string]json.RawMessage)}
+	for _, key := range toObj.keys {
+		value := toObj.values[key]
+		if fromValue, ok := fromObj.values[key]; ok {
+			value, changed, err = mergePatch(fromValue, value)
+			if err != nil {
+				return
+			}
+			if !changed {
+				continue
+			}
+		}
+
+		diff.keys = append(diff.keys, key)
+		diff.values[key] = value
+	}
+	// Keys that were removed are set to null
+	for _, key := range fromObj.keys {
+		if _, ok := toObj.values[key]; !ok {
+			diff.keys = append(diff.keys, key)
+			diff.values[key] = json.RawMessage("null")
+		}
+	}
+
+	if len(diff.keys) == 0 {
+		return nil, false, nil
+	}
+
+	patch, err = diff.MarshalJSON()
+	return patch, true, err
+}
+
+// writeDiffs writes the changes from the previous index-v2.json to the current one into diff/<timestamp>.json,
+// where timestamp is the one of the previous index, so clients that have it only need to download the changes.
+// Diffs from older indexes don't lead to the current index, so they are removed. If the index didn't change,
+// the diffs listed in entry.json are still valid and returned as they are
+func writeDiffs(dir string, previous, current []byte) (diffs map[string]entryFile, err error) {
+	patch, changed, err := mergePatch(previous, current)
+	if err != nil {
+		return
+	}
+
+	diffs = make(map[string]entryFile)
+
+	if !changed {
+		var e entry
+		if content, err := os.ReadFile(filepath.Join(dir, "entry.json")); err == nil && json.Unmarshal(content, &e) == nil && e.Diffs != nil {
+			diffs = e.Diffs
+		}
+		return diffs, nil
+	}
+
+	var prev struct {
+		Repo struct {
+			Timestamp int64 `json:"timestamp"`
+		} `json:"repo"`
+	}
+	err = json.Unmarshal(previous, &prev)
+	if err != nil {
+		return nil, fmt.Errorf("reading previous index: %w", err)
+	}
+
+	var (
+		diffDir   = filepath.Join(dir, "diff")
+		timestamp = strconv.FormatInt(prev.Repo.Timestamp, 10)
+	)
+
+	old, err := filepath.Glob(filepath.Join(diffDir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, path := range old {
+		if filepath.Base(path) != timestamp+".json" {
+			err = os.Remove(path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return
+			}
+		}
+	}
+
+	var diff struct {
+		Packages map[string]json.RawMessage `json:"packages"`
+	}
+	err = json.Unmarshal(patch, &diff)
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	err = json.Indent(&buf, patch, "", "  ")
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(diffDir, 0o755)
+	if err != nil {
+		return
+	}
+
+	err = writeFileAtomic(filepath.Join(diffDir, timestamp+".json"), buf.Bytes())
+	if err != nil {
+		return
+	}
+
+	f, err := repoFile(dir, filepath.Join("diff", timestamp+".json"))
+	if err != nil {
+		return
+	}
+	diffs[timestamp] = entryFile{fileV2: f, NumPackages: len(diff.Packages)}
+
+	return
+}
@@ -0,0 +1,134 @@
+package index
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"metascoop/apps"
+)
+
+// Fake is a Builder for tests. It writes an unsigned index without parsing APKs: every APK in the repo
+// directory that is listed in Packages is indexed with the info from there, other APKs are ignored.
+// Metadata files are read, created and respected like with the other builders
+type Fake struct {
+	// Packages maps APK file names to the package info written to the index. Hash and size are
+	// taken from the file if they are empty
+	Packages map[string]apps.PackageInfo
+	// Timestamp is used for the repo and newly added APKs. Defaults to the current time
+	Timestamp time.Time
+	// Err is returned by Build instead of building the index
+	Err error
+
+	mu    sync.Mutex
+	calls []Options
+}
+
+func (f *Fake) Build(ctx context.Context, fdroidDir string, opts Options) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, opts)
+	if f.Err != nil {
+		return f.Err
+	}
+
+	timestamp := f.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	var (
+		repoDir     = filepath.Join(fdroidDir, "repo")
+		metadataDir = filepath.Join(fdroidDir, "metadata")
+		added       = make(map[string]int64)
+		allAPKs     = make(map[string][]*APK)
+	)
+	readAddedTimes(filepath.Join(repoDir, "index-v1.json"), added)
+
+	files, err := filepath.Glob(filepath.Join(repoDir, "*.apk"))
+	if err != nil {
+		return
+	}
+
+	for _, apkPath := range files {
+		info, ok := f.Packages[filepath.Base(apkPath)]
+		if !ok {
+			continue
+		}
+
+		apk, err := fakeAPK(apkPath, info)
+		if err != nil {
+			return err
+		}
+
+		apk.added = timestamp.UnixMilli()
+		if t, ok := added[apk.FileName]; ok {
+			apk.added = t
+		}
+
+		allAPKs[apk.PackageName] = append(allAPKs[apk.PackageName], apk)
+	}
+
+	knownApps, err := loadApps(allAPKs, metadataDir, opts)
+	if err != nil {
+		return
+	}
+
+	repo := section{
+		dir:     repoDir,
+		address: "https://example.com/fdroid/repo",
+		name:    "Fake Repo",
+		icon:    "icon.png",
+		apks:    make(map[string][]*APK),
+	}
+	for pkg := range knownApps {
+		sortNewestFirst(allAPKs[pkg])
+		repo.apks[pkg] = allAPKs[pkg]
+	}
+
+	return repo.write(knownApps, metadataDir, nil, "", timestamp.UnixMilli())
+}
+
+// Calls returns the options of all calls to Build
+func (f *Fake) Calls() []Options {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Options(nil), f.calls...)
+}
+
+func fakeAPK(apkPath string, info apps.PackageInfo) (apk *APK, err error) {
+	apk = &APK{
+		path:             apkPath,
+		FileName:         filepath.Base(apkPath),
+		Size:             int64(info.Size),
+		Hash:             info.Hash,
+		PackageName:      info.PackageName,
+		VersionCode:      info.VersionCode,
+		VersionName:      info.VersionName,
+		Label:            info.PackageName,
+		MinSdkVersion:    info.MinSdkVersion,
+		TargetSdkVersion: info.TargetSdkVersion,
+		NativeCode:       info.Nativecode,
+		Signer:           info.Signer,
+		Sig:              info.Sig,
+	}
+
+	if apk.Hash == "" || apk.Size == 0 {
+		content, err := os.ReadFile(apkPath)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(content)
+		apk.Hash = hex.EncodeToString(sum[:])
+		apk.Size = int64(len(content))
+	}
+
+	return
+}
@@ -0,0 +1,58 @@
+package index
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// signedIndexFiles are the signed index files in a repo directory, the newest format first
+var signedIndexFiles = []string{"entry.jar", "index-v1.jar"}
+
+// RepoFingerprint returns the SHA-256 fingerprint of the certificate the repo in repoDir is signed with, in
+// upper case like F-Droid shows it. It is read from the signed index, or from the keystore in config.yml if
+// the index wasn't built yet
+func RepoFingerprint(repoDir string) (fingerprint string, err error) {
+	for _, name := range signedIndexFiles {
+		cert, err := readJarCertificate(filepath.Join(repoDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("reading %q: %w", name, err)
+		}
+
+		return formatFingerprint(cert), nil
+	}
+
+	config, err := ReadConfig(filepath.Dir(repoDir))
+	if err != nil {
+		return
+	}
+
+	key, err := ReadKeystore(config.Keystore, config.KeystorePass, config.KeyPass, config.RepoKeyAlias)
+	if err != nil {
+		return
+	}
+
+	return formatFingerprint(key.Certificate.Raw), nil
+}
+
+func readJarCertificate(path string) (cert []byte, err error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return
+	}
+	defer zr.Close()
+
+	return jarCertificate(&zr.Reader)
+}
+
+func formatFingerprint(cert []byte) string {
+	sum := sha256.Sum256(cert)
+	return strings.ToUpper(fmt.Sprintf("%x", sum))
+}
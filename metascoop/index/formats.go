@@ -0,0 +1,191 @@
+package index
+
+// formatVersion is the index format version of fdroidserver that the generated files are compatible with
+const formatVersion = 20002
+
+// The structs in this file mirror the JSON that fdroidserver writes. Field order matters for
+// readable diffs of the generated files, so it follows the order fdroidserver uses
+
+type indexV1 struct {
+	Repo     repoV1                 `json:"repo"`
+	Requests requestsV1             `json:"requests"`
+	Apps     []appV1                `json:"apps"`
+	Packages map[string][]packageV1 `json:"packages"`
+}
+
+type repoV1 struct {
+	Timestamp   int64  `json:"timestamp"`
+	Version     int    `json:"version"`
+	Name        string `json:"name"`
+	Icon        string `json:"icon"`
+	Address     string `json:"address"`
+	Description string `json:"description"`
+}
+
+type requestsV1 struct {
+	Install   []string `json:"install"`
+	Uninstall []string `json:"uninstall"`
+}
+
+type appV1 struct {
+	AntiFeatures         []string             `json:"antiFeatures,omitempty"`
+	AuthorEmail          string               `json:"authorEmail,omitempty"`
+	AuthorName           string               `json:"authorName,omitempty"`
+	AuthorWebSite        string               `json:"authorWebSite,omitempty"`
+	Bitcoin              string               `json:"bitcoin,omitempty"`
+	Categories           []string             `json:"categories,omitempty"`
+	Changelog            string               `json:"changelog,omitempty"`
+	Donate               string               `json:"donate,omitempty"`
+	IssueTracker         string               `json:"issueTracker,omitempty"`
+	Liberapay            string               `json:"liberapay,omitempty"`
+	Litecoin             string               `json:"litecoin,omitempty"`
+	OpenCollective       string               `json:"openCollective,omitempty"`
+	SuggestedVersionName string               `json:"suggestedVersionName,omitempty"`
+	SuggestedVersionCode string               `json:"suggestedVersionCode,omitempty"`
+	Translation          string               `json:"translation,omitempty"`
+	Description          string               `json:"description,omitempty"`
+	License              string               `json:"license,omitempty"`
+	Name                 string               `json:"name,omitempty"`
+	SourceCode           string               `json:"sourceCode,omitempty"`
+	Summary              string               `json:"summary,omitempty"`
+	WebSite              string               `json:"webSite,omitempty"`
+	Added                int64                `json:"added"`
+	Icon                 string               `json:"icon,omitempty"`
+	PackageName          string               `json:"packageName"`
+	LastUpdated          int64                `json:"lastUpdated"`
+	Localized            map[string]localized `json:"localized,omitempty"`
+}
+
+type localized struct {
+	PhoneScreenshots     []string `json:"phoneScreenshots,omitempty"`
+	SevenInchScreenshots []string `json:"sevenInchScreenshots,omitempty"`
+	TenInchScreenshots   []string `json:"tenInchScreenshots,omitempty"`
+	TvScreenshots        []string `json:"tvScreenshots,omitempty"`
+	WearScreenshots      []string `json:"wearScreenshots,omitempty"`
+	WhatsNew             string   `json:"whatsNew,omitempty"`
+}
+
+// packageV1 has its keys in alphabetical order, like fdroidserver writes them
+type packageV1 struct {
+	Added               int64           `json:"added"`
+	ApkName             string          `json:"apkName"`
+	Features            []string        `json:"features,omitempty"`
+	Hash                string          `json:"hash"`
+	HashType            string          `json:"hashType"`
+	MaxSdkVersion       int             `json:"maxSdkVersion,omitempty"`
+	MinSdkVersion       int             `json:"minSdkVersion"`
+	NativeCode          []string        `json:"nativecode,omitempty"`
+	PackageName         string          `json:"packageName"`
+	Sig                 string          `json:"sig"`
+	Signer              string          `json:"signer"`
+	Size                int64           `json:"size"`
+	TargetSdkVersion    int             `json:"targetSdkVersion"`
+	UsesPermission      [][]interface{} `json:"uses-permission,omitempty"`
+	UsesPermissionSdk23 [][]interface{} `json:"uses-permission-sdk-23,omitempty"`
+	VersionCode         int             `json:"versionCode"`
+	VersionName         string          `json:"versionName"`
+}
+
+type indexV2 struct {
+	Repo     repoV2               `json:"repo"`
+	Packages map[string]packageV2 `json:"packages"`
+}
+
+// localizedText maps locales to texts
+type localizedText map[string]string
+
+// fileV2 is a file in the repo, name is its path relative to the repo directory with a leading slash
+type fileV2 struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+type repoV2 struct {
+	Name        localizedText     `json:"name"`
+	Description localizedText     `json:"description,omitempty"`
+	Icon        map[string]fileV2 `json:"icon,omitempty"`
+	Address     string            `json:"address"`
+	Timestamp   int64             `json:"timestamp"`
+}
+
+type packageV2 struct {
+	Metadata metadataV2           `json:"metadata"`
+	Versions map[string]versionV2 `json:"versions"`
+}
+
+type metadataV2 struct {
+	Added           int64                          `json:"added"`
+	Categories      []string                       `json:"categories,omitempty"`
+	Changelog       string                         `json:"changelog,omitempty"`
+	IssueTracker    string                         `json:"issueTracker,omitempty"`
+	LastUpdated     int64                          `json:"lastUpdated"`
+	License         string                         `json:"license,omitempty"`
+	SourceCode      string                         `json:"sourceCode,omitempty"`
+	Translation     string                         `json:"translation,omitempty"`
+	WebSite         string                         `json:"webSite,omitempty"`
+	Screenshots     map[string]map[string][]fileV2 `json:"screenshots,omitempty"`
+	AuthorEmail     string                         `json:"authorEmail,omitempty"`
+	AuthorName      string                         `json:"authorName,omitempty"`
+	AuthorWebSite   string                         `json:"authorWebSite,omitempty"`
+	Bitcoin         string                         `json:"bitcoin,omitempty"`
+	Donate          []string                       `json:"donate,omitempty"`
+	Liberapay       string                         `json:"liberapay,omitempty"`
+	Litecoin        string                         `json:"litecoin,omitempty"`
+	OpenCollective  string                         `json:"openCollective,omitempty"`
+	Name            localizedText                  `json:"name,omitempty"`
+	Summary         localizedText                  `json:"summary,omitempty"`
+	Description     localizedText                  `json:"description,omitempty"`
+	Icon            map[string]fileV2              `json:"icon,omitempty"`
+	PreferredSigner string                         `json:"preferredSigner,omitempty"`
+}
+
+type versionV2 struct {
+	Added        int64                             `json:"added"`
+	File         fileV2                            `json:"file"`
+	Manifest     manifestV2                        `json:"manifest"`
+	AntiFeatures map[string]map[string]interface{} `json:"antiFeatures,omitempty"`
+	WhatsNew     localizedText                     `json:"whatsNew,omitempty"`
+}
+
+type manifestV2 struct {
+	VersionName         string         `json:"versionName"`
+	VersionCode         int            `json:"versionCode"`
+	UsesSdk             usesSdkV2      `json:"usesSdk"`
+	MaxSdkVersion       int            `json:"maxSdkVersion,omitempty"`
+	Signer              signerV2       `json:"signer"`
+	UsesPermission      []permissionV2 `json:"usesPermission,omitempty"`
+	UsesPermissionSdk23 []permissionV2 `json:"usesPermissionSdk23,omitempty"`
+	NativeCode          []string       `json:"nativecode,omitempty"`
+	Features            []featureV2    `json:"features,omitempty"`
+}
+
+type usesSdkV2 struct {
+	MinSdkVersion    int `json:"minSdkVersion"`
+	TargetSdkVersion int `json:"targetSdkVersion"`
+}
+
+type signerV2 struct {
+	SHA256 []string `json:"sha256"`
+}
+
+type permissionV2 struct {
+	Name          string `json:"name"`
+	MaxSdkVersion int    `json:"maxSdkVersion,omitempty"`
+}
+
+type featureV2 struct {
+	Name string `json:"name"`
+}
+
+type entry struct {
+	Timestamp int64                `json:"timestamp"`
+	Version   int                  `json:"version"`
+	Index     entryFile            `json:"index"`
+	Diffs     map[string]entryFile `json:"diffs"`
+}
+
+type entryFile struct {
+	fileV2
+	NumPackages int `json:"numPackages"`
+}
@@ -0,0 +1,496 @@
+package index
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"metascoop/apps"
+)
+
+func TestParseAPK(t *testing.T) {
+	// The APKs in the repo were indexed by fdroidserver, so we can compare our results with its index
+	const repoDir = "../../fdroid/repo"
+
+	index, err := apps.ReadIndex(filepath.Join(repoDir, "index-v1.json"))
+	if err != nil {
+		t.Skipf("no repo index to compare with: %s", err.Error())
+	}
+
+	var expected = make(map[string]apps.PackageInfo)
+	for _, pkgs := range index.Packages {
+		for _, p := range pkgs {
+			expected[p.ApkName] = p
+		}
+	}
+
+	var compared int
+	for name, want := range expected {
+		apkPath := filepath.Join(repoDir, name)
+		if _, err := os.Stat(apkPath); err != nil {
+			continue
+		}
+
+		got, err := ParseAPK(apkPath)
+		if err != nil {
+			t.Errorf("ParseAPK(%q): %s", name, err.Error())
+			continue
+		}
+
+		gotInfo := apps.PackageInfo{
+			Added:            want.Added,
+			ApkName:          got.FileName,
+			Hash:             got.Hash,
+			HashType:         "sha256",
+			MinSdkVersion:    got.MinSdkVersion,
+			Nativecode:       got.NativeCode,
+			PackageName:      got.PackageName,
+			Sig:              got.Sig,
+			Signer:           got.Signer,
+			Size:             int(got.Size),
+			TargetSdkVersion: got.TargetSdkVersion,
+			VersionCode:      got.VersionCode,
+			VersionName:      got.VersionName,
+		}
+		if !reflect.DeepEqual(gotInfo, want) {
+			t.Errorf("ParseAPK(%q):\ngot  %+v\nwant %+v", name, gotInfo, want)
+		}
+
+		compared++
+	}
+
+	if compared == 0 {
+		t.Skip("none of the indexed APKs are in the repo directory")
+	}
+}
+
+func TestFindIcons(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{
+		"res/mipmap-anydpi-v26/ic_launcher.xml",
+		"res/mipmap-hdpi-v4/ic_launcher.png",
+		"res/mipmap-xxhdpi/ic_launcher.png",
+		"res/drawable/ic_launcher.png",
+		"res/mipmap-xhdpi/ic_launcher_round.png",
+		"ic_launcher.png",
+	} {
+		if _, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	png := []resourceValue{{density: 480, dataType: typeString, str: "res/a.png"}}
+	if icons := findIcons(zr, png); !reflect.DeepEqual(icons, map[int]string{480: "res/a.png"}) {
+		t.Errorf("findIcons with PNG icon returned %v", icons)
+	}
+
+	// An adaptive icon, where the PNGs with the same name are used instead
+	adaptive := []resourceValue{{density: densityAny, dataType: typeString, str: "res/mipmap-anydpi-v26/ic_launcher.xml"}}
+	want := map[int]string{
+		160: "res/drawable/ic_launcher.png",
+		240: "res/mipmap-hdpi-v4/ic_launcher.png",
+		480: "res/mipmap-xxhdpi/ic_launcher.png",
+	}
+	if icons := findIcons(zr, adaptive); !reflect.DeepEqual(icons, want) {
+		t.Errorf("findIcons with adaptive icon returned %v, want %v", icons, want)
+	}
+
+	vector := []resourceValue{{density: densityNone, dataType: typeString, str: "res/drawable/ic_vector.xml"}}
+	if icons := findIcons(zr, vector); icons != nil {
+		t.Errorf("findIcons with vector icon without PNGs returned %v", icons)
+	}
+}
+
+func TestReadKeystore(t *testing.T) {
+	var fingerprint string
+
+	for _, name := range []string{"keystore.p12", "legacy.p12"} {
+		key, err := ReadKeystore(filepath.Join("testdata", name), "testpass", "", "repokey")
+		if err != nil {
+			t.Fatalf("ReadKeystore(%q): %s", name, err.Error())
+		}
+
+		if fingerprint == "" {
+			fingerprint = key.Fingerprint()
+		} else if key.Fingerprint() != fingerprint {
+			t.Errorf("ReadKeystore(%q) returned certificate %s, want %s", name, key.Fingerprint(), fingerprint)
+		}
+
+		_, err = ReadKeystore(filepath.Join("testdata", name), "wrongpass", "", "repokey")
+		if err == nil {
+			t.Errorf("ReadKeystore(%q) with wrong password didn't return an error", name)
+		}
+
+		_, err = ReadKeystore(filepath.Join("testdata", name), "testpass", "", "otherkey")
+		if err == nil {
+			t.Errorf("ReadKeystore(%q) with unknown alias didn't return an error", name)
+		}
+	}
+
+	// Only the MAC tells that the store password is wrong if the certificates aren't encrypted
+	_, err := ReadKeystore(filepath.Join("testdata", "plaincerts.p12"), "testpass", "", "repokey")
+	if err != nil {
+		t.Errorf("ReadKeystore(%q): %s", "plaincerts.p12", err.Error())
+	}
+	_, err = ReadKeystore(filepath.Join("testdata", "plaincerts.p12"), "wrongpass", "testpass", "repokey")
+	if !errors.Is(err, errWrongKeystorePass) {
+		t.Errorf("ReadKeystore(%q) with wrong store password returned %v, want errWrongKeystorePass", "plaincerts.p12", err)
+	}
+}
+
+func TestWriteSignedJar(t *testing.T) {
+	key, err := ReadKeystore(filepath.Join("testdata", "keystore.p12"), "testpass", "", "repokey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	indexPath := filepath.Join(dir, "index-v1.json")
+	content := []byte(`{"repo": {"name": "` + strings.Repeat("long name ", 20) + `"}}`)
+
+	err = os.WriteFile(indexPath, content, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jarPath := filepath.Join(dir, "index-v1.jar")
+	err = WriteSignedJar(jarPath, indexPath, key, "repokey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(jarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	var files = make(map[string][]byte)
+	for _, f := range zr.File {
+		files[f.Name], err = readZipFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(files["index-v1.json"], content) {
+		t.Errorf("jar contains wrong index content")
+	}
+
+	var (
+		manifest       = string(files["META-INF/MANIFEST.MF"])
+		signatureFile  = files["META-INF/REPOKEY.SF"]
+		signatureBlock = files["META-INF/REPOKEY.RSA"]
+	)
+
+	if !strings.Contains(manifest, "SHA-256-Digest: "+digest(content)) {
+		t.Errorf("manifest doesn't contain digest of index:\n%s", manifest)
+	}
+	if !strings.Contains(string(signatureFile), "SHA-256-Digest-Manifest: "+digest([]byte(manifest))) {
+		t.Errorf("signature file doesn't contain digest of manifest:\n%s", signatureFile)
+	}
+
+	cert, err := pkcs7FirstCertificate(signatureBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cert, key.Certificate.Raw) {
+		t.Errorf("signature block contains the wrong certificate")
+	}
+
+	var ci pkcs7ContentInfo
+	_, err = asn1.Unmarshal(signatureBlock, &ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sd signedData
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashed := sha256.Sum256(signatureFile)
+	err = rsa.VerifyPKCS1v15(key.Certificate.PublicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], sd.SignerInfos[0].EncryptedDigest)
+	if err != nil {
+		t.Errorf("verifying signature: %s", err.Error())
+	}
+
+	fingerprint, err := RepoFingerprint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fingerprint != strings.ToUpper(key.Fingerprint()) {
+		t.Errorf("RepoFingerprint returned %s, want the fingerprint of the key %s", fingerprint, key.Fingerprint())
+	}
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestIndexTime(t *testing.T) {
+	if got := indexTime(time.Unix(1700000000, 999_000_000)); got != 1700000000000 {
+		t.Errorf("indexTime() = %d, want whole seconds", got)
+	}
+}
+
+func TestFdroidBuilder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake fdroid binary is a shell script")
+	}
+
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "fdroid")
+
+	// The script fails if it isn't called with the expected arguments
+	err := os.WriteFile(binary, []byte(`#!/bin/sh
+if [ "$*" != "update --pretty --create-metadata --verbose" ]; then
+	echo "unexpected arguments: $*" >&2
+	exit 3
+fi
+echo "something went wrong" >&2
+exit 1
+`), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := &Fdroid{Binary: binary, Args: []string{"--verbose"}}
+
+	err = builder.Build(context.Background(), dir, Options{CreateMetadata: true})
+	if err == nil || !strings.Contains(err.Error(), "something went wrong") {
+		t.Errorf("Build returned %v, want error containing the error output", err)
+	}
+
+	err = os.WriteFile(binary, []byte("#!/bin/sh\nexec sleep 10\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder = &Fdroid{Binary: binary, Timeout: 50 * time.Millisecond}
+
+	err = builder.Build(context.Background(), dir, Options{})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Build returned %v, want timeout error", err)
+	}
+}
+
+func TestFakeBuilder(t *testing.T) {
+	dir := t.TempDir()
+	repoDir := filepath.Join(dir, "repo")
+
+	err := os.MkdirAll(repoDir, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"app-1.apk", "app-2.apk", "unknown.apk"} {
+		err = os.WriteFile(filepath.Join(repoDir, name), []byte(name), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	builder := &Fake{
+		Packages: map[string]apps.PackageInfo{
+			"app-1.apk": {PackageName: "com.example.app", VersionCode: 1, VersionName: "1.0"},
+			"app-2.apk": {PackageName: "com.example.app", VersionCode: 2, VersionName: "2.0"},
+		},
+		Timestamp: time.Unix(1600000000, 0),
+	}
+
+	err = builder.Build(context.Background(), dir, Options{CreateMetadata: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := apps.ReadIndex(filepath.Join(repoDir, "index-v1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest, ok := index.FindLatestPackage("com.example.app")
+	if !ok || latest.ApkName != "app-2.apk" || latest.Added != 1600000000000 {
+		t.Errorf("index contains %+v as latest package, want app-2.apk", latest)
+	}
+	if len(index.Packages) != 1 || len(index.Apps) != 1 {
+		t.Errorf("index contains %d apps and %d packages, want 1 each", len(index.Apps), len(index.Packages))
+	}
+
+	meta, err := apps.ReadMetaFile(filepath.Join(dir, "metadata", "com.example.app.yml"))
+	if err != nil {
+		t.Fatalf("reading created metadata: %s", err.Error())
+	}
+	if meta.CurrentVersionCode != 2 {
+		t.Errorf("created metadata has CurrentVersionCode %d, want 2", meta.CurrentVersionCode)
+	}
+
+	if calls := builder.Calls(); len(calls) != 1 || !calls[0].CreateMetadata {
+		t.Errorf("builder recorded calls %+v", calls)
+	}
+
+	// The next index comes with a diff from this one
+	builder.Packages["app-3.apk"] = apps.PackageInfo{PackageName: "com.example.app", VersionCode: 3, VersionName: "3.0"}
+	builder.Timestamp = time.Unix(1600000100, 0)
+	err = os.WriteFile(filepath.Join(repoDir, "app-3.apk"), []byte("app-3.apk"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = builder.Build(context.Background(), dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e entry
+	content, err := os.ReadFile(filepath.Join(repoDir, "entry.json"))
+	if err == nil {
+		err = json.Unmarshal(content, &e)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := e.Diffs["1600000000000"]; !ok || d.Name != "/diff/1600000000000.json" || d.NumPackages != 1 {
+		t.Errorf("entry.json lists diffs %+v, want the diff from the first index", e.Diffs)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "index.xml")); err != nil {
+		t.Errorf("index.xml wasn't written: %s", err.Error())
+	}
+}
+
+// TestFdroidserverFormats compares the index.xml and the index diff to the ones fdroidserver wrote for the repo
+func TestFdroidserverFormats(t *testing.T) {
+	const repoDir = "../../fdroid/repo"
+
+	want, err := os.ReadFile(filepath.Join(repoDir, "index.xml"))
+	if err != nil {
+		t.Skipf("no fdroidserver index to compare with: %s", err.Error())
+	}
+
+	var v1 indexV1
+	content, err := os.ReadFile(filepath.Join(repoDir, "index-v1.json"))
+	if err == nil {
+		err = json.Unmarshal(content, &v1)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := readJarCertificate(filepath.Join(repoDir, "index-v1.jar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := indexXML(v1, hex.EncodeToString(cert)); !bytes.Equal(got, want) {
+		t.Errorf("index.xml differs from fdroidserver's:\n%s", firstDifference(got, want))
+	}
+
+	// The previous index isn't kept, but it is the current one without the values that are in the diff
+	var e entry
+	content, err = os.ReadFile(filepath.Join(repoDir, "entry.json"))
+	if err == nil {
+		err = json.Unmarshal(content, &e)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for since, wantFile := range e.Diffs {
+		wantDiff, err := os.ReadFile(filepath.Join(repoDir, "diff", since+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		current, err := os.ReadFile(filepath.Join(repoDir, "index-v2.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var previous, diff map[string]interface{}
+		if err := json.Unmarshal(current, &previous); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(wantDiff, &diff); err != nil {
+			t.Fatal(err)
+		}
+		removePatched(previous, diff)
+		previous["repo"].(map[string]interface{})["timestamp"], _ = strconv.ParseInt(since, 10, 64)
+
+		previousContent, err := json.Marshal(previous)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := t.TempDir()
+		diffs, err := writeDiffs(dir, previousContent, current)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]entryFile{since: wantFile}; !reflect.DeepEqual(diffs, want) {
+			t.Errorf("writeDiffs returned %+v, want %+v", diffs, want)
+		}
+
+		gotDiff, err := os.ReadFile(filepath.Join(dir, "diff", since+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotDiff, wantDiff) {
+			t.Errorf("diff from %s differs from fdroidserver's:\n%s", since, firstDifference(gotDiff, wantDiff))
+		}
+	}
+}
+
+// removePatched removes everything from v that the merge patch sets
+func removePatched(v, patch map[string]interface{}) {
+	for key, p := range patch {
+		pObj, pIsObj := p.(map[string]interface{})
+		vObj, vIsObj := v[key].(map[string]interface{})
+		if pIsObj && vIsObj {
+			removePatched(vObj, pObj)
+		} else {
+			delete(v, key)
+		}
+	}
+}
+
+func firstDifference(got, want []byte) string {
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+
+	for i := range wantLines {
+		if i >= len(gotLines) || gotLines[i] != wantLines[i] {
+			var gotLine string
+			if i < len(gotLines) {
+				gotLine = gotLines[i]
+			}
+			return fmt.Sprintf("line %d:\ngot  %q\nwant %q", i+1, gotLine, wantLines[i])
+		}
+	}
+
+	return fmt.Sprintf("got %d lines, want %d", len(gotLines), len(wantLines))
+}
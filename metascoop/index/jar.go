@@ -0,0 +1,237 @@
+package index
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []algorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"tag:0,optional"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           algorithmIdentifier
+	DigestEncryptionAlgorithm algorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// WriteSignedJar writes a JAR file at jarPath that contains the file at filePath, signed with the
+// repo key. F-Droid clients use this to verify index-v1.json and entry.json
+func WriteSignedJar(jarPath, filePath string, key *Key, alias string) (err error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return
+	}
+
+	var (
+		name    = filepath.Base(filePath)
+		sigName = signatureFileName(alias)
+	)
+
+	sigExt, err := signatureBlockExtension(key)
+	if err != nil {
+		return
+	}
+
+	digest := sha256.Sum256(content)
+	entrySection := manifestSection("Name: "+name, "SHA-256-Digest: "+base64.StdEncoding.EncodeToString(digest[:]))
+	manifest := manifestSection("Manifest-Version: 1.0", "Created-By: metascoop") + entrySection
+
+	// The signature file contains the digests of the whole manifest and of its entry sections
+	manifestDigest := sha256.Sum256([]byte(manifest))
+	sectionDigest := sha256.Sum256([]byte(entrySection))
+	signatureFile := manifestSection(
+		"Signature-Version: 1.0",
+		"Created-By: metascoop",
+		"SHA-256-Digest-Manifest: "+base64.StdEncoding.EncodeToString(manifestDigest[:]),
+	) + manifestSection("Name: "+name, "SHA-256-Digest: "+base64.StdEncoding.EncodeToString(sectionDigest[:]))
+
+	signatureBlock, err := signPKCS7([]byte(signatureFile), key)
+	if err != nil {
+		return fmt.Errorf("signing %q: %w", jarPath, err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{
+		{"META-INF/MANIFEST.MF", []byte(manifest)},
+		{"META-INF/" + sigName + ".SF", []byte(signatureFile)},
+		{"META-INF/" + sigName + sigExt, signatureBlock},
+		{name, content},
+	} {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(f.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return
+	}
+
+	return writeFileAtomic(jarPath, buf.Bytes())
+}
+
+// manifestSection formats the lines of a manifest section, wrapping lines longer than 72 bytes
+func manifestSection(lines ...string) string {
+	var sb strings.Builder
+
+	for _, l := range lines {
+		for len(l) > 70 {
+			sb.WriteString(l[:70] + "\r\n ")
+			l = l[70:]
+		}
+		sb.WriteString(l + "\r\n")
+	}
+	sb.WriteString("\r\n")
+
+	return sb.String()
+}
+
+// signatureFileName returns the base name of the signature files like jarsigner does:
+// the upper case alias, shortened to 8 characters and with unusual characters replaced
+func signatureFileName(alias string) string {
+	if alias == "" {
+		alias = "cert"
+	}
+	if len(alias) > 8 {
+		alias = alias[:8]
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, alias)
+}
+
+func signatureBlockExtension(key *Key) (string, error) {
+	switch key.Signer.(type) {
+	case *rsa.PrivateKey:
+		return ".RSA", nil
+	case *ecdsa.PrivateKey:
+		return ".EC", nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", key.Signer)
+}
+
+// signPKCS7 creates a detached PKCS#7 signature of content without signed attributes,
+// which is the format Android expects for JAR signatures
+func signPKCS7(content []byte, key *Key) (der []byte, err error) {
+	digest := sha256.Sum256(content)
+
+	var encryptionAlgorithm algorithmIdentifier
+	switch key.Signer.(type) {
+	case *rsa.PrivateKey:
+		encryptionAlgorithm = algorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	case *ecdsa.PrivateKey:
+		encryptionAlgorithm = algorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.Signer)
+	}
+
+	signature, err := key.Signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return
+	}
+
+	sha256Algorithm := algorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []algorithmIdentifier{sha256Algorithm},
+		ContentInfo:      contentInfo{ContentType: oidData},
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      key.Certificate.Raw,
+		},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: key.Certificate.RawIssuer},
+				SerialNumber: key.Certificate.SerialNumber,
+			},
+			DigestAlgorithm:           sha256Algorithm,
+			DigestEncryptionAlgorithm: encryptionAlgorithm,
+			EncryptedDigest:           signature,
+		}},
+	}
+
+	sdDER, err := asn1.Marshal(sd)
+	if err != nil {
+		return
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		// RawValues are encoded as they are, so the explicit tag has to be added here
+		Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdDER},
+	})
+}
+
+// writeFileAtomic writes the file to a temporary file first, so readers never see partial content
+func writeFileAtomic(path string, content []byte) (err error) {
+	tmpPath := path + ".tmp"
+
+	err = os.WriteFile(tmpPath, content, 0o644)
+	if err != nil {
+		return
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	}
+
+	return
+}
@@ -0,0 +1,610 @@
+package index
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// Key is the repo signing key with its certificate
+type Key struct {
+	Signer      crypto.Signer
+	Certificate *x509.Certificate
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the repo certificate, which users can check when adding the repo
+func (k *Key) Fingerprint() string {
+	sum := sha256.Sum256(k.Certificate.Raw)
+	return fmt.Sprintf("%x", sum)
+}
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEncryptedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidShroudedKeyBag    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidFriendlyName      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidX509Certificate   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidPBES2             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1      = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256    = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA512    = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidSHA1              = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA512            = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidAES128CBC         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	errLegacyEncryption  = errors.New("keystore uses legacy encryption")
+	errWrongKeystorePass = errors.New("wrong password or corrupt keystore")
+)
+
+type pfx struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  asn1.RawValue `asn1:"optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm algorithmIdentifier
+	Digest    []byte
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm algorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"tag:0,optional"`
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     algorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc algorithmIdentifier
+	EncryptionScheme  algorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                 `asn1:"optional"`
+	PRF            algorithmIdentifier `asn1:"optional"`
+}
+
+// keystoreEntry is a key or certificate with the attributes that link them together
+type keystoreEntry struct {
+	friendlyName string
+	localKeyID   []byte
+	key          crypto.Signer
+	cert         *x509.Certificate
+}
+
+// ReadKeystore reads the PKCS#12 keystore at keystorePath, as created by "fdroid init", and returns the
+// key with the given alias. If alias is empty, the keystore must only contain one key
+func ReadKeystore(keystorePath, storePass, keyPass, alias string) (k *Key, err error) {
+	content, err := os.ReadFile(keystorePath)
+	if err != nil {
+		return
+	}
+
+	if keyPass == "" {
+		keyPass = storePass
+	}
+
+	entries, err := parseKeystore(content, storePass, keyPass)
+	if errors.Is(err, errLegacyEncryption) {
+		entries, err = parseLegacyKeystore(content, storePass)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading keystore %q: %w", keystorePath, err)
+	}
+
+	var keys, certs []keystoreEntry
+	for _, e := range entries {
+		if e.key != nil {
+			keys = append(keys, e)
+		}
+		if e.cert != nil {
+			certs = append(certs, e)
+		}
+	}
+
+	var key *keystoreEntry
+	for i, e := range keys {
+		if alias == "" && len(keys) == 1 || alias != "" && strings.EqualFold(e.friendlyName, alias) {
+			key = &keys[i]
+			break
+		}
+	}
+	if key == nil {
+		if alias != "" {
+			return nil, fmt.Errorf("keystore %q doesn't contain a key with alias %q", keystorePath, alias)
+		}
+		return nil, fmt.Errorf("keystore %q contains %d keys, please set repo_keyalias", keystorePath, len(keys))
+	}
+
+	for _, c := range certs {
+		if (len(key.localKeyID) > 0 && bytes.Equal(c.localKeyID, key.localKeyID)) || publicKeyMatches(key.key, c.cert) {
+			return &Key{Signer: key.key, Certificate: c.cert}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("keystore %q doesn't contain the certificate for key %q", keystorePath, key.friendlyName)
+}
+
+func publicKeyMatches(key crypto.Signer, cert *x509.Certificate) bool {
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(cert.PublicKey)
+}
+
+// parseKeystore decodes keystores that use PBES2 encryption, which is what current versions of keytool and
+// OpenSSL create. The integrity MAC is checked with storePass, so a wrong password is noticed even if the
+// certificates aren't encrypted
+func parseKeystore(content []byte, storePass, keyPass string) (entries []keystoreEntry, err error) {
+	var p pfx
+	_, err = asn1.Unmarshal(content, &p)
+	if err != nil {
+		return
+	}
+
+	if !p.AuthSafe.ContentType.Equal(oidData) {
+		return nil, fmt.Errorf("unsupported keystore content type %s", p.AuthSafe.ContentType)
+	}
+
+	authSafeData, err := octetString(p.AuthSafe.Content)
+	if err != nil {
+		return
+	}
+
+	if len(p.MacData.FullBytes) > 0 {
+		err = verifyMAC(p.MacData.FullBytes, authSafeData, storePass)
+		if err != nil {
+			return
+		}
+	}
+
+	var authSafe []contentInfo
+	_, err = asn1.Unmarshal(authSafeData, &authSafe)
+	if err != nil {
+		return
+	}
+
+	for _, ci := range authSafe {
+		var safeContents []byte
+
+		switch {
+		case ci.ContentType.Equal(oidData):
+			safeContents, err = octetString(ci.Content)
+		case ci.ContentType.Equal(oidEncryptedData):
+			var ed encryptedData
+			_, err = asn1.Unmarshal(ci.Content.Bytes, &ed)
+			if err != nil {
+				return
+			}
+
+			var encrypted []byte
+			encrypted, err = octetString(ed.EncryptedContentInfo.EncryptedContent)
+			if err != nil {
+				return
+			}
+
+			safeContents, err = pbeDecrypt(ed.EncryptedContentInfo.ContentEncryptionAlgorithm, encrypted, storePass)
+		default:
+			err = fmt.Errorf("unsupported keystore content type %s", ci.ContentType)
+		}
+		if err != nil {
+			return
+		}
+
+		var bags []safeBag
+		_, err = asn1.Unmarshal(safeContents, &bags)
+		if err != nil {
+			return
+		}
+
+		for _, bag := range bags {
+			var entry keystoreEntry
+			entry, err = parseSafeBag(bag, keyPass)
+			if err != nil {
+				return
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	return
+}
+
+func parseSafeBag(bag safeBag, keyPass string) (e keystoreEntry, err error) {
+	for _, attr := range bag.Attributes {
+		switch {
+		case attr.ID.Equal(oidFriendlyName):
+			var bmp asn1.RawValue
+			_, err = asn1.Unmarshal(attr.Value.Bytes, &bmp)
+			if err != nil {
+				return
+			}
+			e.friendlyName = decodeBMPString(bmp.Bytes)
+		case attr.ID.Equal(oidLocalKeyID):
+			_, err = asn1.Unmarshal(attr.Value.Bytes, &e.localKeyID)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	var keyDER []byte
+
+	switch {
+	case bag.ID.Equal(oidCertBag):
+		var cb certBag
+		_, err = asn1.Unmarshal(bag.Value.Bytes, &cb)
+		if err != nil {
+			return
+		}
+		if !cb.ID.Equal(oidX509Certificate) {
+			return e, nil
+		}
+
+		e.cert, err = x509.ParseCertificate(cb.Data)
+		return
+	case bag.ID.Equal(oidShroudedKeyBag):
+		var epki encryptedPrivateKeyInfo
+		_, err = asn1.Unmarshal(bag.Value.Bytes, &epki)
+		if err != nil {
+			return
+		}
+
+		keyDER, err = pbeDecrypt(epki.Algorithm, epki.EncryptedData, keyPass)
+		if err != nil {
+			return
+		}
+	case bag.ID.Equal(oidKeyBag):
+		keyDER = bag.Value.Bytes
+	default:
+		// Secret and CRL bags are never used for repo keys
+		return e, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(keyDER)
+	if err != nil {
+		return e, errWrongKeystorePass
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		e.key = key
+	case *ecdsa.PrivateKey:
+		e.key = key
+	default:
+		return e, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	return
+}
+
+// verifyMAC checks the HMAC over the content of the keystore, with the key derived from password by the
+// PKCS#12 key derivation function
+func verifyMAC(der, content []byte, password string) (err error) {
+	var mac macData
+	_, err = asn1.Unmarshal(der, &mac)
+	if err != nil {
+		return
+	}
+
+	var h func() hash.Hash
+	switch {
+	case mac.Mac.Algorithm.Algorithm.Equal(oidSHA1):
+		h = sha1.New
+	case mac.Mac.Algorithm.Algorithm.Equal(oidSHA256):
+		h = sha256.New
+	case mac.Mac.Algorithm.Algorithm.Equal(oidSHA512):
+		h = sha512.New
+	default:
+		return fmt.Errorf("unsupported MAC algorithm %s", mac.Mac.Algorithm.Algorithm)
+	}
+
+	passwords := [][]byte{bmpPassword(password)}
+	if password == "" {
+		// Some tools derive the key for an empty password from no bytes at all instead of a null terminator
+		passwords = append(passwords, nil)
+	}
+
+	for _, p := range passwords {
+		m := hmac.New(h, pkcs12KDF(h, p, mac.MacSalt, mac.Iterations, 3, h().Size()))
+		m.Write(content)
+		if hmac.Equal(m.Sum(nil), mac.Mac.Digest) {
+			return nil
+		}
+	}
+
+	return errWrongKeystorePass
+}
+
+// bmpPassword encodes password as a null-terminated BMPString, which the PKCS#12 key derivation expects
+func bmpPassword(password string) []byte {
+	units := utf16.Encode([]rune(password))
+	b := make([]byte, 0, 2*len(units)+2)
+	for _, u := range units {
+		b = append(b, byte(u>>8), byte(u))
+	}
+
+	return append(b, 0, 0)
+}
+
+// pkcs12KDF derives n bytes from password and salt as described in RFC 7292, appendix B.2.
+// id selects the purpose of the key, 3 is for the integrity MAC
+func pkcs12KDF(h func() hash.Hash, password, salt []byte, iterations int, id byte, n int) []byte {
+	u := h().Size()
+	v := h().BlockSize()
+
+	repeat := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+
+	d := bytes.Repeat([]byte{id}, v)
+	i := append(repeat(salt), repeat(password)...)
+
+	var key []byte
+	for len(key) < n {
+		a := append(append([]byte{}, d...), i...)
+		for r := 0; r < iterations; r++ {
+			sum := h()
+			sum.Write(a)
+			a = sum.Sum(nil)
+		}
+		key = append(key, a...)
+
+		b := make([]byte, v)
+		for k := range b {
+			b[k] = a[k%u]
+		}
+
+		// Every block of i becomes (block + b + 1) mod 2^(8v)
+		for j := 0; j < len(i); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(i[j+k]) + int(b[k]) + carry
+				i[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+
+	return key[:n]
+}
+
+// pbeDecrypt decrypts data that was encrypted with PBES2, using PBKDF2 and AES-CBC
+func pbeDecrypt(alg algorithmIdentifier, encrypted []byte, password string) (decrypted []byte, err error) {
+	if !alg.Algorithm.Equal(oidPBES2) {
+		return nil, errLegacyEncryption
+	}
+
+	var params pbes2Params
+	_, err = asn1.Unmarshal(alg.Parameters.FullBytes, &params)
+	if err != nil {
+		return
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	_, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf)
+	if err != nil {
+		return
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case kdf.PRF.Algorithm == nil, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported pseudo-random function %s", kdf.PRF.Algorithm)
+	}
+
+	var keyLength int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLength = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLength = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, fmt.Errorf("unsupported encryption scheme %s", params.EncryptionScheme.Algorithm)
+	}
+
+	var iv []byte
+	_, err = asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv)
+	if err != nil {
+		return
+	}
+
+	key := pbkdf2.Key([]byte(password), kdf.Salt, kdf.IterationCount, keyLength, prf)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	if len(iv) != block.BlockSize() || len(encrypted) == 0 || len(encrypted)%block.BlockSize() != 0 {
+		return nil, errWrongKeystorePass
+	}
+
+	decrypted = make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, encrypted)
+
+	// Remove the PKCS#7 padding, which must be valid if the password was right
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, errWrongKeystorePass
+	}
+	for _, b := range decrypted[len(decrypted)-padding:] {
+		if int(b) != padding {
+			return nil, errWrongKeystorePass
+		}
+	}
+
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+// parseLegacyKeystore decodes keystores encrypted with the old PKCS#12 algorithms (3DES and RC2)
+func parseLegacyKeystore(content []byte, password string) (entries []keystoreEntry, err error) {
+	blocks, err := pkcs12.ToPEM(content, password)
+	if err != nil {
+		return
+	}
+
+	for _, b := range blocks {
+		var e = keystoreEntry{friendlyName: b.Headers["friendlyName"]}
+		if id, ok := b.Headers["localKeyId"]; ok {
+			fmt.Sscanf(id, "%x", &e.localKeyID)
+		}
+
+		switch b.Type {
+		case "CERTIFICATE":
+			e.cert, err = x509.ParseCertificate(b.Bytes)
+		case "PRIVATE KEY":
+			e.key, err = parsePEMKey(b)
+		}
+		if err != nil {
+			return
+		}
+
+		entries = append(entries, e)
+	}
+
+	return
+}
+
+func parsePEMKey(b *pem.Block) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(b.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(b.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(b.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	return signer, nil
+}
+
+// octetString returns the content of an OCTET STRING, which may be split into multiple parts in BER
+func octetString(v asn1.RawValue) (b []byte, err error) {
+	if !v.IsCompound {
+		if v.Tag != asn1.TagOctetString && v.Class == asn1.ClassUniversal {
+			return nil, fmt.Errorf("expected OCTET STRING, got tag %d", v.Tag)
+		}
+		return v.Bytes, nil
+	}
+
+	rest := v.Bytes
+	for len(rest) > 0 {
+		var part asn1.RawValue
+		rest, err = asn1.Unmarshal(rest, &part)
+		if err != nil {
+			return
+		}
+
+		var content []byte
+		content, err = octetString(part)
+		if err != nil {
+			return
+		}
+		b = append(b, content...)
+	}
+
+	return
+}
+
+func decodeBMPString(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+
+	return strings.TrimSuffix(string(utf16.Decode(units)), "\x00")
+}
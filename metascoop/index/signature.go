@@ -0,0 +1,262 @@
+package index
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Block IDs in the APK signing block, see https://source.android.com/docs/security/features/apksigning/v2
+const (
+	blockIDv2  = 0x7109871a
+	blockIDv3  = 0xf05368c0
+	blockIDv31 = 0x1b93ad61
+)
+
+var apkSigBlockMagic = []byte("APK Sig Block 42")
+
+var errNoSignature = errors.New("APK is not signed")
+
+// signerCertificate returns the DER encoded certificate of the first signer of an APK,
+// which is what F-Droid uses to identify the signer. The JAR signature (v1) is checked
+// first, then the APK signature scheme v3 and v2 blocks
+func signerCertificate(apkPath string, zr *zip.Reader) (cert []byte, err error) {
+	cert, err = jarCertificate(zr)
+	if !errors.Is(err, errNoSignature) {
+		return
+	}
+
+	block, err := readSigningBlock(apkPath)
+	if err != nil {
+		return
+	}
+
+	for _, id := range []uint32{blockIDv31, blockIDv3, blockIDv2} {
+		value, ok := block[id]
+		if !ok {
+			continue
+		}
+
+		return firstSchemeCertificate(value)
+	}
+
+	return nil, errNoSignature
+}
+
+// jarCertificate returns the DER encoded certificate of the first JAR signature (v1) in zr
+func jarCertificate(zr *zip.Reader) (cert []byte, err error) {
+	for _, f := range zr.File {
+		dir, name := path.Split(f.Name)
+		ext := strings.ToUpper(path.Ext(name))
+		if dir != "META-INF/" || (ext != ".RSA" && ext != ".DSA" && ext != ".EC") {
+			continue
+		}
+
+		content, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err = pkcs7FirstCertificate(content)
+		if err != nil {
+			return nil, fmt.Errorf("reading JAR signature %q: %w", f.Name, err)
+		}
+
+		return cert, nil
+	}
+
+	return nil, errNoSignature
+}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+func pkcs7FirstCertificate(der []byte) (cert []byte, err error) {
+	var ci pkcs7ContentInfo
+	_, err = asn1.Unmarshal(der, &ci)
+	if err != nil {
+		return
+	}
+
+	var sd pkcs7SignedData
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		return
+	}
+
+	if len(sd.Certificates.Bytes) == 0 {
+		return nil, errNoSignature
+	}
+
+	// Certificates is an implicitly tagged SET, its content is the sequence of certificates
+	var first asn1.RawValue
+	_, err = asn1.Unmarshal(sd.Certificates.Bytes, &first)
+	if err != nil {
+		return
+	}
+
+	return first.FullBytes, nil
+}
+
+// readSigningBlock returns the values of the APK signing block by their ID
+func readSigningBlock(apkPath string) (values map[uint32][]byte, err error) {
+	f, err := os.Open(apkPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	cdOffset, err := centralDirectoryOffset(f, stat.Size())
+	if err != nil {
+		return
+	}
+
+	// The block ends with its size and the magic right before the central directory
+	if cdOffset < 24 {
+		return nil, errNoSignature
+	}
+
+	footer := make([]byte, 24)
+	_, err = f.ReadAt(footer, cdOffset-24)
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(footer[8:], apkSigBlockMagic) {
+		return nil, errNoSignature
+	}
+
+	blockSize := int64(binary.LittleEndian.Uint64(footer))
+	if blockSize < 24 || blockSize > cdOffset-8 {
+		return nil, errors.New("invalid APK signing block size")
+	}
+
+	// The pairs are between the leading size field and the footer
+	pairs := make([]byte, blockSize-24)
+	_, err = f.ReadAt(pairs, cdOffset-blockSize)
+	if err != nil {
+		return
+	}
+
+	values = make(map[uint32][]byte)
+	for len(pairs) >= 12 {
+		length := binary.LittleEndian.Uint64(pairs)
+		if length < 4 || length > uint64(len(pairs)-8) {
+			return nil, errors.New("invalid entry in APK signing block")
+		}
+
+		values[binary.LittleEndian.Uint32(pairs[8:])] = pairs[12 : 8+length]
+		pairs = pairs[8+length:]
+	}
+
+	return
+}
+
+func centralDirectoryOffset(r io.ReaderAt, size int64) (offset int64, err error) {
+	// The end of central directory record is at least 22 bytes and may have a comment of up to 64 KiB
+	const eocdSize = 22
+
+	readSize := int64(eocdSize + 0xffff)
+	if readSize > size {
+		readSize = size
+	}
+
+	buf := make([]byte, readSize)
+	_, err = r.ReadAt(buf, size-readSize)
+	if err != nil {
+		return
+	}
+
+	for i := len(buf) - eocdSize; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) == 0x06054b50 {
+			return int64(binary.LittleEndian.Uint32(buf[i+16:])), nil
+		}
+	}
+
+	return 0, errors.New("cannot find end of central directory")
+}
+
+// lengthPrefixed splits b into its first length-prefixed element and the rest
+func lengthPrefixed(b []byte) (elem []byte, rest []byte, err error) {
+	if len(b) < 4 {
+		return nil, nil, errors.New("truncated length-prefixed value")
+	}
+
+	length := binary.LittleEndian.Uint32(b)
+	if uint64(length) > uint64(len(b)-4) {
+		return nil, nil, errors.New("invalid length-prefixed value")
+	}
+
+	return b[4 : 4+length], b[4+length:], nil
+}
+
+// firstSchemeCertificate returns the first certificate of the first signer in a v2 or v3 signature scheme block
+func firstSchemeCertificate(block []byte) (cert []byte, err error) {
+	signers, _, err := lengthPrefixed(block)
+	if err != nil {
+		return
+	}
+
+	signer, _, err := lengthPrefixed(signers)
+	if err != nil {
+		return
+	}
+
+	signedData, _, err := lengthPrefixed(signer)
+	if err != nil {
+		return
+	}
+
+	// Signed data starts with the digests, followed by the certificates
+	_, rest, err := lengthPrefixed(signedData)
+	if err != nil {
+		return
+	}
+
+	certs, _, err := lengthPrefixed(rest)
+	if err != nil {
+		return
+	}
+
+	cert, _, err = lengthPrefixed(certs)
+	if err != nil {
+		return
+	}
+	if len(cert) == 0 {
+		return nil, errNoSignature
+	}
+
+	return
+}
+
+func readZipFile(f *zip.File) (content []byte, err error) {
+	rc, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,234 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xmlWriter writes XML indented with tabs, the way Python's minidom does for fdroidserver
+type xmlWriter struct {
+	strings.Builder
+}
+
+var (
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", "\"", "&quot;", ">", "&gt;")
+)
+
+// tag writes the start of an element with its attributes, which are given as name and value pairs
+func (x *xmlWriter) tag(depth int, name string, attrs []string) {
+	x.WriteString(strings.Repeat("\t", depth) + "<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		x.WriteString(" " + attrs[i] + "=\"" + xmlAttrEscaper.Replace(attrs[i+1]) + "\"")
+	}
+}
+
+func (x *xmlWriter) open(depth int, name string, attrs ...string) {
+	x.tag(depth, name, attrs)
+	x.WriteString(">\n")
+}
+
+func (x *xmlWriter) close(depth int, name string) {
+	x.WriteString(strings.Repeat("\t", depth) + "</" + name + ">\n")
+}
+
+func (x *xmlWriter) empty(depth int, name string, attrs ...string) {
+	x.tag(depth, name, attrs)
+	x.WriteString("/>\n")
+}
+
+func (x *xmlWriter) element(depth int, name, text string, attrs ...string) {
+	x.tag(depth, name, attrs)
+	x.WriteString(">" + xmlTextEscaper.Replace(text) + "</" + name + ">\n")
+}
+
+func (x *xmlWriter) optional(depth int, name, text string) {
+	if text != "" {
+		x.element(depth, name, text)
+	}
+}
+
+// indexXML returns the legacy index.xml, which fdroidserver calls index v0, with the same content and
+// layout as fdroidserver writes it. pubkey is the hex encoded repo certificate
+func indexXML(v1 indexV1, pubkey string) []byte {
+	var x xmlWriter
+
+	x.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	x.open(0, "fdroid")
+
+	x.open(1, "repo",
+		"icon", v1.Repo.Icon,
+		"name", v1.Repo.Name,
+		"pubkey", pubkey,
+		"timestamp", strconv.FormatInt(v1.Repo.Timestamp/1000, 10),
+		"url", v1.Repo.Address,
+		"version", strconv.Itoa(v1.Repo.Version),
+	)
+	x.element(2, "description", v1.Repo.Description)
+	x.close(1, "repo")
+
+	for _, pkg := range v1.Requests.Install {
+		x.empty(1, "install", "packageName", pkg)
+	}
+	for _, pkg := range v1.Requests.Uninstall {
+		x.empty(1, "uninstall", "packageName", pkg)
+	}
+
+	for _, a := range v1.Apps {
+		packages := xmlPackages(v1.Packages[a.PackageName])
+		if len(packages) == 0 {
+			continue
+		}
+
+		x.open(1, "application", "id", a.PackageName)
+		x.element(2, "id", a.PackageName)
+		if a.Added != 0 {
+			x.element(2, "added", xmlDate(a.Added))
+		}
+		if a.LastUpdated != 0 {
+			x.element(2, "lastupdated", xmlDate(a.LastUpdated))
+		}
+		x.element(2, "name", a.Name)
+		x.element(2, "summary", a.Summary)
+		x.optional(2, "icon", a.Icon)
+
+		desc := a.Description
+		if desc == "" {
+			desc = "No description available"
+		}
+		x.element(2, "desc", desc)
+
+		x.element(2, "license", a.License)
+		if len(a.Categories) > 0 {
+			x.element(2, "categories", strings.Join(a.Categories, ","))
+			// Clients that only know one category read the last one, which is the primary category
+			x.element(2, "category", a.Categories[0])
+		}
+		x.element(2, "web", a.WebSite)
+		x.element(2, "source", a.SourceCode)
+		x.element(2, "tracker", a.IssueTracker)
+		x.optional(2, "changelog", a.Changelog)
+		x.optional(2, "author", a.AuthorName)
+		x.optional(2, "email", a.AuthorEmail)
+		x.optional(2, "donate", a.Donate)
+		x.optional(2, "bitcoin", a.Bitcoin)
+		x.optional(2, "litecoin", a.Litecoin)
+		x.optional(2, "openCollective", a.OpenCollective)
+		x.element(2, "marketversion", a.SuggestedVersionName)
+		x.element(2, "marketvercode", a.SuggestedVersionCode)
+
+		x.optional(2, "antifeatures", strings.Join(sortedUnique(a.AntiFeatures), ","))
+
+		for _, p := range packages {
+			x.open(2, "package")
+			x.optional(3, "version", p.VersionName)
+			x.element(3, "versioncode", strconv.Itoa(p.VersionCode))
+			x.element(3, "apkname", p.ApkName)
+			x.element(3, "hash", p.Hash, "type", "sha256")
+			x.element(3, "size", strconv.FormatInt(p.Size, 10))
+			x.element(3, "sdkver", strconv.Itoa(p.MinSdkVersion))
+			x.element(3, "targetSdkVersion", strconv.Itoa(p.TargetSdkVersion))
+			if p.MaxSdkVersion != 0 {
+				x.element(3, "maxsdkver", strconv.Itoa(p.MaxSdkVersion))
+			}
+			if p.Added != 0 {
+				x.element(3, "added", xmlDate(p.Added))
+			}
+
+			if strings.HasSuffix(strings.ToLower(p.ApkName), ".apk") {
+				x.element(3, "sig", p.Sig)
+
+				permissions := sortedPermissions(p.UsesPermission)
+				var names []string
+				for _, perm := range permissions {
+					names = append(names, strings.TrimPrefix(perm[0], "android.permission."))
+				}
+				x.optional(3, "permissions", strings.Join(sortedUnique(names), ","))
+
+				// Like fdroidserver, only the permissions that are limited to older SDK versions get an element
+				for _, perm := range permissions {
+					if perm[1] != "" {
+						x.empty(3, "uses-permission", "maxSdkVersion", perm[1], "name", perm[0])
+					}
+				}
+				for _, perm := range sortedPermissions(p.UsesPermissionSdk23) {
+					if perm[1] != "" {
+						x.empty(3, "uses-permission-sdk-23", "maxSdkVersion", perm[1], "name", perm[0])
+					}
+				}
+
+				x.optional(3, "nativecode", strings.Join(sortedUnique(p.NativeCode), ","))
+				x.optional(3, "features", strings.Join(sortedUnique(p.Features), ","))
+			}
+
+			x.close(2, "package")
+		}
+
+		x.close(1, "application")
+	}
+
+	x.close(0, "fdroid")
+
+	return []byte(x.String())
+}
+
+// xmlPackages returns one package per version code, newest first
+func xmlPackages(packages []packageV1) (unique []packageV1) {
+	seen := make(map[int]bool)
+	for _, p := range packages {
+		if !seen[p.VersionCode] {
+			seen[p.VersionCode] = true
+			unique = append(unique, p)
+		}
+	}
+
+	sort.SliceStable(unique, func(i, j int) bool {
+		return unique[i].VersionCode > unique[j].VersionCode
+	})
+
+	return
+}
+
+// sortedPermissions returns the name and max SDK version of the permission pairs of index-v1.json,
+// sorted by name. The max SDK version is empty if there is no limit
+func sortedPermissions(pairs [][]interface{}) (perms [][2]string) {
+	for _, pair := range pairs {
+		if len(pair) != 2 {
+			continue
+		}
+
+		var perm [2]string
+		perm[0] = fmt.Sprint(pair[0])
+		if pair[1] != nil {
+			perm[1] = fmt.Sprint(pair[1])
+		}
+		perms = append(perms, perm)
+	}
+
+	sort.SliceStable(perms, func(i, j int) bool {
+		return perms[i][0] < perms[j][0]
+	})
+
+	return
+}
+
+func sortedUnique(list []string) (unique []string) {
+	sorted := append([]string(nil), list...)
+	sort.Strings(sorted)
+
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			unique = append(unique, s)
+		}
+	}
+
+	return
+}
+
+// xmlDate formats a timestamp of the index as the date in UTC
+func xmlDate(timestamp int64) string {
+	return time.Unix(timestamp/1000, 0).UTC().Format("2006-01-02")
+}
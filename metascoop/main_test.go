@@ -0,0 +1,626 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"metascoop/apps"
+	"metascoop/index"
+	"metascoop/pipeline"
+)
+
+// The tests in this file run metascoop end to end against a fake forge server that serves the API
+// responses and release assets in testdata/forge, and a local git repository with screenshots
+
+const readmeTemplate = `# Test repo
+
+<!-- This table is auto-generated. Do not edit -->
+<!-- end apps table -->
+
+Text after the table
+`
+
+const appsFile = `notes:
+  git: https://github.com/example/notes
+  name: Notes
+  categories:
+    - Writing
+timer:
+  git: https://codeberg.org/example/timer
+scanner:
+  git: https://gitlab.com/example/scanner
+`
+
+const emptyIndex = `{"repo": {}, "requests": {"install": [], "uninstall": []}, "apps": [], "packages": {}}`
+
+// originalHostHeader tells the fake forge server which host a request was meant for
+const originalHostHeader = "X-Original-Host"
+
+// cdnHost is where the fake forge redirects asset downloads of private repositories to
+const cdnHost = "objects.githubusercontent.com"
+
+// fakeForge serves the files in testdata/forge/<host>/<path> with or without .json extension
+type fakeForge struct {
+	mu       sync.Mutex
+	requests []string
+	// token makes the GitHub repositories private: requests without it are not found like on GitHub,
+	// and assets are redirected to a CDN that rejects requests with credentials
+	token string
+}
+
+func (f *fakeForge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Header.Get(originalHostHeader)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, host+r.URL.Path)
+	token := f.token
+	f.mu.Unlock()
+
+	if token != "" {
+		switch {
+		case host == cdnHost && r.Header.Get("Authorization") != "":
+			http.Error(w, "Only one auth mechanism allowed", http.StatusBadRequest)
+			return
+		case host == cdnHost:
+			host = "api.github.com"
+		case host == "api.github.com" && r.Header.Get("Authorization") != "Bearer "+token:
+			http.NotFound(w, r)
+			return
+		case host == "api.github.com" && strings.Contains(r.URL.Path, "/releases/assets/"):
+			http.Redirect(w, r, "https://"+cdnHost+r.URL.Path, http.StatusFound)
+			return
+		}
+	}
+
+	// All lists fit on the first page
+	if page := r.URL.Query().Get("page"); page != "" && page != "1" {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+		return
+	}
+
+	base := filepath.Join("testdata", "forge", host, filepath.FromSlash(r.URL.Path))
+	for _, name := range []string{base + ".json", base} {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+
+		if strings.HasSuffix(name, ".json") {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		_, _ = w.Write(content)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+func (f *fakeForge) requested(path string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, r := range f.requests {
+		if r == path {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectTransport sends all requests to the fake forge server
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(originalHostHeader, req.URL.Host)
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+
+	return t.base.RoundTrip(req)
+}
+
+// startFakeForge starts a fake forge server and returns a transport that sends all requests to it
+func startFakeForge(t *testing.T) (forge *fakeForge, transport http.RoundTripper) {
+	forge = &fakeForge{}
+
+	srv := httptest.NewServer(forge)
+	t.Cleanup(srv.Close)
+
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return forge, redirectTransport{target: target, base: srv.Client().Transport}
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err.Error(), output)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setupRepo creates a git repository like the one metascoop runs in, and a git repository of the
+// notes app with a screenshot that is cloned instead of https://github.com/example/notes
+func setupRepo(t *testing.T, appsContent string) (dir string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	// Tests must not write to the summary of the job they run in
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+
+	appDir := t.TempDir()
+	writeFile(t, filepath.Join(appDir, "fastlane", "metadata", "android", "en-US", "images", "phoneScreenshots", "main.png"), "screenshot")
+	runGit(t, appDir, "init", "-q")
+	runGit(t, appDir, "add", "-A")
+	runGit(t, appDir, "commit", "-q", "-m", "Initial commit")
+
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "url."+appDir+".insteadOf")
+	t.Setenv("GIT_CONFIG_VALUE_0", "https://github.com/example/notes")
+
+	dir = t.TempDir()
+	writeFile(t, filepath.Join(dir, "README.md"), readmeTemplate)
+	writeFile(t, filepath.Join(dir, "apps.yaml"), appsContent)
+	writeFile(t, filepath.Join(dir, "fdroid", "repo", "index-v1.json"), emptyIndex)
+	runGit(t, dir, "init", "-q")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "Initial commit")
+
+	return
+}
+
+func fakeBuilder() *index.Fake {
+	return &index.Fake{
+		Packages: map[string]apps.PackageInfo{
+			"notes_v1.0.apk":      {PackageName: "com.example.notes", VersionCode: 10, VersionName: "1.0", MinSdkVersion: 21, TargetSdkVersion: 33},
+			"notes_v1.1-beta.apk": {PackageName: "com.example.notes", VersionCode: 11, VersionName: "1.1-beta", MinSdkVersion: 21, TargetSdkVersion: 33},
+			"timer_v2.0.apk":      {PackageName: "com.example.timer", VersionCode: 20, VersionName: "2.0", MinSdkVersion: 21, TargetSdkVersion: 33},
+			"scanner_v3.0.apk":    {PackageName: "com.example.scanner", VersionCode: 30, VersionName: "3.0", MinSdkVersion: 21, TargetSdkVersion: 33},
+		},
+		Timestamp: time.Unix(1700000000, 0),
+	}
+}
+
+// testRepo is a repository created with setupRepo whose runs send their requests to a fake forge
+type testRepo struct {
+	forge     *fakeForge
+	transport http.RoundTripper
+	dir       string
+}
+
+func newTestRepo(t *testing.T, appsContent string) *testRepo {
+	forge, transport := startFakeForge(t)
+
+	return &testRepo{
+		forge:     forge,
+		transport: transport,
+		dir:       setupRepo(t, appsContent),
+	}
+}
+
+func (r *testRepo) repoDir() string {
+	return filepath.Join(r.dir, "fdroid", "repo")
+}
+
+// run runs metascoop on the repository with the given arguments in addition to the app file and repo dir
+func (r *testRepo) run(ctx context.Context, builder index.Builder, args ...string) int {
+	args = append([]string{"-ap", filepath.Join(r.dir, "apps.yaml"), "-rd", r.repoDir()}, args...)
+
+	return run(ctx, args, builder, r.transport)
+}
+
+func TestRun(t *testing.T) {
+	r := newTestRepo(t, appsFile)
+
+	var (
+		args    = []string{"-site", "-feed", "-stats"}
+		dir     = r.dir
+		repoDir = r.repoDir()
+		metaDir = filepath.Join(dir, "fdroid", "metadata")
+	)
+
+	builder := fakeBuilder()
+	if code := r.run(context.Background(), builder, args...); code != 0 {
+		t.Fatalf("first run exited with code %d, want 0", code)
+	}
+
+	for _, path := range []string{
+		"api.github.com/repos/example/notes/releases",
+		"codeberg.org/api/v1/repos/example/timer/releases",
+		"gitlab.com/api/v4/projects/example/scanner/repository/tags",
+		"gitlab.com/api/v4/projects/example/scanner/releases",
+	} {
+		if !r.forge.requested(path) {
+			t.Errorf("%s was not requested", path)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"notes_v1.0.apk":   "notes 1.0 apk",
+		"timer_v2.0.apk":   "timer 2.0 apk",
+		"scanner_v3.0.apk": "scanner 3.0 apk",
+	} {
+		apk, err := os.ReadFile(filepath.Join(repoDir, name))
+		if err != nil || string(apk) != want {
+			t.Errorf("release APK %s wasn't downloaded correctly: %q, %v", name, apk, err)
+		}
+	}
+	for _, name := range []string{"notes_v1.1-beta.apk", "notes_v0.9.apk"} {
+		if _, err := os.Stat(filepath.Join(repoDir, name)); err == nil {
+			t.Errorf("%s of a prerelease or draft was downloaded", name)
+		}
+	}
+
+	meta, err := apps.ReadMetaFile(filepath.Join(metaDir, "com.example.notes.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Name != "Notes" || meta.Summary != "Take notes without an account" || meta.License != "MIT" || meta.AuthorName != "example" {
+		t.Errorf("metadata wasn't filled in from the app file and forge: %+v", meta)
+	}
+	if meta.CurrentVersion != "1.0" || meta.CurrentVersionCode != 10 {
+		t.Errorf("metadata has current version %q (%d), want 1.0 (10)", meta.CurrentVersion, meta.CurrentVersionCode)
+	}
+
+	changelog, err := os.ReadFile(filepath.Join(metaDir, "com.example.notes", "en-US", "changelogs", "10.txt"))
+	if err != nil || !strings.Contains(string(changelog), "Notes can be pinned now") {
+		t.Errorf("changelog wasn't written from the release notes: %q, %v", changelog, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(repoDir, "com.example.notes", "en-US", "phoneScreenshots", "1.png")); err != nil {
+		t.Errorf("screenshot from the app repository wasn't published: %s", err.Error())
+	}
+	if _, err := os.Stat(filepath.Join(metaDir, "com.example.notes", "en-US", "phoneScreenshots")); err == nil {
+		t.Errorf("screenshots weren't removed from the metadata directory")
+	}
+
+	readme, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(readme), "[**Notes**](https://github.com/example/notes)") || !strings.Contains(string(readme), "1.0 (10)") {
+		t.Errorf("README doesn't list the app:\n%s", readme)
+	}
+	if !strings.HasSuffix(string(readme), "<!-- end apps table -->\n\nText after the table\n") {
+		t.Errorf("README text after the table was changed:\n%s", readme)
+	}
+
+	for _, name := range []string{"index.html", filepath.Join("apps", "com.example.notes.html"), "feed.xml"} {
+		if _, err := os.Stat(filepath.Join(dir, "fdroid", name)); err != nil {
+			t.Errorf("%s wasn't generated: %s", name, err.Error())
+		}
+	}
+	feedJSON, err := os.ReadFile(filepath.Join(dir, "fdroid", "feed.json"))
+	if err != nil || !strings.Contains(string(feedJSON), "Notes can be pinned now") {
+		t.Errorf("feed doesn't contain the changelog of the new version: %q, %v", feedJSON, err)
+	}
+
+	appStats, err := os.ReadFile(filepath.Join(dir, "fdroid", "stats", "apps.csv"))
+	if err != nil || !strings.Contains(string(appStats), ",notes,github.com/example/notes,42,3,") || !strings.Contains(string(appStats), ",timer,codeberg.org/example/timer,5,1,") {
+		t.Errorf("stats weren't recorded: %q, %v", appStats, err)
+	}
+
+	if calls := builder.Calls(); len(calls) != 2 || !calls[0].CreateMetadata || calls[1].CreateMetadata {
+		t.Errorf("builder was called with %+v, want one call creating metadata and one reading it", calls)
+	}
+
+	// Nothing changes when running again on the committed result
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "Update repo")
+
+	if code := r.run(context.Background(), fakeBuilder(), args...); code != 2 {
+		t.Errorf("second run exited with code %d, want 2", code)
+	}
+}
+
+func TestRunOutcomes(t *testing.T) {
+	failingApps := appsFile + `missing:
+  git: https://github.com/example/missing
+gone:
+  git: https://codeberg.org/example/gone
+`
+
+	for _, tt := range []struct {
+		name string
+		apps string
+		args []string
+		// token makes the GitHub repositories private and is given to metascoop
+		token      string
+		builderErr error
+		want       int
+		check      func(t *testing.T, r *testRepo, builder *index.Fake)
+	}{
+		{
+			name: "too many failed apps",
+			apps: failingApps,
+			args: []string{"-max-failed-apps", "1"},
+			want: exitError,
+			check: func(t *testing.T, r *testRepo, builder *index.Fake) {
+				// The run stops before the repo is updated
+				if calls := builder.Calls(); len(calls) != 0 {
+					t.Errorf("index was built although too many apps failed: %+v", calls)
+				}
+			},
+		},
+		{
+			name: "missing repositories",
+			apps: failingApps,
+			want: exitPartial,
+			check: func(t *testing.T, r *testRepo, builder *index.Fake) {
+				// The other apps are still updated
+				if _, err := os.Stat(filepath.Join(r.repoDir(), "notes_v1.0.apk")); err != nil {
+					t.Errorf("APK of other app wasn't downloaded: %s", err.Error())
+				}
+			},
+		},
+		{
+			name:       "failing index builder",
+			apps:       failingApps,
+			builderErr: os.ErrPermission,
+			want:       exitError,
+		},
+		{
+			name:  "private repository",
+			apps:  appsFile,
+			token: "secret-token",
+			want:  exitChanged,
+			check: func(t *testing.T, r *testRepo, builder *index.Fake) {
+				apk, err := os.ReadFile(filepath.Join(r.repoDir(), "notes_v1.0.apk"))
+				if err != nil || string(apk) != "notes 1.0 apk" {
+					t.Errorf("APK of private repository wasn't downloaded correctly: %q, %v", apk, err)
+				}
+				if !r.forge.requested(cdnHost + "/repos/example/notes/releases/assets/12") {
+					t.Errorf("download wasn't redirected to the CDN")
+				}
+			},
+		},
+		{
+			// The API answers for example/old-notes with example/notes, like after a redirect
+			name: "moved repository",
+			apps: strings.Replace(appsFile, "example/notes", "example/old-notes", 1),
+			args: []string{"-rewrite-app-file"},
+			want: exitChanged,
+			check: func(t *testing.T, r *testRepo, builder *index.Fake) {
+				if !r.forge.requested("api.github.com/repos/example/notes/releases") {
+					t.Errorf("releases weren't listed at the new location")
+				}
+				if _, err := os.Stat(filepath.Join(r.repoDir(), "notes_v1.0.apk")); err != nil {
+					t.Errorf("APK of moved repository wasn't downloaded: %s", err.Error())
+				}
+
+				content, err := os.ReadFile(filepath.Join(r.dir, "apps.yaml"))
+				if err != nil || string(content) != appsFile {
+					t.Errorf("app file wasn't updated to the new location:\n%s", content)
+				}
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRepo(t, tt.apps)
+			if tt.token != "" {
+				r.forge.token = tt.token
+				t.Setenv("METASCOOP_TOKEN_GITHUB_COM", tt.token)
+			}
+
+			builder := fakeBuilder()
+			builder.Err = tt.builderErr
+
+			if code := r.run(context.Background(), builder, tt.args...); code != tt.want {
+				t.Fatalf("run exited with code %d, want %d", code, tt.want)
+			}
+			if tt.check != nil {
+				tt.check(t, r, builder)
+			}
+		})
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	r := newTestRepo(t, appsFile+`missing:
+  git: https://github.com/example/missing
+`)
+
+	var (
+		reportPath  = filepath.Join(t.TempDir(), "report.json")
+		summaryPath = filepath.Join(t.TempDir(), "summary.md")
+	)
+	writeFile(t, summaryPath, "Previous step\n")
+	t.Setenv("GITHUB_STEP_SUMMARY", summaryPath)
+
+	if code := r.run(context.Background(), fakeBuilder(), "-report", reportPath); code != exitPartial {
+		t.Fatalf("run exited with code %d, want %d", code, exitPartial)
+	}
+
+	content, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report struct {
+		ExitCode int                      `json:"exit_code"`
+		Apps     []pipeline.AppReport     `json:"apps"`
+		Errors   []map[string]interface{} `json:"errors"`
+		Stages   []pipeline.StageTiming   `json:"stages"`
+		APICalls []pipeline.APIUsage      `json:"api_calls"`
+	}
+	if err := json.Unmarshal(content, &report); err != nil {
+		t.Fatalf("report isn't valid JSON: %s\n%s", err.Error(), content)
+	}
+
+	if report.ExitCode != exitPartial {
+		t.Errorf("report has exit code %d, want %d", report.ExitCode, exitPartial)
+	}
+
+	var notes *pipeline.AppReport
+	for i := range report.Apps {
+		if report.Apps[i].App == "notes" {
+			notes = &report.Apps[i]
+		}
+	}
+	if notes == nil {
+		t.Fatalf("report has no entry for notes:\n%s", content)
+	}
+
+	var statuses = make(map[string]pipeline.ReleaseStatus)
+	for _, rel := range notes.Releases {
+		statuses[rel.Tag] = rel.Status
+		if rel.Status == pipeline.ReleaseSkipped && rel.Reason == "" {
+			t.Errorf("skipped release %s has no reason", rel.Tag)
+		}
+	}
+	if statuses["v1.0"] != pipeline.ReleaseDownloaded || statuses["v1.1-beta"] != pipeline.ReleaseSkipped || statuses["v0.9"] != pipeline.ReleaseSkipped {
+		t.Errorf("report has release statuses %v, want v1.0 downloaded and the prerelease and draft skipped", statuses)
+	}
+	if len(notes.Downloaded) != 1 || notes.Downloaded[0] != "notes_v1.0.apk" {
+		t.Errorf("report has downloads %v, want notes_v1.0.apk", notes.Downloaded)
+	}
+
+	var fields = make(map[string]bool)
+	for _, f := range notes.FieldsChanged {
+		fields[f.Field] = true
+	}
+	if !fields["License"] || !fields["Summary"] {
+		t.Errorf("report has changed fields %+v, want License and Summary", notes.FieldsChanged)
+	}
+
+	if len(report.Errors) != 1 || report.Errors[0]["app"] != "missing" || report.Errors[0]["stage"] != string(pipeline.StageDiscover) {
+		t.Errorf("report has errors %v, want one of missing in discover", report.Errors)
+	}
+	if len(report.Stages) == 0 || report.Stages[0].Stage != pipeline.StageDiscover {
+		t.Errorf("report has stage timings %+v, want them to start with discover", report.Stages)
+	}
+	if len(report.APICalls) == 0 {
+		t.Errorf("report has no API calls")
+	}
+
+	summary, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Previous step\n", "exit code 3", "| notes | 3 | 1 | 2 |", "| missing | discover |"} {
+		if !strings.Contains(string(summary), want) {
+			t.Errorf("job summary doesn't contain %q:\n%s", want, summary)
+		}
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	r := newTestRepo(t, appsFile)
+
+	var (
+		repoDir      = r.repoDir()
+		partialPath  = filepath.Join(repoDir, "notes_v0.8.apk.tmp")
+		metaTempPath = filepath.Join(r.dir, "fdroid", "metadata", "com.example.notes.yml.tmp")
+	)
+	writeFile(t, partialPath, "partial download")
+	writeFile(t, metaTempPath, "unfinished write")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if code := r.run(ctx, fakeBuilder()); code != exitInterrupted {
+		t.Errorf("interrupted run exited with code %d, want %d", code, exitInterrupted)
+	}
+
+	if _, err := os.Stat(metaTempPath); err == nil {
+		t.Errorf("temporary file wasn't removed")
+	}
+	// The next run resumes the download
+	if _, err := os.Stat(partialPath); err != nil {
+		t.Errorf("partial download was removed: %s", err.Error())
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "notes_v1.0.apk")); err == nil {
+		t.Errorf("APK was downloaded after the run was interrupted")
+	}
+}
+
+func TestRunHealth(t *testing.T) {
+	r := newTestRepo(t, appsFile)
+
+	var (
+		args     = []string{"-health-action", "disable", "-health-grace-period", "0"}
+		dir      = r.dir
+		metaPath = filepath.Join(dir, "fdroid", "metadata", "com.example.notes.yml")
+	)
+
+	if code := r.run(context.Background(), fakeBuilder(), args...); code != 0 {
+		t.Fatalf("first run exited with code %d, want 0", code)
+	}
+
+	// The repository of notes is gone
+	writeFile(t, filepath.Join(dir, "apps.yaml"), strings.Replace(appsFile, "example/notes", "example/gone", 1))
+	if code := r.run(context.Background(), fakeBuilder(), args...); code != exitPartial {
+		t.Errorf("run with a deleted repository exited with code %d, want %d", code, exitPartial)
+	}
+
+	meta, err := apps.ReadMetaFile(metaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(meta.Disabled, "deleted") || meta.NoSourceSince != "1.0" {
+		t.Errorf("app of deleted repository has Disabled %q and NoSourceSince %q", meta.Disabled, meta.NoSourceSince)
+	}
+
+	state, err := os.ReadFile(filepath.Join(dir, "fdroid", "health.json"))
+	if err != nil || !strings.Contains(string(state), "com.example.notes") {
+		t.Errorf("health state doesn't list the disabled package: %q, %v", state, err)
+	}
+
+	// It is back, so the app is enabled again
+	writeFile(t, filepath.Join(dir, "apps.yaml"), appsFile)
+	if code := r.run(context.Background(), fakeBuilder(), args...); code != exitChanged {
+		t.Errorf("run with restored repository exited with code %d, want %d", code, exitChanged)
+	}
+
+	meta, err = apps.ReadMetaFile(metaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Disabled != "" || meta.NoSourceSince != "" {
+		t.Errorf("app of restored repository has Disabled %q and NoSourceSince %q", meta.Disabled, meta.NoSourceSince)
+	}
+}
@@ -3,8 +3,8 @@ package md
 import (
 	"bytes"
 	"fmt"
-	"html/template"
 	"os"
+	"text/template"
 
 	"metascoop/apps"
 )
@@ -17,42 +17,138 @@ const (
 	tableTmpl = `
 | Icon | Name | Description | Version |
 | --- | --- | --- | --- |{{range .Apps}}
-| <a href="{{.sourceCode}}"><img src="fdroid/repo/icons/{{.icon}}" alt="{{.name}} icon" width="36px" height="36px"></a> | [**{{.name}}**]({{.sourceCode}}) | {{.summary}} | {{.suggestedVersionName}} ({{.suggestedVersionCode}}) |{{end}}
-` + tableEnd
+| <a href="{{url .SourceCode}}"><img src="{{url .Icon}}" alt="{{attr .Name}} icon" width="36px" height="36px"></a> | [**{{md .Name}}**]({{url .SourceCode}}) | {{md .Summary}} | {{md .SuggestedVersionName}} ({{.SuggestedVersionCode}}) |{{end}}
+`
 )
 
-var tmpl = template.Must(template.New("").Parse(tableTmpl))
+// repoRegion is replaced with the links and QR code for adding the repo, if the README contains its markers
+var repoRegion = Region{Name: "repo"}
 
-func RegenerateReadme(readMePath string, index *apps.RepoIndex) (err error) {
+const repoTmpl = `
+Open [this link]({{url .Repo.AddURL}}) on your phone or copy it into your F-Droid client:
+
+` + "```" + `
+{{.Repo.AddURL}}
+` + "```" + `
+
+Alternatively, you can also scan the QR code:
+
+<p align="center">
+  <img src="{{url .Repo.QRCode}}" alt="F-Droid repo QR code" width="256px">
+</p>
+
+The fingerprint of the repo signing certificate is ` + "`{{.Repo.Fingerprint}}`" + `.
+`
+
+var (
+	tmpl         = template.Must(template.New("").Funcs(funcs).Parse(tableTmpl))
+	repoTemplate = template.Must(template.New("").Funcs(funcs).Parse(repoTmpl))
+)
+
+// RegenerateReadme replaces the apps table of the README with the built-in table. Icons are looked up in repoDir.
+// The links for adding the repo are written between "<!-- begin repo -->" and "<!-- end repo -->", if the README
+// contains these markers and the repo is signed
+func RegenerateReadme(readMePath, repoDir string, index *apps.RepoIndex) (err error) {
+	return regenerate(readMePath, repoDir, tmpl, index)
+}
+
+// RegenerateReadmeFromTemplate replaces the apps table of the README with the output of the template
+// in templatePath, which gets the same data as the built-in table
+func RegenerateReadmeFromTemplate(readMePath, templatePath, repoDir string, index *apps.RepoIndex) (err error) {
+	t, err := parseTemplate(templatePath)
+	if err != nil {
+		return
+	}
+
+	return regenerate(readMePath, repoDir, t, index)
+}
+
+func regenerate(readMePath, repoDir string, tmpl *template.Template, index *apps.RepoIndex) (err error) {
 	content, err := os.ReadFile(readMePath)
 	if err != nil {
 		return
 	}
 
-	var tableStartIndex = bytes.Index(content, []byte(tableStart))
-	if tableStartIndex < 0 {
-		return fmt.Errorf("cannot find table start in %q", readMePath)
+	data, err := newOutputData(index, repoDir, readMePath)
+	if err != nil {
+		return
 	}
 
-	var tableEndIndex = bytes.Index(content, []byte(tableEnd))
-	if tableEndIndex < 0 {
-		return fmt.Errorf("cannot find table end in %q", readMePath)
+	newContent, err := replaceRegion(content, tableStart, tableEnd, tmpl, data)
+	if err != nil {
+		return fmt.Errorf("%q: %w", readMePath, err)
+	}
+
+	start, end := repoRegion.markers()
+	if data.Repo.AddURL != "" && bytes.Contains(newContent, []byte(start)) {
+		newContent, err = replaceRegion(newContent, start, end, repoTemplate, data)
+		if err != nil {
+			return fmt.Errorf("%q: %w", readMePath, err)
+		}
 	}
 
-	var table bytes.Buffer
+	return os.WriteFile(readMePath, newContent, os.ModePerm)
+}
 
-	table.WriteString(tableStart)
+// replaceRegion replaces the text between the start and end markers in content with the output of tmpl
+func replaceRegion(content []byte, start, end string, tmpl *template.Template, data *Data) (newContent []byte, err error) {
+	var text bytes.Buffer
 
-	err = tmpl.Execute(&table, index)
+	err = tmpl.Execute(&text, data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	newContent := []byte{}
+	return replaceText(content, start, end, text.Bytes())
+}
 
-	newContent = append(newContent, content[:tableStartIndex]...)
-	newContent = append(newContent, table.Bytes()...)
-	newContent = append(newContent, content[tableEndIndex:]...)
+// replaceText replaces the text between the start and end markers in content
+func replaceText(content []byte, start, end string, text []byte) (newContent []byte, err error) {
+	var startIndex = bytes.Index(content, []byte(start))
+	if startIndex < 0 {
+		return nil, fmt.Errorf("cannot find start marker %q", start)
+	}
 
-	return os.WriteFile(readMePath, newContent, os.ModePerm)
+	var endIndex = bytes.Index(content[startIndex:], []byte(end))
+	if endIndex < 0 {
+		return nil, fmt.Errorf("cannot find end marker %q", end)
+	}
+	endIndex += startIndex
+
+	// Text in an indented region, e.g. in a list item, gets the same indentation so it stays there
+	prefix := markerIndent(content, startIndex)
+
+	var region bytes.Buffer
+
+	region.WriteString(start)
+	region.Write(indent(text, prefix))
+
+	// The end marker that follows must be on its own line
+	if !bytes.HasSuffix(region.Bytes(), []byte("\n")) {
+		region.WriteString("\n")
+	}
+	region.Write(prefix)
+
+	newContent = append(newContent, content[:startIndex]...)
+	newContent = append(newContent, region.Bytes()...)
+	newContent = append(newContent, content[endIndex:]...)
+
+	return
+}
+
+// WriteRegion replaces the region with the given name of the file at path with text
+func WriteRegion(path, name, text string) (err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	start, end := Region{Name: name}.markers()
+
+	newContent, err := replaceText(content, start, end, []byte("\n"+text))
+	if err != nil {
+		return fmt.Errorf("%q: %w", path, err)
+	}
+
+	return os.WriteFile(path, newContent, 0o644)
 }
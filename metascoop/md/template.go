@@ -0,0 +1,253 @@
+package md
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"metascoop/apps"
+	"metascoop/qr"
+	"metascoop/text"
+)
+
+// Output is a file that is generated from templates. Templates get a Data and can use the functions in funcs.
+// They are text templates, so values must be escaped with md, url or attr where needed
+type Output struct {
+	// Path is the file that is written
+	Path string `yaml:"path"`
+	// Template generates the whole file. If it is empty, only the regions of the existing file are replaced
+	Template string `yaml:"template"`
+	// Regions are parts of the file that are generated
+	Regions []Region `yaml:"regions"`
+}
+
+// Region is a part of a file between the markers "<!-- begin NAME -->" and "<!-- end NAME -->"
+type Region struct {
+	Name string `yaml:"name"`
+	// Template is the path of the template that generates the region
+	Template string `yaml:"template"`
+}
+
+func (r Region) markers() (start, end string) {
+	return "<!-- begin " + r.Name + " -->", "<!-- end " + r.Name + " -->"
+}
+
+// markerIndent returns the spaces and tabs before the marker at index i of content, if nothing else precedes
+// it on its line
+func markerIndent(content []byte, i int) []byte {
+	prefix := content[bytes.LastIndexByte(content[:i], '\n')+1 : i]
+	if len(bytes.Trim(prefix, " \t")) > 0 {
+		return nil
+	}
+	return prefix
+}
+
+// indent adds prefix to the lines of text after the first one, which continues the line of the start marker.
+// Empty lines are left alone
+func indent(text, prefix []byte) []byte {
+	if len(prefix) == 0 {
+		return text
+	}
+
+	lines := bytes.Split(text, []byte("\n"))
+	for i := 1; i < len(lines); i++ {
+		if len(lines[i]) > 0 {
+			lines[i] = append(append([]byte{}, prefix...), lines[i]...)
+		}
+	}
+
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// placeholderIcon is shown for apps without icon
+//
+//go:embed placeholder-icon.svg
+var placeholderIcon []byte
+
+// placeholderName is the file the placeholder icon is written to, next to the repo directory
+const placeholderName = "placeholder-icon.svg"
+
+// qrCodeName is the file name without extension of the QR code images, which are written next to the repo directory
+const qrCodeName = "repo-qrcode"
+
+// markdownEscaper escapes the characters that have a meaning in Markdown, in tables or in inline HTML
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"`", "\\`",
+	"*", "\\*",
+	"_", "\\_",
+	"[", "\\[",
+	"]", "\\]",
+	"<", "\\<",
+	">", "\\>",
+	"|", "\\|",
+	"~", "\\~",
+	"&", "\\&",
+	"#", "\\#",
+	"\r\n", " ",
+	"\n", " ",
+)
+
+// urlEscaper escapes the characters that end a Markdown link target or an HTML attribute
+var urlEscaper = strings.NewReplacer(
+	" ", "%20",
+	"(", "%28",
+	")", "%29",
+	"<", "%3C",
+	">", "%3E",
+	"\"", "%22",
+	"'", "%27",
+	"|", "%7C",
+)
+
+// funcs can be used in all templates
+var funcs = template.FuncMap{
+	// md escapes text for Markdown, also inside table cells
+	"md": func(s string) string {
+		return markdownEscaper.Replace(s)
+	},
+	// url escapes a URL or path for a Markdown link or an HTML attribute
+	"url": func(s string) string {
+		return urlEscaper.Replace(s)
+	},
+	// attr escapes text for an HTML attribute
+	"attr": html.EscapeString,
+	// size formats a number of bytes, e.g. "4.2 MiB"
+	"size": text.FormatSize,
+	// date formats a time as "2006-01-02"
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	},
+	// join joins a list like the categories of an app
+	"join": strings.Join,
+}
+
+// Generate writes the output file from its templates. Icons are looked up in repoDir
+func Generate(out Output, repoDir string, index *apps.RepoIndex) (err error) {
+	data, err := newOutputData(index, repoDir, out.Path)
+	if err != nil {
+		return
+	}
+
+	var content []byte
+
+	if out.Template != "" {
+		t, err := parseTemplate(out.Template)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		err = t.Execute(&buf, data)
+		if err != nil {
+			return fmt.Errorf("executing template %q: %w", out.Template, err)
+		}
+		content = buf.Bytes()
+	} else {
+		content, err = os.ReadFile(out.Path)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, region := range out.Regions {
+		t, err := parseTemplate(region.Template)
+		if err != nil {
+			return err
+		}
+
+		start, end := region.markers()
+
+		content, err = replaceRegion(content, start, end, t, data)
+		if err != nil {
+			return fmt.Errorf("region %q of %q: %w", region.Name, out.Path, err)
+		}
+	}
+
+	return os.WriteFile(out.Path, content, 0o644)
+}
+
+// newOutputData returns the data for the output file at path, and writes the placeholder icon if it is used
+func newOutputData(index *apps.RepoIndex, repoDir, path string) (data *Data, err error) {
+	baseDir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+	repoDir, err = filepath.Abs(repoDir)
+	if err != nil {
+		return
+	}
+
+	data, err = NewData(index, repoDir, baseDir)
+	if err != nil {
+		return
+	}
+
+	err = data.WriteFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// WriteFiles writes the files the data links to next to the repo directory: the placeholder icon if an app
+// has no icon, and the QR code images if the repo has an AddURL
+func (d *Data) WriteFiles() (err error) {
+	if d.usesPlaceholder {
+		err = writePlaceholderIcon(d.repoDir)
+		if err != nil {
+			return
+		}
+	}
+
+	if d.Repo.AddURL != "" {
+		for _, ext := range []string{".png", ".svg"} {
+			err = qr.Write(qrCodePath(d.repoDir, ext), d.Repo.AddURL)
+			if err != nil {
+				return fmt.Errorf("writing QR code: %w", err)
+			}
+		}
+	}
+
+	return
+}
+
+// writePlaceholderIcon writes the icon that is shown for apps without icon next to repoDir, if it doesn't exist
+func writePlaceholderIcon(repoDir string) (err error) {
+	_, err = os.Stat(placeholderPath(repoDir))
+	if errors.Is(err, os.ErrNotExist) {
+		err = os.WriteFile(placeholderPath(repoDir), placeholderIcon, 0o644)
+	}
+	if err != nil {
+		return fmt.Errorf("writing placeholder icon: %w", err)
+	}
+
+	return
+}
+
+func placeholderPath(repoDir string) string {
+	return filepath.Join(filepath.Dir(repoDir), placeholderName)
+}
+
+func qrCodePath(repoDir, ext string) string {
+	return filepath.Join(filepath.Dir(repoDir), qrCodeName+ext)
+}
+
+func parseTemplate(path string) (t *template.Template, err error) {
+	t, err = template.New(filepath.Base(path)).Funcs(funcs).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+	return
+}
@@ -0,0 +1,212 @@
+package md
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"metascoop/apps"
+)
+
+// testIndex has an app with icons in two densities and one without any icon
+func testIndex() *apps.RepoIndex {
+	return &apps.RepoIndex{
+		Repo: map[string]interface{}{"name": "Test repo", "timestamp": float64(1700000000000)},
+		Apps: []map[string]interface{}{
+			{
+				"packageName":          "com.example.notes",
+				"name":                 "Notes",
+				"summary":              "Take *notes* | share them",
+				"license":              "MIT",
+				"sourceCode":           "https://github.com/example/notes",
+				"categories":           []interface{}{"Writing", "Office"},
+				"antiFeatures":         []interface{}{"NonFreeNet"},
+				"lastUpdated":          float64(1700000000000),
+				"suggestedVersionName": "1.0",
+				"suggestedVersionCode": "10",
+				"icon":                 "com.example.notes.10.png",
+			},
+			{
+				"packageName":          "com.example.timer",
+				"suggestedVersionName": "2.0",
+				"suggestedVersionCode": "20",
+				"localized": map[string]interface{}{
+					"en-US": map[string]interface{}{"name": "Timer", "summary": "Count down"},
+				},
+			},
+		},
+		Packages: map[string][]apps.PackageInfo{
+			"com.example.notes": {
+				{VersionCode: 9, VersionName: "0.9", Size: 1000},
+				{VersionCode: 10, VersionName: "1.0", Size: 3 * 1024 * 1024},
+			},
+			"com.example.timer": {
+				{VersionCode: 20, VersionName: "2.0", Size: 2048},
+			},
+		},
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setupRepo creates a directory with a README next to fdroid/repo, which has icons of the notes app
+func setupRepo(t *testing.T) (dir, repoDir string) {
+	dir = t.TempDir()
+	repoDir = filepath.Join(dir, "fdroid", "repo")
+
+	writeTestFile(t, filepath.Join(repoDir, "icons-160", "com.example.notes.10.png"), "icon")
+	writeTestFile(t, filepath.Join(repoDir, "icons-320", "com.example.notes.10.png"), "icon")
+	writeTestFile(t, filepath.Join(dir, "README.md"), "# Apps\n\n"+tableStart+"\n"+tableEnd+"\n\nFooter\n")
+
+	return
+}
+
+func TestRegenerateReadme(t *testing.T) {
+	dir, repoDir := setupRepo(t)
+	readmePath := filepath.Join(dir, "README.md")
+
+	// Running it again must not change anything
+	for i := 0; i < 2; i++ {
+		err := RegenerateReadme(readmePath, repoDir, testIndex())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readme, err := os.ReadFile(readmePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`<img src="fdroid/repo/icons-320/com.example.notes.10.png" alt="Notes icon"`,
+		`[**Notes**](https://github.com/example/notes) | Take \*notes\* \| share them | 1.0 (10) |`,
+		`<img src="fdroid/placeholder-icon.svg" alt="Timer icon"`,
+		`[**Timer**]() | Count down | 2.0 (20) |`,
+	} {
+		if !strings.Contains(string(readme), want) {
+			t.Errorf("README doesn't contain %q:\n%s", want, readme)
+		}
+	}
+	if !strings.HasSuffix(string(readme), "\n"+tableEnd+"\n\nFooter\n") {
+		t.Errorf("README text after the table was changed:\n%s", readme)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "fdroid", "placeholder-icon.svg")); err != nil {
+		t.Errorf("placeholder icon wasn't written: %s", err.Error())
+	}
+}
+
+func TestRegenerateReadmeRepoLinks(t *testing.T) {
+	dir, repoDir := setupRepo(t)
+	readmePath := filepath.Join(dir, "README.md")
+
+	keystore, err := filepath.Abs(filepath.Join("..", "index", "testdata", "keystore.p12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "fdroid", "config.yml"), "repo_url: https://example.com/fdroid/repo\nkeystore: "+keystore+"\nkeystorepass: testpass\nrepo_keyalias: repokey\n")
+	writeTestFile(t, readmePath, "# Apps\n"+tableStart+"\n"+tableEnd+"\n## Install\n1. Install F-Droid\n2. Add the repo\n   <!-- begin repo -->\n   previous links\n   <!-- end repo -->\n3. Install the apps\n")
+
+	index := testIndex()
+	index.Repo["address"] = "https://example.com/fdroid/repo"
+
+	err = RegenerateReadme(readmePath, repoDir, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readme, err := os.ReadFile(readmePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		// The region is indented like its markers, so it stays in the list item
+		"\n   https://example.com/fdroid/repo?fingerprint=",
+		"\n     <img src=\"fdroid/repo-qrcode.png\"",
+		"\n\n   The fingerprint",
+		"\n   <!-- end repo -->\n3. Install the apps\n",
+	} {
+		if !strings.Contains(string(readme), want) {
+			t.Errorf("README doesn't contain %q:\n%s", want, readme)
+		}
+	}
+	if strings.Contains(string(readme), "previous links") {
+		t.Errorf("README still contains the old repo region:\n%s", readme)
+	}
+
+	for _, name := range []string{"repo-qrcode.png", "repo-qrcode.svg"} {
+		if _, err := os.Stat(filepath.Join(dir, "fdroid", name)); err != nil {
+			t.Errorf("QR code wasn't written: %s", err.Error())
+		}
+	}
+}
+
+func TestNewDataWithoutIcons(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "fdroid", "repo")
+
+	data, err := NewData(testIndex(), repoDir, filepath.Dir(filepath.Dir(repoDir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, app := range data.Apps {
+		if app.Icon != "fdroid/placeholder-icon.svg" || len(app.Icons) != 0 {
+			t.Errorf("%s has icon %q and icons %v, want only the placeholder", app.PackageName, app.Icon, app.Icons)
+		}
+	}
+	if !data.usesPlaceholder {
+		t.Errorf("data doesn't use the placeholder")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	dir, repoDir := setupRepo(t)
+
+	writeTestFile(t, filepath.Join(dir, "catalogue.tmpl"), `{{range .Apps}}{{md .Name}} ({{.License}}, {{join .Categories ", "}}, {{join .AntiFeatures ", "}}) updated {{date .LastUpdated}}, {{size .DownloadSize}}:{{range .Versions}} {{.Name}}{{end}}
+{{end}}`)
+	writeTestFile(t, filepath.Join(dir, "count.tmpl"), `{{len .Apps}} apps in {{.Repo.Name}}`)
+	writeTestFile(t, filepath.Join(dir, "docs", "page.md"), "# Apps\n<!-- begin count -->\nold\n<!-- end count -->\nfooter\n")
+
+	catalogue := Output{Path: filepath.Join(dir, "catalogue.md"), Template: filepath.Join(dir, "catalogue.tmpl")}
+	page := Output{Path: filepath.Join(dir, "docs", "page.md"), Regions: []Region{{Name: "count", Template: filepath.Join(dir, "count.tmpl")}}}
+
+	for _, out := range []Output{catalogue, page, page} {
+		err := Generate(out, repoDir, testIndex())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, want := range map[string]string{
+		catalogue.Path: "Notes (MIT, Writing, Office, NonFreeNet) updated 2023-11-14, 3.0 MiB: 1.0 0.9\nTimer (, , ) updated , 2.0 KiB: 2.0\n",
+		page.Path:      "# Apps\n<!-- begin count -->2 apps in Test repo\n<!-- end count -->\nfooter\n",
+	} {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s has content\n%q\nwant\n%q", filepath.Base(path), got, want)
+		}
+	}
+
+	err := Generate(Output{Path: page.Path, Regions: []Region{{Name: "missing", Template: filepath.Join(dir, "count.tmpl")}}}, repoDir, testIndex())
+	if err == nil {
+		t.Errorf("region without markers didn't return an error")
+	}
+}
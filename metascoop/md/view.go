@@ -0,0 +1,331 @@
+package md
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"metascoop/apps"
+	fdroidindex "metascoop/index"
+)
+
+// iconDensities are the densities of the "icons-*" directories fdroid writes, highest density first
+var iconDensities = []string{"640", "480", "320", "240", "160", "120"}
+
+// Data is what templates get
+type Data struct {
+	Apps []App
+	Repo Repo
+	// Index is the raw index, for fields that are not in the view model
+	Index *apps.RepoIndex
+	// usesPlaceholder is set if an app has no icon
+	usesPlaceholder bool
+	repoDir         string
+}
+
+// Repo describes the F-Droid repo
+type Repo struct {
+	Name        string
+	Description string
+	Address     string
+	Timestamp   time.Time
+
+	// Fingerprint is the SHA-256 fingerprint of the signing certificate, if the repo is signed
+	Fingerprint string
+	// AddURL is the address with the fingerprint. Opened on a phone, it asks to add the repo to the F-Droid client
+	AddURL string
+	// FdroidURL is AddURL with the fdroidrepos:// scheme, which is only opened by F-Droid clients
+	FdroidURL string
+	// QRCode and QRCodeSVG are the PNG and SVG images of a QR code of AddURL
+	QRCode    string
+	QRCodeSVG string
+}
+
+// App is an app of the index joined with its packages. Paths are relative to the directory of the generated file
+type App struct {
+	PackageName string
+	Name        string
+	Summary     string
+	License     string
+	AuthorName  string
+	SourceCode  string
+	WebSite     string
+	// Description is HTML with the tags F-Droid supports
+	Description string
+	// WhatsNew are the release notes of the suggested version
+	WhatsNew string
+
+	Categories   []string
+	AntiFeatures []string
+
+	Added       time.Time
+	LastUpdated time.Time
+
+	SuggestedVersionName string
+	SuggestedVersionCode int
+
+	// Icon is the icon with the highest density, or a placeholder if the app has no icon
+	Icon string
+	// Icons are the available icons by density, e.g. "640"
+	Icons map[string]string
+	// Screenshots are the phone and tablet screenshots
+	Screenshots []string
+
+	// Versions are all packages of the app, newest first
+	Versions []Version
+}
+
+// Latest returns the newest version, which is the zero value if there is none
+func (a App) Latest() (v Version) {
+	if len(a.Versions) > 0 {
+		v = a.Versions[0]
+	}
+	return
+}
+
+// DownloadSize is the size of the newest APK
+func (a App) DownloadSize() int64 {
+	return a.Latest().Size
+}
+
+// Version is a package of an app
+type Version struct {
+	Name             string
+	Code             int
+	ApkName          string
+	Size             int64
+	Added            time.Time
+	MinSdkVersion    int
+	TargetSdkVersion int
+	// Changelog is the changelog from the metadata directory, if there is one
+	Changelog string
+}
+
+// screenshotTypes are the screenshot directories shown, phone screenshots first
+var screenshotTypes = []string{"phoneScreenshots", "sevenInchScreenshots", "tenInchScreenshots"}
+
+// indexApp are the fields of an app entry of index-v1.json that are shown
+type indexApp struct {
+	PackageName          string      `json:"packageName"`
+	Name                 string      `json:"name"`
+	Summary              string      `json:"summary"`
+	License              string      `json:"license"`
+	AuthorName           string      `json:"authorName"`
+	SourceCode           string      `json:"sourceCode"`
+	WebSite              string      `json:"webSite"`
+	Description          string      `json:"description"`
+	Categories           []string    `json:"categories"`
+	AntiFeatures         []string    `json:"antiFeatures"`
+	Added                int64       `json:"added"`
+	LastUpdated          int64       `json:"lastUpdated"`
+	SuggestedVersionName string      `json:"suggestedVersionName"`
+	SuggestedVersionCode json.Number `json:"suggestedVersionCode"`
+	Icon                 string      `json:"icon"`
+	Localized            map[string]struct {
+		Name                 string   `json:"name"`
+		Summary              string   `json:"summary"`
+		Description          string   `json:"description"`
+		WhatsNew             string   `json:"whatsNew"`
+		Icon                 string   `json:"icon"`
+		PhoneScreenshots     []string `json:"phoneScreenshots"`
+		SevenInchScreenshots []string `json:"sevenInchScreenshots"`
+		TenInchScreenshots   []string `json:"tenInchScreenshots"`
+	} `json:"localized"`
+}
+
+// NewData joins the apps of the index with their packages and finds their icons in repoDir and their changelogs
+// in the metadata directory next to it. Paths are made relative to baseDir, the directory of the generated file
+func NewData(index *apps.RepoIndex, repoDir, baseDir string) (data *Data, err error) {
+	metadataDir := filepath.Join(filepath.Dir(repoDir), "metadata")
+
+	data = &Data{Index: index, repoDir: repoDir}
+
+	data.Repo = Repo{
+		Name:        stringField(index.Repo, "name"),
+		Description: stringField(index.Repo, "description"),
+		Address:     stringField(index.Repo, "address"),
+	}
+	if ms, ok := index.Repo["timestamp"].(float64); ok {
+		data.Repo.Timestamp = fromMillis(int64(ms))
+	}
+
+	// Without a signed index or keystore, e.g. in debug mode, there are no links with a fingerprint
+	if fingerprint, err := fdroidindex.RepoFingerprint(repoDir); err == nil && data.Repo.Address != "" {
+		data.Repo.Fingerprint = fingerprint
+		data.Repo.AddURL, data.Repo.FdroidURL = addRepoLinks(data.Repo.Address, fingerprint)
+		data.Repo.QRCode = relativePath(baseDir, qrCodePath(repoDir, ".png"))
+		data.Repo.QRCodeSVG = relativePath(baseDir, qrCodePath(repoDir, ".svg"))
+	}
+
+	for _, raw := range index.Apps {
+		// The app entries are untyped, converting them through JSON gives the types of the index
+		encoded, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		var ia indexApp
+		err = json.Unmarshal(encoded, &ia)
+		if err != nil {
+			return nil, err
+		}
+
+		app := App{
+			PackageName:          ia.PackageName,
+			Name:                 ia.Name,
+			Summary:              ia.Summary,
+			License:              ia.License,
+			AuthorName:           ia.AuthorName,
+			SourceCode:           ia.SourceCode,
+			WebSite:              ia.WebSite,
+			Description:          ia.Description,
+			Categories:           ia.Categories,
+			AntiFeatures:         ia.AntiFeatures,
+			Added:                fromMillis(ia.Added),
+			LastUpdated:          fromMillis(ia.LastUpdated),
+			SuggestedVersionName: ia.SuggestedVersionName,
+		}
+		app.SuggestedVersionCode, _ = strconv.Atoi(ia.SuggestedVersionCode.String())
+
+		// Newer fdroidserver versions only write the localized texts
+		localized := ia.Localized[apps.DefaultLocale]
+		if app.Name == "" {
+			app.Name = localized.Name
+		}
+		if app.Summary == "" {
+			app.Summary = localized.Summary
+		}
+		if app.Description == "" {
+			app.Description = localized.Description
+		}
+		app.WhatsNew = localized.WhatsNew
+
+		for i, names := range [][]string{localized.PhoneScreenshots, localized.SevenInchScreenshots, localized.TenInchScreenshots} {
+			for _, name := range names {
+				path := filepath.Join(repoDir, ia.PackageName, apps.DefaultLocale, screenshotTypes[i], name)
+				app.Screenshots = append(app.Screenshots, relativePath(baseDir, path))
+			}
+		}
+
+		for _, pkg := range index.Packages[ia.PackageName] {
+			var changelog string
+			if content, err := os.ReadFile(apps.ChangelogPath(metadataDir, ia.PackageName, apps.DefaultLocale, pkg.VersionCode)); err == nil {
+				changelog = string(content)
+			}
+
+			app.Versions = append(app.Versions, Version{
+				Name:             pkg.VersionName,
+				Code:             pkg.VersionCode,
+				ApkName:          pkg.ApkName,
+				Size:             int64(pkg.Size),
+				Added:            fromMillis(pkg.Added),
+				MinSdkVersion:    pkg.MinSdkVersion,
+				TargetSdkVersion: pkg.TargetSdkVersion,
+				Changelog:        changelog,
+			})
+		}
+		sort.SliceStable(app.Versions, func(i, j int) bool {
+			return app.Versions[i].Code > app.Versions[j].Code
+		})
+
+		names := iconNames(ia, app)
+
+		var icon string
+		app.Icons = make(map[string]string)
+		for _, density := range iconDensities {
+			if path := findIcon(filepath.Join(repoDir, "icons-"+density), names); path != "" {
+				app.Icons[density] = path
+				if icon == "" {
+					icon = path
+				}
+			}
+		}
+		// Older fdroidserver versions only wrote the "icons" directory
+		if icon == "" {
+			icon = findIcon(filepath.Join(repoDir, "icons"), names)
+		}
+		if icon == "" && localized.Icon != "" {
+			path := filepath.Join(repoDir, ia.PackageName, apps.DefaultLocale, localized.Icon)
+			if _, err := os.Stat(path); err == nil {
+				icon = path
+			}
+		}
+		if icon == "" {
+			icon = placeholderPath(repoDir)
+			data.usesPlaceholder = true
+		}
+		app.Icon = relativePath(baseDir, icon)
+
+		for density, path := range app.Icons {
+			app.Icons[density] = relativePath(baseDir, path)
+		}
+
+		data.Apps = append(data.Apps, app)
+	}
+
+	return
+}
+
+// iconNames are the possible file names of the icon of an app. fdroid names icons after the package name and
+// version code, so the icon of the suggested or any other version is used if the index has none
+func iconNames(ia indexApp, app App) (names []string) {
+	if ia.Icon != "" {
+		names = append(names, ia.Icon)
+	}
+	if app.SuggestedVersionCode != 0 {
+		names = append(names, ia.PackageName+"."+strconv.Itoa(app.SuggestedVersionCode)+".png")
+	}
+	for _, v := range app.Versions {
+		names = append(names, ia.PackageName+"."+strconv.Itoa(v.Code)+".png")
+	}
+	return
+}
+
+// findIcon returns the path of the first of names that exists in dir, or ""
+func findIcon(dir string, names []string) string {
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// addRepoLinks returns the links that add the repo at address with the given fingerprint to an F-Droid client
+func addRepoLinks(address, fingerprint string) (addURL, fdroidURL string) {
+	addURL = strings.TrimSuffix(address, "/") + "?fingerprint=" + fingerprint
+
+	switch {
+	case strings.HasPrefix(addURL, "https://"):
+		fdroidURL = "fdroidrepos://" + strings.TrimPrefix(addURL, "https://")
+	case strings.HasPrefix(addURL, "http://"):
+		fdroidURL = "fdroidrepo://" + strings.TrimPrefix(addURL, "http://")
+	}
+
+	return
+}
+
+func relativePath(baseDir, path string) string {
+	rel, err := filepath.Rel(baseDir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
+
+func stringField(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
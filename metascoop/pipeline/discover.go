@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"metascoop/apps"
+	"metascoop/forge"
+	"metascoop/stats"
+)
+
+// discover looks up all apps on their forges and finds the releases with APKs
+func (r *runner) discover(ctx context.Context) (err error) {
+	for _, app := range r.appsList {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		fmt.Printf("App: %s/%s\n", app.Author(), app.Name())
+
+		r.appReport(app.Name())
+
+		err = r.discoverApp(ctx, app)
+		if err != nil {
+			r.addError(app.Name(), StageDiscover, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *runner) discoverApp(ctx context.Context, app apps.AppInfo) (err error) {
+	repo, err := apps.RepoInfo(app.GitURL)
+	if err != nil {
+		return fmt.Errorf("getting repo info from URL %q: %w", app.GitURL, err)
+	}
+
+	details, err := r.lookupRepo(ctx, repo)
+	if errors.Is(err, forge.ErrNotFound) {
+		r.checkRepoHealth(app, repo, details, true)
+	}
+	if err != nil {
+		return fmt.Errorf("handling repository %s/%s: %w", repo.Author, repo.Name, err)
+	}
+
+	r.checkRepoHealth(app, repo, details, false)
+	r.followMove(&app, &repo, details)
+
+	app.Forge.Summary = details.Description
+	app.Forge.License = details.License
+
+	log.Printf("Data from %s: summary=%q, license=%q", repo.Host, app.Forge.Summary, app.Forge.License)
+
+	releases, err := r.forge(repo.Host).Releases(ctx, repo.Author, repo.Name)
+	if err != nil {
+		return fmt.Errorf("listing repo releases for %q: %w", app.GitURL, err)
+	}
+
+	log.Printf("Received %d releases", len(releases))
+
+	for _, rel := range releases {
+		if apk := apps.FindAPKRelease(rel); apk != nil {
+			details.Releases = append(details.Releases, stats.Release{Tag: rel.Tag, Downloads: apk.Downloads})
+		}
+	}
+	r.addSnapshot(app, repo, details)
+
+	// Releases are listed newest first, so the first ones are kept
+	var kept int
+	for _, rel := range releases {
+		fmt.Printf("::group::Release %s\n", rel.Tag)
+		if r.discoverRelease(app, repo, rel, r.cfg.Retention > 0 && kept >= r.cfg.Retention) {
+			kept++
+		}
+		fmt.Println("::endgroup::")
+	}
+
+	return nil
+}
+
+// discoverRelease remembers the APK of the release, and queues it for download if it's not in the repo yet.
+// If the release is expired because of the retention setting, its APK is removed instead.
+// ok is false if the release has no APK to publish
+func (r *runner) discoverRelease(app apps.AppInfo, repo apps.Repo, rel forge.Release, expired bool) (ok bool) {
+	var skip string
+	switch {
+	case rel.Prerelease:
+		skip = "prerelease"
+	case rel.Draft:
+		skip = "draft"
+	case rel.Tag == "":
+		skip = "empty tag name"
+	}
+	if skip != "" {
+		log.Printf("Skipping release %q: %s", rel.Tag, skip)
+		r.addRelease(app.Name(), rel.Tag, ReleaseSkipped, skip)
+		return false
+	}
+
+	log.Printf("Working on release with tag name %q", rel.Tag)
+
+	apk := apps.FindAPKRelease(rel)
+	if apk == nil {
+		log.Printf("Couldn't find a release asset with extension \".apk\"")
+		r.addRelease(app.Name(), rel.Tag, ReleaseSkipped, "no APK asset")
+		return false
+	}
+
+	appName := apps.GenerateReleaseFilename(app.Name(), rel.Tag)
+	appTargetPath := filepath.Join(r.cfg.RepoDir, appName)
+
+	if expired {
+		log.Printf("Release is older than the latest %d releases that are kept", r.cfg.Retention)
+		r.addRelease(app.Name(), rel.Tag, ReleaseExpired, fmt.Sprintf("older than the latest %d releases", r.cfg.Retention))
+
+		err := os.Remove(appTargetPath)
+		if err == nil {
+			log.Printf("Removed APK %q", appTargetPath)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Removing APK %q: %s", appTargetPath, err.Error())
+		}
+
+		return false
+	}
+
+	log.Printf("Target APK name: %s", appName)
+
+	appClone := app
+
+	appClone.ReleaseTag = rel.Tag
+	appClone.ReleaseURL = rel.URL
+	appClone.ChangelogAssets = apps.FindChangelogAssets(rel)
+	appClone.ReleaseDescription = rel.Notes
+	if appClone.ReleaseDescription != "" {
+		log.Printf("Release notes: %s", appClone.ReleaseDescription)
+	}
+
+	r.apkInfoMap[appName] = appClone
+
+	// If the app file already exists for this version, we don't download it again
+	if _, err := os.Stat(appTargetPath); !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Already have APK for version %q at %q", rel.Tag, appTargetPath)
+		r.addRelease(app.Name(), rel.Tag, ReleasePresent, "")
+		return true
+	}
+
+	r.releases = append(r.releases, release{
+		app:    appClone,
+		repo:   repo,
+		asset:  *apk,
+		path:   appTargetPath,
+		report: r.addRelease(app.Name(), rel.Tag, ReleaseQueued, ""),
+	})
+
+	return true
+}
@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/go-github/v39/github"
+	"metascoop/download"
+	"metascoop/forge"
+)
+
+// ErrTooManyFailures is returned by Run if more apps failed than Config.MaxFailedApps allows. The repo is
+// not updated then, as the failures are likely caused by something that affects all apps, e.g. a forge outage
+var ErrTooManyFailures = errors.New("too many apps failed")
+
+// isRetryable returns whether err will probably go away if the run is repeated later, e.g. because it was a
+// timeout, a rate limit or a server error. Errors like missing repositories or broken app files are not
+func isRetryable(stage Stage, err error) bool {
+	var (
+		rateLimitErr      *github.RateLimitError
+		abuseRateLimitErr *github.AbuseRateLimitError
+		githubErr         *github.ErrorResponse
+		statusErr         *forge.StatusError
+		netErr            net.Error
+	)
+
+	switch {
+	case errors.Is(err, forge.ErrNotFound), download.IsPermanent(err):
+		return false
+	case stage == StageFetch:
+		// Downloads that still fail after the retries of download.Client failed for reasons that can go away,
+		// e.g. timeouts or server errors, as the permanent errors were handled above
+		return true
+	case errors.As(err, &rateLimitErr), errors.As(err, &abuseRateLimitErr), errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.As(err, &githubErr) && githubErr.Response != nil:
+		return retryableStatus(githubErr.Response.StatusCode)
+	case errors.As(err, &statusErr):
+		return retryableStatus(statusErr.StatusCode)
+	case errors.As(err, &netErr):
+		return true
+	}
+
+	return false
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// FailedApps returns the apps that had errors, in the order of their first error
+func (r *Report) FailedApps() (failed []string) {
+	var seen = make(map[string]bool)
+	for _, e := range r.Errors {
+		if !seen[e.App] {
+			seen[e.App] = true
+			failed = append(failed, e.App)
+		}
+	}
+	return
+}
+
+// WriteFailures writes a table of the errors of the apps to w
+func (r *Report) WriteFailures(w io.Writer) (err error) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "App\tStage\tRetryable\tError")
+	for _, e := range r.Errors {
+		retryable := "no"
+		if e.Retryable {
+			retryable = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.App, e.Stage, retryable, strings.ReplaceAll(e.Err.Error(), "\n", " "))
+	}
+
+	return tw.Flush()
+}
+
+// checkFailures stops the run if more apps failed than allowed
+func (r *runner) checkFailures() error {
+	if r.cfg.MaxFailedApps <= 0 {
+		return nil
+	}
+
+	if failed := r.report.FailedApps(); len(failed) > r.cfg.MaxFailedApps {
+		return fmt.Errorf("%w: %d apps failed (%s), at most %d are allowed", ErrTooManyFailures, len(failed), strings.Join(failed, ", "), r.cfg.MaxFailedApps)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"metascoop/download"
+	"metascoop/forge"
+)
+
+func TestIsRetryable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.apk" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	downloadErr := func(path string) error {
+		client := download.Client{Retries: -1}
+		err := client.File(context.Background(), srv.URL+path, nil, filepath.Join(t.TempDir(), "app.apk"), 0)
+		if err == nil {
+			t.Fatalf("download of %s didn't fail", path)
+		}
+		return fmt.Errorf("downloading app: %w", err)
+	}
+
+	tests := []struct {
+		name  string
+		stage Stage
+		err   error
+		want  bool
+	}{
+		{"download with server error", StageFetch, downloadErr("/unavailable.apk"), true},
+		{"download of missing file", StageFetch, downloadErr("/missing.apk"), false},
+		{"download timeout", StageFetch, context.DeadlineExceeded, true},
+		{"missing repository", StageDiscover, fmt.Errorf("error accessing repository: %w", &forge.StatusError{URL: "https://codeberg.org/api/v1/repos/example/gone", StatusCode: http.StatusNotFound}), false},
+		{"forge server error", StageDiscover, &forge.StatusError{URL: "https://codeberg.org/api/v1/repos/example/timer", StatusCode: http.StatusBadGateway}, true},
+		{"forge client error", StageDiscover, &forge.StatusError{URL: "https://codeberg.org/api/v1/repos/example/timer", StatusCode: http.StatusForbidden}, false},
+		{"broken metadata", StageEnrichMetadata, errors.New("yaml: line 3: did not find expected key"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isRetryable(tt.stage, tt.err); got != tt.want {
+			t.Errorf("%s: isRetryable(%q, %v) = %t, want %t", tt.name, tt.stage, tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// fetch downloads the APKs of all discovered releases that are not in the repo yet, with up to
+// Config.Concurrency downloads at the same time
+func (r *runner) fetch(ctx context.Context) (err error) {
+	workers := r.cfg.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		queue = make(chan release)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for rel := range queue {
+				// Groups of concurrent downloads would be mixed up
+				if workers == 1 {
+					fmt.Printf("::group::Downloading %s\n", filepath.Base(rel.path))
+				}
+
+				err := r.fetchRelease(ctx, rel)
+
+				mu.Lock()
+				if err != nil {
+					r.addError(rel.app.Name(), StageFetch, err)
+					// Downloads that were stopped by an interruption are still queued
+					if ctx.Err() == nil {
+						rel.report.Status = ReleaseFailed
+						rel.report.Reason = err.Error()
+					}
+				} else {
+					r.report.Downloaded = append(r.report.Downloaded, filepath.Base(rel.path))
+					rel.report.Status = ReleaseDownloaded
+
+					a := r.appReport(rel.app.Name())
+					a.Downloaded = append(a.Downloaded, filepath.Base(rel.path))
+				}
+				mu.Unlock()
+
+				if workers == 1 {
+					fmt.Println("::endgroup::")
+				}
+			}
+		}()
+	}
+
+queueing:
+	for _, rel := range r.releases {
+		select {
+		case queue <- rel:
+		case <-ctx.Done():
+			break queueing
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	sort.Strings(r.report.Downloaded)
+
+	return ctx.Err()
+}
+
+func (r *runner) fetchRelease(ctx context.Context, rel release) (err error) {
+	log.Printf("Downloading APK %q from release %q to %q", rel.asset.Name, rel.app.ReleaseTag, rel.path)
+
+	err = r.cfg.Downloads.File(ctx, rel.asset.URL, http.Header{"Accept": {"application/octet-stream"}}, rel.path, rel.asset.Size)
+	if err != nil {
+		return fmt.Errorf("downloading app %q (asset %q) from release %q to %q: %w", rel.app.GitURL, rel.asset.Name, rel.app.ReleaseTag, rel.path, err)
+	}
+
+	log.Printf("Successfully downloaded app for version %q", rel.app.ReleaseTag)
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"metascoop/apps"
+	"metascoop/forge"
+	"metascoop/stats"
+)
+
+// repoDetails is what a forge tells about a repository
+type repoDetails struct {
+	// FullName is "owner/name" as the forge knows it, which changes if the repository was renamed or transferred
+	FullName    string
+	Description string
+	// License is the SPDX identifier of the license the forge detected
+	License    string
+	Stars      int
+	Forks      int
+	OpenIssues int
+	Archived   bool
+	// PushedAt is the last push, or the last activity if the forge doesn't tell about pushes
+	PushedAt time.Time
+	// LatestRelease is the tag of the newest release, if there is one
+	LatestRelease   string
+	LatestReleaseAt time.Time
+	// Releases are the download counts of the APKs, newest release first, if the forge counts downloads
+	Releases []stats.Release
+}
+
+// forge returns the forge of host, or nil if it is unknown
+func (r *runner) forge(host string) forge.Forge {
+	return r.cfg.Forges.ForHost(host, r.githubClient, r.httpClient)
+}
+
+// lookupRepo asks the forge hosting repo about it. It doesn't fill in the releases
+func (r *runner) lookupRepo(ctx context.Context, repo apps.Repo) (details repoDetails, err error) {
+	f := r.forge(repo.Host)
+	if f == nil {
+		return details, fmt.Errorf("unsupported host: %s", repo.Host)
+	}
+
+	log.Printf("Looking up %s/%s on %s", repo.Author, repo.Name, repo.Host)
+
+	fr, err := f.Repository(ctx, repo.Author, repo.Name)
+	if err != nil {
+		return details, fmt.Errorf("error accessing repository: %w", err)
+	}
+
+	details = repoDetails{
+		FullName:        fr.FullName,
+		Description:     fr.Description,
+		License:         fr.License,
+		Stars:           fr.Stars,
+		Forks:           fr.Forks,
+		OpenIssues:      fr.OpenIssues,
+		Archived:        fr.Archived,
+		PushedAt:        fr.PushedAt,
+		LatestRelease:   fr.LatestRelease,
+		LatestReleaseAt: fr.LatestReleaseAt,
+	}
+
+	log.Printf("Repository Name: %s", details.FullName)
+	log.Printf("Description: %s", details.Description)
+	log.Printf("Stars: %d", details.Stars)
+	log.Printf("Forks: %d", details.Forks)
+
+	if details.LatestRelease != "" {
+		log.Printf("Latest Release: %s", details.LatestRelease)
+		log.Printf("Published at: %s", details.LatestReleaseAt.String())
+	} else {
+		log.Printf("No releases found for %s/%s", repo.Author, repo.Name)
+	}
+
+	return
+}
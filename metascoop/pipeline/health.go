@@ -0,0 +1,246 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"metascoop/apps"
+	"metascoop/health"
+)
+
+// HealthAction is what happens to the apps of repositories that are abandoned for longer than the grace period
+type HealthAction string
+
+const (
+	// HealthWarn only warns about the problems
+	HealthWarn HealthAction = "warn"
+	// HealthMark sets NoSourceSince in the metadata of apps whose repository was deleted
+	HealthMark HealthAction = "mark"
+	// HealthDisable also sets Disabled in the metadata of apps whose repository is abandoned, which removes
+	// them from the index
+	HealthDisable HealthAction = "disable"
+)
+
+// HealthOptions configures the checks of the app repositories
+type HealthOptions struct {
+	Checks health.Checks
+	// Action is taken once the problems of a repository last longer than GracePeriod. The empty action only warns
+	Action      HealthAction
+	GracePeriod time.Duration
+}
+
+func (r *runner) healthPath() string {
+	return filepath.Join(r.fdroidDir(), health.StateName)
+}
+
+// checkRepoHealth remembers the problems of the repository of an app for checkHealth. details are ignored if
+// the repository was deleted
+func (r *runner) checkRepoHealth(app apps.AppInfo, repo apps.Repo, details repoDetails, deleted bool) {
+	r.healthFindings[app.Name()] = r.cfg.Health.Checks.Check(time.Now(), health.Repository{
+		Name:            repo.Author + "/" + repo.Name,
+		Deleted:         deleted,
+		FullName:        details.FullName,
+		Archived:        details.Archived,
+		PushedAt:        details.PushedAt,
+		LatestRelease:   details.LatestRelease,
+		LatestReleaseAt: details.LatestReleaseAt,
+	})
+}
+
+// checkHealth warns about the problems of the app repositories and updates the metadata of abandoned apps
+// according to the health action. Metadata that was changed before is restored once the problems are gone
+func (r *runner) checkHealth(ctx context.Context) (err error) {
+	fmt.Println("::group::Checking repository health")
+	defer fmt.Println("::endgroup::")
+
+	r.health, err = health.ReadState(r.healthPath())
+	if err != nil {
+		return fmt.Errorf("reading health state: %w", err)
+	}
+
+	now := time.Now()
+
+	for _, app := range r.appsList {
+		findings, ok := r.healthFindings[app.Name()]
+		if !ok {
+			// The app couldn't be checked, e.g. because the forge wasn't reachable
+			continue
+		}
+
+		state := r.health.Update(app.Name(), findings, now)
+
+		for _, f := range findings {
+			log.Printf("Health of %q: %s", app.Name(), f.Detail)
+			fmt.Printf("::warning title=%s::%s\n", app.Name(), f.Detail)
+		}
+
+		if r.healthAction() != HealthWarn && state.Abandoned() {
+			if due := state.Since.Add(r.cfg.Health.GracePeriod); now.Before(due) {
+				log.Printf("Action %q will be taken for %q on %s", r.healthAction(), app.Name(), due.Format("2006-01-02"))
+			}
+		}
+	}
+
+	err = filepath.WalkDir(r.metadataDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".yml") {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		pkgname := strings.TrimSuffix(filepath.Base(path), ".yml")
+
+		name, ok := r.appOfPackage(pkgname)
+		if !ok {
+			return nil
+		}
+		if _, ok := r.healthFindings[name]; !ok {
+			return nil
+		}
+
+		err = r.applyHealth(path, pkgname, name, now)
+		if err != nil {
+			r.addError(name, StageCheckHealth, err)
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("walking metadata: %w", err)
+	}
+
+	// The state is only written once there is something to remember
+	if _, statErr := os.Stat(r.healthPath()); len(r.health.Apps) == 0 && errors.Is(statErr, os.ErrNotExist) {
+		return nil
+	}
+
+	err = r.health.Write(r.healthPath())
+	if err != nil {
+		return fmt.Errorf("writing health state: %w", err)
+	}
+
+	return nil
+}
+
+func (r *runner) healthAction() HealthAction {
+	if r.cfg.Health.Action == "" {
+		return HealthWarn
+	}
+	return r.cfg.Health.Action
+}
+
+// applyHealth sets or removes Disabled and NoSourceSince in the metadata file of a package of the app name
+func (r *runner) applyHealth(path, pkgname, name string, now time.Time) (err error) {
+	state := r.health.App(name)
+	due := state.Abandoned() && !now.Before(state.Since.Add(r.cfg.Health.GracePeriod))
+
+	var disabled, noSourceSince string
+	if due && r.healthAction() == HealthDisable {
+		var problems []string
+		for _, p := range state.Problems {
+			if p.Abandoned() {
+				problems = append(problems, string(p))
+			}
+		}
+		disabled = fmt.Sprintf("Upstream repository is %s since %s", strings.Join(problems, ", "), state.Since.Format("2006-01-02"))
+	}
+
+	meta, err := apps.ReadMetaFile(path)
+	if err != nil {
+		return fmt.Errorf("reading meta file %q: %w", path, err)
+	}
+
+	if due && state.Has(health.Deleted) && (r.healthAction() == HealthMark || r.healthAction() == HealthDisable) {
+		noSourceSince = meta.CurrentVersion
+		if noSourceSince == "" {
+			if latest, ok := r.initialIndex.FindLatestPackage(pkgname); ok {
+				noSourceSince = latest.VersionName
+			}
+		}
+	}
+
+	var changed bool
+	set := func(field *string, applied *string, value, fieldName string) {
+		switch {
+		case value != "" && (*field == "" || *field == *applied) && *field != value:
+			log.Printf("Setting %s of %q to %q", fieldName, pkgname, value)
+			*field = value
+			*applied = value
+			changed = true
+		case value == "" && *applied != "" && *field == *applied:
+			log.Printf("Removing %s of %q, the repository of %q has no problems anymore", fieldName, pkgname, name)
+			*field = ""
+			*applied = ""
+			changed = true
+		case value == "" && *applied != "":
+			// The field was changed by hand, so it's left as it is
+			*applied = ""
+		}
+	}
+
+	set(&meta.Disabled, &state.Disabled, disabled, "Disabled")
+	set(&meta.NoSourceSince, &state.NoSourceSince, noSourceSince, "NoSourceSince")
+
+	state.SetPackage(pkgname, state.Disabled != "" || state.NoSourceSince != "")
+
+	if !changed {
+		return
+	}
+
+	r.addFieldChanges(name, pkgname, meta.Changes(), func(string) string { return "health" })
+
+	err = apps.WriteMetaFile(path, meta)
+	if err != nil {
+		return fmt.Errorf("writing meta file %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// appOrPackage returns the name of the app that publishes the package, or the package name if it is unknown
+func (r *runner) appOrPackage(pkgname string) string {
+	if name, ok := r.appOfPackage(pkgname); ok {
+		return name
+	}
+	return pkgname
+}
+
+// appOfPackage returns the name of the app that publishes the package. Packages of disabled apps aren't in
+// the index anymore, they are found in the health state
+func (r *runner) appOfPackage(pkgname string) (name string, ok bool) {
+	for name, state := range r.health.Apps {
+		for _, p := range state.Packages {
+			if p == pkgname {
+				return name, true
+			}
+		}
+	}
+
+	for _, p := range r.initialIndex.Packages[pkgname] {
+		if app, ok := r.apkInfoMap[p.ApkName]; ok {
+			return app.Name(), true
+		}
+
+		// The releases of apps whose repository is gone weren't discovered, but the APK file names start
+		// with the app name. The longest name wins, as "notes_pro_v1.apk" also starts with "notes_"
+		for _, app := range r.appsList {
+			prefix := strings.TrimSuffix(apps.GenerateReleaseFilename(app.Name(), ""), ".apk")
+			if strings.HasPrefix(p.ApkName, prefix) && len(app.Name()) > len(name) {
+				name, ok = app.Name(), true
+			}
+		}
+		if ok {
+			return
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,390 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"metascoop/apps"
+	"metascoop/file"
+	"metascoop/forge"
+	"metascoop/git"
+	"metascoop/index"
+	"metascoop/text"
+)
+
+// createMetadata builds the index for the first time, which creates metadata stubs for new apps
+func (r *runner) createMetadata(ctx context.Context) (err error) {
+	if r.cfg.Builder != nil {
+		fmt.Println("::group::F-Droid: Creating metadata stubs")
+		defer fmt.Println("::endgroup::")
+
+		err = r.cfg.Builder.Build(ctx, r.fdroidDir(), index.Options{CreateMetadata: true, DeleteUnknown: true})
+		if err != nil {
+			return fmt.Errorf("building the index: %w", err)
+		}
+	}
+
+	r.index, err = apps.ReadIndex(r.indexPath())
+	if err != nil {
+		return fmt.Errorf("reading f-droid repo index: %w", err)
+	}
+
+	return
+}
+
+// buildIndex builds the index again with the enriched metadata, then removes the screenshots
+// that were copied into the metadata directory
+func (r *runner) buildIndex(ctx context.Context) (err error) {
+	if r.cfg.Builder != nil {
+		fmt.Println("::group::F-Droid: Reading updated metadata")
+
+		err = r.cfg.Builder.Build(ctx, r.fdroidDir(), index.Options{DeleteUnknown: true})
+		fmt.Println("::endgroup::")
+		if err != nil {
+			return fmt.Errorf("building the index: %w", err)
+		}
+	}
+
+	r.index, err = apps.ReadIndex(r.indexPath())
+	if err != nil {
+		return fmt.Errorf("reading f-droid repo index: %w", err)
+	}
+
+	for _, rmpath := range r.toRemovePaths {
+		err = os.RemoveAll(rmpath)
+		if err != nil {
+			return fmt.Errorf("removing path %q: %w", rmpath, err)
+		}
+	}
+
+	return
+}
+
+// enrichMetadata fills in the metadata files of all packages in the index
+func (r *runner) enrichMetadata(ctx context.Context) (err error) {
+	fmt.Println("Filling in metadata")
+
+	err = filepath.WalkDir(r.metadataDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".yml") {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		pkgname := strings.TrimSuffix(filepath.Base(path), ".yml")
+
+		fmt.Printf("::group::%s\n", pkgname)
+		err = r.enrichPackage(ctx, path, pkgname)
+		fmt.Println("::endgroup::")
+		if err != nil {
+			r.addError(r.appOrPackage(pkgname), StageEnrichMetadata, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walking metadata: %w", err)
+	}
+
+	return
+}
+
+// enrichPackage updates the metadata file at path with info from the app file, the override file and
+// the forge, and copies changelogs and screenshots from the app repository into the metadata directory.
+// Missing changelogs and screenshots are not an error, as the app repository doesn't need to have them
+func (r *runner) enrichPackage(ctx context.Context, path, pkgname string) (err error) {
+	log.Printf("Working on %q", pkgname)
+
+	meta, err := apps.ReadMetaFile(path)
+	if err != nil {
+		return fmt.Errorf("reading meta file %q: %w", path, err)
+	}
+
+	latestPackage, ok := r.index.FindLatestPackage(pkgname)
+	if !ok {
+		return
+	}
+
+	log.Printf("The latest version is %q with versionCode %d", latestPackage.VersionName, latestPackage.VersionCode)
+
+	apkInfo, ok := r.apkInfoMap[latestPackage.ApkName]
+	if !ok {
+		log.Printf("Cannot find apk info for %q", latestPackage.ApkName)
+		return
+	}
+
+	// Now update with some info
+
+	overridePath := filepath.Join(r.fdroidDir(), "overrides", pkgname+".yml")
+	override, err := apps.ReadOverrideFile(overridePath)
+	if err != nil {
+		return fmt.Errorf("reading override file %q: %w", overridePath, err)
+	}
+
+	layers := []apps.Layer{{Source: apps.SourceAppsFile, Metadata: apkInfo.Metadata()}}
+	var locks = [][]string{apkInfo.Lock}
+	if override != nil {
+		log.Printf("Using override file %q", overridePath)
+
+		layers = append(layers, apps.Layer{Source: apps.SourceOverride, Metadata: override.Metadata})
+		locks = append(locks, override.Lock)
+	}
+	layers = append(layers, apps.Layer{Source: apps.SourceForge, Metadata: apkInfo.Forge})
+
+	// See https://f-droid.org/en/docs/Build_Metadata_Reference/#Summary for max length
+	const maxSummaryLength = 80
+	for i := range layers {
+		lm := &layers[i].Metadata
+
+		if summary := text.Truncate(lm.Summary, maxSummaryLength); summary != lm.Summary {
+			lm.Summary = summary
+
+			log.Printf("Truncated summary from %s to %q (max length %d)", layers[i].Source, lm.Summary, maxSummaryLength)
+		}
+
+		// Descriptions on forges are usually written in Markdown, but F-Droid only supports some HTML tags.
+		// The app file and override file are written for F-Droid and are used as they are
+		if layers[i].Source == apps.SourceForge {
+			lm.Description = text.MarkdownToHTML(lm.Description)
+		}
+	}
+
+	resolutions := apps.Resolve(meta, layers, apkInfo.DefaultMetadata(), locks...)
+
+	var sources = make(map[string]string)
+	for _, res := range resolutions {
+		sources[res.Field] = string(res.Source)
+	}
+
+	// The current version always comes from the newest APK in the index
+	if !apps.IsLocked("CurrentVersion", locks...) {
+		meta.CurrentVersion = latestPackage.VersionName
+		sources["CurrentVersion"] = "index"
+	}
+	if !apps.IsLocked("CurrentVersionCode", locks...) {
+		meta.CurrentVersionCode = latestPackage.VersionCode
+		sources["CurrentVersionCode"] = "index"
+	}
+
+	log.Printf("Set current version info to versionName=%q, versionCode=%d", latestPackage.VersionName, latestPackage.VersionCode)
+
+	changes := meta.Changes()
+
+	// Only changed fields and the ones the maintainer chose are worth a line, the others keep their value
+	var changed = make(map[string]bool)
+	for _, field := range changes {
+		changed[field] = true
+	}
+	for _, res := range resolutions {
+		if changed[res.Field] || res.Source == apps.SourceOverride || res.Source == apps.SourceLocked {
+			log.Printf("Field %s: using value from %s", res.Field, res.Source)
+		}
+	}
+
+	r.addFieldChanges(apkInfo.Name(), pkgname, changes, func(field string) string {
+		return sources[field]
+	})
+
+	err = apps.WriteMetaFile(path, meta)
+	if err != nil {
+		return fmt.Errorf("writing meta file %q: %w", path, err)
+	}
+
+	log.Printf("Updated metadata file %q", path)
+
+	packages := r.index.Packages[pkgname]
+
+	writeChangelogs(ctx, r.downloadClient, r.metadataDir(), packages, r.apkInfoMap)
+
+	metaDirPath, metadata, err := r.loadRepoMetadata(ctx, apkInfo)
+	if err != nil {
+		log.Printf("Loading repository metadata from %q: %s", apkInfo.GitURL, err.Error())
+		return nil
+	}
+	defer os.RemoveAll(metaDirPath)
+
+	writeFastlaneChangelogs(r.metadataDir(), packages, r.apkInfoMap, metadata)
+
+	log.Printf("Found %d screenshots", len(metadata.Screenshots))
+
+	screenshotsPath := filepath.Join(r.metadataDir(), latestPackage.PackageName, "en-US", "phoneScreenshots")
+
+	_ = os.RemoveAll(screenshotsPath)
+
+	var sccounter int = 1
+	for _, sc := range metadata.Screenshots {
+		var ext = filepath.Ext(sc)
+		if ext == "" {
+			log.Printf("Invalid: screenshot file extension is empty for %q", sc)
+			continue
+		}
+
+		var newFilePath = filepath.Join(screenshotsPath, fmt.Sprintf("%d%s", sccounter, ext))
+
+		err = os.MkdirAll(filepath.Dir(newFilePath), os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("creating directory for screenshot file %q: %w", newFilePath, err)
+		}
+
+		err = file.Move(sc, newFilePath)
+		if err != nil {
+			return fmt.Errorf("moving screenshot file %q to %q: %w", sc, newFilePath, err)
+		}
+
+		log.Printf("Wrote screenshot to %s", newFilePath)
+
+		sccounter++
+	}
+
+	r.toRemovePaths = append(r.toRemovePaths, screenshotsPath)
+
+	return nil
+}
+
+// writeChangelogs writes the changelogs of all published versions of a package from the release notes
+// and from localized changelog release assets. Changelogs from assets are only downloaded once
+func writeChangelogs(ctx context.Context, downloadClient *http.Client, metadataDir string, packages []apps.PackageInfo, apkInfoMap map[string]apps.AppInfo) {
+	for _, pkg := range packages {
+		apkInfo, ok := apkInfoMap[pkg.ApkName]
+		if !ok {
+			continue
+		}
+
+		if apkInfo.ReleaseDescription != "" {
+			destFilePath, err := apps.WriteChangelog(metadataDir, pkg.PackageName, apps.DefaultLocale, pkg.VersionCode, apps.FormatChangelog(apkInfo.ReleaseDescription, apkInfo.ReleaseURL))
+			if err != nil {
+				log.Printf("Writing changelog file %q: %s", destFilePath, err.Error())
+				continue
+			}
+
+			log.Printf("Wrote release notes of version %q to %q", pkg.VersionName, destFilePath)
+		}
+
+		if len(apkInfo.ChangelogAssets) == 0 {
+			continue
+		}
+
+		for locale, assetURL := range apkInfo.ChangelogAssets {
+			destFilePath := apps.ChangelogPath(metadataDir, pkg.PackageName, locale, pkg.VersionCode)
+			if _, err := os.Stat(destFilePath); err == nil {
+				continue
+			}
+
+			content, err := downloadReleaseAsset(ctx, downloadClient, assetURL)
+			if err != nil {
+				log.Printf("Downloading %s changelog asset of release %q: %s", locale, apkInfo.ReleaseTag, err.Error())
+				continue
+			}
+
+			_, err = apps.WriteChangelog(metadataDir, pkg.PackageName, locale, pkg.VersionCode, apps.FormatChangelog(string(content), apkInfo.ReleaseURL))
+			if err != nil {
+				log.Printf("Writing changelog file %q: %s", destFilePath, err.Error())
+				continue
+			}
+
+			log.Printf("Wrote %s changelog of version %q to %q", locale, pkg.VersionName, destFilePath)
+		}
+	}
+}
+
+// writeFastlaneChangelogs writes the changelogs found in the fastlane tree of the app repository for all
+// published versions. They are written specifically for app stores, so they replace the other changelogs
+func writeFastlaneChangelogs(metadataDir string, packages []apps.PackageInfo, apkInfoMap map[string]apps.AppInfo, metadata apps.RepoMetadata) {
+	for _, pkg := range packages {
+		for locale, changelogs := range metadata.Changelogs {
+			sourcePath, ok := changelogs[pkg.VersionCode]
+			if !ok {
+				continue
+			}
+
+			content, err := os.ReadFile(sourcePath)
+			if err != nil {
+				log.Printf("Reading changelog file %q: %s", sourcePath, err.Error())
+				continue
+			}
+
+			destFilePath, err := apps.WriteChangelog(metadataDir, pkg.PackageName, locale, pkg.VersionCode, apps.FormatChangelog(string(content), apkInfoMap[pkg.ApkName].ReleaseURL))
+			if err != nil {
+				log.Printf("Writing changelog file %q: %s", destFilePath, err.Error())
+				continue
+			}
+
+			log.Printf("Wrote %s changelog of version %q from the fastlane metadata to %q", locale, pkg.VersionName, destFilePath)
+		}
+	}
+}
+
+// downloadReleaseAsset downloads a small release asset. Asset URLs can redirect to a download server, which
+// gets no credentials from downloadClient if it is on another host
+func downloadReleaseAsset(ctx context.Context, downloadClient *http.Client, assetURL string) (content []byte, err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, assetURL, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &forge.StatusError{URL: assetURL, StatusCode: resp.StatusCode}
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// loadRepoMetadata downloads the metadata files of the app's repository at the release tag using
+// the forge API, and only clones the repository if that is not possible
+func (r *runner) loadRepoMetadata(ctx context.Context, apkInfo apps.AppInfo) (dirPath string, metadata apps.RepoMetadata, err error) {
+	repo, err := apps.RepoInfo(apkInfo.GitURL)
+	if err != nil {
+		return
+	}
+
+	if f := r.forge(repo.Host); f != nil && apkInfo.ReleaseTag != "" {
+		log.Printf("Fetching metadata files of %s/%s at %q via the %s API", repo.Author, repo.Name, apkInfo.ReleaseTag, repo.Host)
+
+		dirPath, metadata, err = apps.FetchMetadata(ctx, f, repo, apkInfo.ReleaseTag)
+		if err == nil {
+			return
+		}
+
+		log.Printf("Fetching metadata files via the API failed, falling back to cloning: %s", err.Error())
+	}
+
+	log.Printf("Cloning git repository to search for screenshots")
+
+	cred, _, err := r.transport.Credential(ctx, repo.Host)
+	if err != nil {
+		log.Printf("Cloning without credentials: %s", err.Error())
+	}
+
+	dirPath, err = git.CloneRepo(ctx, apkInfo.GitURL, cred)
+	if err != nil {
+		err = fmt.Errorf("cloning git repo: %w", err)
+		return
+	}
+
+	metadata, err = apps.FindMetadata(dirPath)
+	if err != nil {
+		_ = os.RemoveAll(dirPath)
+		err = fmt.Errorf("finding metadata in git repo %q: %w", dirPath, err)
+	}
+
+	return
+}
@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"metascoop/apps"
+)
+
+// followMove uses the new location of a repository that was renamed or transferred for the rest of the run,
+// as the forges only redirect from the old one for a while. The move is remembered for updateAppFile
+func (r *runner) followMove(app *apps.AppInfo, repo *apps.Repo, details repoDetails) {
+	if details.FullName == "" || strings.EqualFold(details.FullName, repo.Author+"/"+repo.Name) {
+		return
+	}
+
+	parts := strings.Split(details.FullName, "/")
+	if len(parts) != 2 {
+		log.Printf("Not following the move of %s/%s to %s, only repositories without subgroups are supported", repo.Author, repo.Name, details.FullName)
+		return
+	}
+
+	move := apps.Move{App: app.Name(), From: app.GitURL, To: "https://" + repo.Host + "/" + details.FullName}
+
+	err := app.MoveRepo(move.To)
+	if err != nil {
+		log.Printf("Following the move of %s/%s to %q: %s", repo.Author, repo.Name, move.To, err.Error())
+		return
+	}
+
+	log.Printf("Repository %s/%s was moved to %s, using %q", repo.Author, repo.Name, details.FullName, move.To)
+
+	repo.Author, repo.Name = parts[0], parts[1]
+	r.report.Moved = append(r.report.Moved, move)
+}
+
+// updateAppFile changes the git URLs of the apps whose repositories moved in the app file if RewriteAppFile
+// is set, otherwise it logs a patch that does the same
+func (r *runner) updateAppFile(ctx context.Context) (err error) {
+	if len(r.report.Moved) == 0 {
+		return
+	}
+
+	content, err := os.ReadFile(r.cfg.AppsFile)
+	if err != nil {
+		return
+	}
+
+	rewritten, err := apps.RewriteAppFile(content, r.report.Moved)
+	if err != nil {
+		return fmt.Errorf("rewriting app file: %w", err)
+	}
+
+	if r.cfg.RewriteAppFile {
+		err = os.WriteFile(r.cfg.AppsFile, rewritten, 0o644)
+		if err != nil {
+			return
+		}
+
+		log.Printf("Updated the git URLs of %d apps in %q", len(r.report.Moved), r.cfg.AppsFile)
+
+		return
+	}
+
+	fmt.Println("::group::Suggested change of the app file")
+	fmt.Print(apps.Patch(filepath.Base(r.cfg.AppsFile), content, rewritten))
+	fmt.Println("::endgroup::")
+
+	for _, m := range r.report.Moved {
+		fmt.Printf("::notice title=%s::Repository moved from %s to %s, update the app file or run with -rewrite-app-file\n", m.App, m.From, m.To)
+	}
+
+	return
+}
@@ -0,0 +1,372 @@
+// Package pipeline updates an F-Droid repo from the releases of the apps in an app file. It is what
+// the metascoop command runs, but can also be used by other tools
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+	"metascoop/apps"
+	"metascoop/credentials"
+	"metascoop/download"
+	"metascoop/feed"
+	"metascoop/forge"
+	"metascoop/health"
+	"metascoop/index"
+	"metascoop/md"
+	"metascoop/site"
+	"metascoop/stats"
+)
+
+// Config configures a pipeline run
+type Config struct {
+	// AppsFile is the path of the apps.yaml file
+	AppsFile string
+	// RewriteAppFile updates the git URLs of apps whose repositories were renamed or transferred in the app file.
+	// Otherwise a patch is suggested in the log
+	RewriteAppFile bool
+	// RepoDir is the fdroid "repo" directory. Its parent directory contains config.yml and the metadata
+	RepoDir string
+	// ReadmePath is the README file with the apps table. Defaults to README.md in the parent
+	// directory of the fdroid directory
+	ReadmePath string
+	// ReadmeTemplate is a file with the template of the apps table. The built-in table is used if it is empty
+	ReadmeTemplate string
+	// Outputs are more files that are generated from templates after the README
+	Outputs []md.Output
+	// Site generates a static website for the repo if it is set. Its Dir defaults to the fdroid directory
+	Site *site.Options
+	// Feed writes Atom and JSON feeds of new app versions if it is set. Its Dir defaults to the fdroid directory
+	Feed *feed.Options
+	// Stats records the stars, downloads and health of the apps if it is set
+	Stats *StatsOptions
+	// Health configures the checks of the app repositories and what happens to abandoned apps
+	Health HealthOptions
+	// Credentials authenticate requests to forges and git clones, keyed by host like "github.com"
+	Credentials credentials.Store
+	// Forges tells which forge runs on self-hosted hosts, forge.DefaultHosts are known anyway
+	Forges forge.Hosts
+	// Transport sends all HTTP requests, http.DefaultTransport is used if it is nil
+	Transport http.RoundTripper
+	// HTTPTimeout limits requests to forge APIs, 0 means no limit
+	HTTPTimeout time.Duration
+	// Concurrency is how many APKs are downloaded at the same time, values below 1 mean 1
+	Concurrency int
+	// Retention is how many of the latest releases of each app are kept in the repo, 0 keeps all
+	Retention int
+	// Builder builds the index. If it is nil, the index is not built, which is useful for debugging
+	Builder index.Builder
+	// MaxFailedApps stops the run before the index is built if more apps failed, 0 means no limit
+	MaxFailedApps int
+	// Downloads configures retries and progress logging of APK downloads. If its HTTPClient is nil,
+	// downloads are authenticated with Credentials
+	Downloads download.Client
+}
+
+// Stage is a step of the pipeline
+type Stage string
+
+const (
+	// StageDiscover looks up the apps on their forges and lists their releases
+	StageDiscover Stage = "discover"
+	// StageUpdateAppFile changes the git URLs of moved repositories in the app file
+	StageUpdateAppFile Stage = "update app file"
+	// StageCheckHealth warns about abandoned app repositories and disables their apps if configured
+	StageCheckHealth Stage = "check health"
+	// StageFetch downloads the APKs of new releases
+	StageFetch Stage = "fetch"
+	// StageCreateMetadata creates metadata stubs for new apps and reads the first index
+	StageCreateMetadata Stage = "create metadata"
+	// StageBuildIndex builds the index from the APKs and metadata
+	StageBuildIndex Stage = "build index"
+	// StageEnrichMetadata fills in the metadata files with info from the app file, overrides and forges
+	StageEnrichMetadata Stage = "enrich metadata"
+	// StageRecordStats adds the stats of the apps to the history
+	StageRecordStats Stage = "record stats"
+	// StagePublishReadme regenerates the apps table in the README
+	StagePublishReadme Stage = "publish README"
+	// StagePublishSite generates the static website
+	StagePublishSite Stage = "publish site"
+	// StagePublishFeed adds the new versions to the feeds
+	StagePublishFeed Stage = "publish feed"
+	// StageAssessChanges decides whether the run changed anything worth committing
+	StageAssessChanges Stage = "assess changes"
+)
+
+// AppError is an error that happened while working on a single app. It doesn't stop the run
+type AppError struct {
+	// App is the key of the app in the app file
+	App   string
+	Stage Stage
+	Err   error
+	// Retryable is set if the error will probably go away in a later run, e.g. a timeout or rate limit
+	Retryable bool
+}
+
+func (e *AppError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.App, e.Stage, e.Err.Error())
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Report is the result of a pipeline run
+type Report struct {
+	// Downloaded lists the file names of the APKs that were downloaded
+	Downloaded []string `json:"downloaded"`
+	// Errors are the errors of single apps. The other apps were still updated
+	Errors []*AppError `json:"errors"`
+	// Changed is true if the repo changed in a way that should be committed
+	Changed bool `json:"changed"`
+	// ChangedPath is the first significant change in the index, if there was one
+	ChangedPath string `json:"changed_path,omitempty"`
+	// Moved are the repositories that were renamed or transferred, their new location was used
+	Moved []apps.Move `json:"moved"`
+
+	// Apps tell what happened to each app, sorted by name
+	Apps []*AppReport `json:"apps"`
+	// Stages are the timings of the stages that ran, in order
+	Stages []StageTiming `json:"stages"`
+	// Seconds is how long the whole run took
+	Seconds float64 `json:"seconds"`
+	// APICalls are the requests to forge APIs by host
+	APICalls []APIUsage `json:"api_calls"`
+}
+
+// release is a release with an APK that should be in the repo
+type release struct {
+	app  apps.AppInfo
+	repo apps.Repo
+	// asset is the APK
+	asset forge.Asset
+	// path is where the APK is stored in the repo directory
+	path string
+	// report is the entry of the release in the report
+	report *ReleaseReport
+}
+
+// runner holds the state that is passed from one stage to the next
+type runner struct {
+	cfg Config
+
+	// transport authenticates requests with the configured credentials
+	transport *credentials.Transport
+	// apiTransport counts the requests to forge APIs for the report
+	apiTransport *countingTransport
+	// httpClient is used for requests to forges
+	httpClient *http.Client
+	// downloadClient is used for release assets. It has no timeout, as downloads can take long, and
+	// authenticates redirects only if they stay on a host with credentials, e.g. not to a CDN
+	downloadClient *http.Client
+	githubClient   *github.Client
+
+	appsList     []apps.AppInfo
+	initialIndex *apps.RepoIndex
+	index        *apps.RepoIndex
+
+	// releases that are not in the repo yet
+	releases []release
+	// apkInfoMap maps APK file names to the app and release they are from
+	apkInfoMap map[string]apps.AppInfo
+	// toRemovePaths are directories that should be removed after building the index
+	toRemovePaths []string
+	// snapshots are the stats of the apps that were discovered
+	snapshots []stats.Snapshot
+	// healthFindings are the problems of the repositories of the apps that were discovered, keyed by app name
+	healthFindings map[string][]health.Finding
+	health         *health.State
+
+	report   Report
+	reportMu sync.Mutex
+}
+
+// Run updates the repo. An error is returned if the repo cannot be updated at all, errors of
+// single apps are only added to the report. If ctx is cancelled, Run stops as soon as possible,
+// removes partial files and returns an error that wraps the context error
+func Run(ctx context.Context, cfg Config) (report Report, err error) {
+	if cfg.ReadmePath == "" {
+		cfg.ReadmePath = filepath.Join(filepath.Dir(filepath.Dir(cfg.RepoDir)), "README.md")
+	}
+
+	r := &runner{
+		cfg:            cfg,
+		apkInfoMap:     make(map[string]apps.AppInfo),
+		healthFindings: make(map[string][]health.Finding),
+	}
+
+	start := time.Now()
+	defer func() {
+		r.finishReport(start)
+		report = r.report
+	}()
+
+	err = r.init(ctx)
+	if err != nil {
+		return
+	}
+
+	var stages = []struct {
+		stage Stage
+		run   func(ctx context.Context) error
+	}{
+		{StageDiscover, r.discover},
+		{StageUpdateAppFile, r.updateAppFile},
+		{StageCheckHealth, r.checkHealth},
+		{StageFetch, r.fetch},
+		{StageCreateMetadata, r.createMetadata},
+		{StageEnrichMetadata, r.enrichMetadata},
+		{StageBuildIndex, r.buildIndex},
+		{StageRecordStats, r.recordStats},
+		{StagePublishReadme, r.publishReadme},
+		{StagePublishSite, r.publishSite},
+		{StagePublishFeed, r.publishFeed},
+		{StageAssessChanges, r.assessChanges},
+	}
+
+	for _, s := range stages {
+		stageStart := time.Now()
+		err = s.run(ctx)
+		r.report.Stages = append(r.report.Stages, StageTiming{Stage: s.stage, Seconds: seconds(time.Since(stageStart))})
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil && (s.stage == StageDiscover || s.stage == StageFetch) {
+			err = r.checkFailures()
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				// Errors caused by the cancellation, e.g. of the killed fdroid process, don't tell that the run was interrupted
+				if !errors.Is(err, ctx.Err()) {
+					err = fmt.Errorf("%w: %s", ctx.Err(), err.Error())
+				}
+
+				r.cleanup()
+			}
+
+			return r.report, fmt.Errorf("%s: %w", s.stage, err)
+		}
+	}
+
+	return r.report, nil
+}
+
+// cleanup removes files of an interrupted run that would otherwise end up in the repo: unfinished metadata
+// files and screenshots that were copied into the metadata directory. Partial downloads are kept, the
+// next run resumes them
+func (r *runner) cleanup() {
+	log.Printf("Cleaning up after interruption")
+
+	for _, rmpath := range r.toRemovePaths {
+		err := os.RemoveAll(rmpath)
+		if err != nil {
+			log.Printf("Removing %q: %s", rmpath, err.Error())
+		}
+	}
+
+	removeTempFiles(r.fdroidDir())
+}
+
+// removeTempFiles removes the .tmp files below dir that are left behind by interrupted writes. Partial
+// APK downloads are kept so that they can be resumed
+func removeTempFiles(dir string) {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".tmp") || strings.HasSuffix(path, ".apk.tmp") {
+			return err
+		}
+
+		log.Printf("Removing temporary file %q", path)
+
+		return os.Remove(path)
+	})
+	if err != nil {
+		log.Printf("Removing temporary files in %q: %s", dir, err.Error())
+	}
+}
+
+func (r *runner) init(ctx context.Context) (err error) {
+	fmt.Println("::group::Initializing")
+	defer fmt.Println("::endgroup::")
+
+	r.appsList, err = apps.ParseAppFile(r.cfg.AppsFile)
+	if err != nil {
+		return fmt.Errorf("parsing app file: %w", err)
+	}
+
+	r.transport = &credentials.Transport{Store: r.cfg.Credentials, Base: r.cfg.Transport}
+	r.apiTransport = &countingTransport{base: r.transport}
+	r.httpClient = &http.Client{
+		Transport: r.apiTransport,
+		Timeout:   r.cfg.HTTPTimeout,
+	}
+	r.downloadClient = &http.Client{Transport: r.transport}
+	if r.cfg.Downloads.HTTPClient == nil {
+		r.cfg.Downloads.HTTPClient = r.downloadClient
+	}
+
+	// The GitHub client changes the redirect policy of its HTTP client while downloading assets, so it
+	// gets its own
+	r.githubClient = github.NewClient(&http.Client{
+		Transport: r.apiTransport,
+		Timeout:   r.cfg.HTTPTimeout,
+	})
+
+	var hosts []string
+	for host := range r.cfg.Credentials {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		if cred := r.cfg.Credentials[host]; !cred.IsZero() {
+			log.Printf("Using %s for %s", cred, host)
+		}
+	}
+
+	// Temporary files can be left over from a run that was killed
+	removeTempFiles(r.fdroidDir())
+
+	r.initialIndex, err = apps.ReadIndex(r.indexPath())
+	if err != nil {
+		return fmt.Errorf("reading f-droid repo index: %w", err)
+	}
+
+	err = os.MkdirAll(r.cfg.RepoDir, 0o755)
+	if err != nil {
+		return fmt.Errorf("creating repo directory: %w", err)
+	}
+
+	return
+}
+
+// addError records an error of an app that doesn't stop the run
+func (r *runner) addError(app string, stage Stage, err error) {
+	log.Printf("Error in stage %q of app %q: %s", stage, app, err.Error())
+
+	r.report.Errors = append(r.report.Errors, &AppError{App: app, Stage: stage, Err: err, Retryable: isRetryable(stage, err)})
+
+	a := r.appReport(app)
+	a.Errors = append(a.Errors, fmt.Sprintf("%s: %s", stage, err.Error()))
+}
+
+func (r *runner) fdroidDir() string {
+	return filepath.Dir(r.cfg.RepoDir)
+}
+
+func (r *runner) metadataDir() string {
+	return filepath.Join(r.fdroidDir(), "metadata")
+}
+
+func (r *runner) indexPath() string {
+	return filepath.Join(r.cfg.RepoDir, "index-v1.json")
+}
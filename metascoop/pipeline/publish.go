@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"metascoop/apps"
+	"metascoop/feed"
+	"metascoop/git"
+	"metascoop/md"
+	"metascoop/site"
+	"metascoop/stats"
+)
+
+// publishReadme regenerates the apps table in the README and the other outputs
+func (r *runner) publishReadme(ctx context.Context) (err error) {
+	if r.cfg.ReadmeTemplate != "" {
+		err = md.RegenerateReadmeFromTemplate(r.cfg.ReadmePath, r.cfg.ReadmeTemplate, r.cfg.RepoDir, r.index)
+	} else {
+		err = md.RegenerateReadme(r.cfg.ReadmePath, r.cfg.RepoDir, r.index)
+	}
+	if err != nil {
+		return fmt.Errorf("generating %q: %w", r.cfg.ReadmePath, err)
+	}
+
+	if r.cfg.Stats != nil && r.cfg.Stats.Readme {
+		history, err := stats.Read(r.statsDir())
+		if err != nil {
+			return err
+		}
+
+		err = md.WriteRegion(r.cfg.ReadmePath, statsRegion, history.Summary())
+		if err != nil {
+			return fmt.Errorf("writing stats to the README: %w", err)
+		}
+	}
+
+	for _, out := range r.cfg.Outputs {
+		err = md.Generate(out, r.cfg.RepoDir, r.index)
+		if err != nil {
+			return fmt.Errorf("generating %q: %w", out.Path, err)
+		}
+
+		log.Printf("Generated %q", out.Path)
+	}
+
+	return
+}
+
+// publishSite generates the static website, if it is enabled
+func (r *runner) publishSite(ctx context.Context) (err error) {
+	if r.cfg.Site == nil {
+		return
+	}
+
+	opts := *r.cfg.Site
+	if opts.Dir == "" {
+		opts.Dir = r.fdroidDir()
+	}
+
+	err = site.Generate(opts, r.cfg.RepoDir, r.index)
+	if err != nil {
+		return fmt.Errorf("generating site in %q: %w", opts.Dir, err)
+	}
+
+	log.Printf("Generated the site in %q", opts.Dir)
+
+	return
+}
+
+// publishFeed adds the versions that are new in the index to the feeds, if they are enabled
+func (r *runner) publishFeed(ctx context.Context) (err error) {
+	if r.cfg.Feed == nil {
+		return
+	}
+
+	opts := *r.cfg.Feed
+	if opts.Dir == "" {
+		opts.Dir = r.fdroidDir()
+	}
+
+	added, err := feed.Update(opts, r.cfg.RepoDir, r.initialIndex, r.index)
+	if err != nil {
+		return fmt.Errorf("updating feeds in %q: %w", opts.Dir, err)
+	}
+
+	log.Printf("Added %d new versions to the feeds in %q", added, opts.Dir)
+
+	return
+}
+
+// isIndexFile tells whether fname is one of the index files, which also change when nothing else did
+func isIndexFile(fname string) bool {
+	return strings.Contains(fname, "index") || strings.HasPrefix(path.Base(fname), "entry.") || path.Base(path.Dir(fname)) == "diff"
+}
+
+// assessChanges checks whether the index changed significantly, or any other file in the repo directory
+func (r *runner) assessChanges(ctx context.Context) (err error) {
+	fmt.Println("::group::Assessing changes")
+	defer fmt.Println("::endgroup::")
+
+	cpath, haveSignificantChanges := apps.HasSignificantChanges(r.initialIndex, r.index)
+	if haveSignificantChanges {
+		log.Printf("The index %q had a significant change at JSON path %q", r.indexPath(), cpath)
+
+		r.report.Changed = true
+		r.report.ChangedPath = cpath
+
+		return nil
+	}
+
+	log.Printf("The index files didn't change significantly")
+
+	changedFiles, err := git.GetChangedFileNames(r.cfg.RepoDir)
+	if err != nil {
+		return fmt.Errorf("getting changed files: %w", err)
+	}
+
+	// If only the index files changed, we ignore the commit
+	for _, fname := range changedFiles {
+		if !isIndexFile(fname) {
+			r.report.Changed = true
+
+			log.Printf("File %q is a significant change", fname)
+		}
+	}
+
+	if !r.report.Changed {
+		log.Printf("It doesn't look like there were any relevant changes, neither to the index file nor any file indexed by git.")
+	}
+
+	return
+}
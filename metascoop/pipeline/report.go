@@ -0,0 +1,261 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReleaseStatus is what happened to a release of an app
+type ReleaseStatus string
+
+const (
+	// ReleaseQueued releases were about to be downloaded when the run stopped
+	ReleaseQueued ReleaseStatus = "queued"
+	// ReleaseDownloaded releases were downloaded in this run
+	ReleaseDownloaded ReleaseStatus = "downloaded"
+	// ReleasePresent releases were already in the repo
+	ReleasePresent ReleaseStatus = "present"
+	// ReleaseSkipped releases can't be published, the reason tells why
+	ReleaseSkipped ReleaseStatus = "skipped"
+	// ReleaseExpired releases are older than the ones kept because of Config.Retention
+	ReleaseExpired ReleaseStatus = "expired"
+	// ReleaseFailed releases couldn't be downloaded
+	ReleaseFailed ReleaseStatus = "failed"
+)
+
+// ReleaseReport is a release that was seen on the forge
+type ReleaseReport struct {
+	Tag    string        `json:"tag"`
+	Status ReleaseStatus `json:"status"`
+	Reason string        `json:"reason,omitempty"`
+}
+
+// FieldChange is a metadata field that was changed
+type FieldChange struct {
+	Package string `json:"package"`
+	Field   string `json:"field"`
+	// Source is where the new value came from, e.g. "forge" or "health"
+	Source string `json:"source,omitempty"`
+}
+
+// AppReport is what happened to an app during the run
+type AppReport struct {
+	App           string           `json:"app"`
+	Releases      []*ReleaseReport `json:"releases"`
+	Downloaded    []string         `json:"downloaded"`
+	FieldsChanged []FieldChange    `json:"fields_changed"`
+	Errors        []string         `json:"errors"`
+}
+
+// Count returns how many releases have the status
+func (a *AppReport) Count(status ReleaseStatus) (n int) {
+	for _, rel := range a.Releases {
+		if rel.Status == status {
+			n++
+		}
+	}
+	return
+}
+
+// StageTiming is how long a stage took
+type StageTiming struct {
+	Stage   Stage   `json:"stage"`
+	Seconds float64 `json:"seconds"`
+}
+
+// APIUsage are the requests sent to the API of a forge
+type APIUsage struct {
+	Host  string `json:"host"`
+	Calls int    `json:"calls"`
+	// RateLimitRemaining is the number of requests left according to the last response, -1 if the forge didn't tell
+	RateLimitRemaining int `json:"rate_limit_remaining"`
+}
+
+func (e *AppError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		App       string `json:"app"`
+		Stage     Stage  `json:"stage"`
+		Error     string `json:"error"`
+		Retryable bool   `json:"retryable"`
+	}{e.App, e.Stage, e.Err.Error(), e.Retryable})
+}
+
+// appReport returns the report of the app, which is created if it doesn't exist
+func (r *runner) appReport(app string) *AppReport {
+	r.reportMu.Lock()
+	defer r.reportMu.Unlock()
+
+	for _, a := range r.report.Apps {
+		if a.App == app {
+			return a
+		}
+	}
+
+	a := &AppReport{App: app}
+	r.report.Apps = append(r.report.Apps, a)
+
+	return a
+}
+
+// addRelease records a release of an app that was seen on the forge
+func (r *runner) addRelease(app, tag string, status ReleaseStatus, reason string) *ReleaseReport {
+	rel := &ReleaseReport{Tag: tag, Status: status, Reason: reason}
+
+	a := r.appReport(app)
+	a.Releases = append(a.Releases, rel)
+
+	return rel
+}
+
+// addFieldChanges records the metadata fields of a package that are changed by the next write
+func (r *runner) addFieldChanges(app, pkgname string, fields []string, source func(field string) string) {
+	a := r.appReport(app)
+	for _, field := range fields {
+		a.FieldsChanged = append(a.FieldsChanged, FieldChange{Package: pkgname, Field: field, Source: source(field)})
+	}
+}
+
+// finishReport adds the timings and API calls to the report
+func (r *runner) finishReport(start time.Time) {
+	r.report.Seconds = seconds(time.Since(start))
+
+	if r.apiTransport != nil {
+		r.report.APICalls = r.apiTransport.usage()
+	}
+
+	sort.Slice(r.report.Apps, func(i, j int) bool { return r.report.Apps[i].App < r.report.Apps[j].App })
+	for _, a := range r.report.Apps {
+		// Concurrent downloads finish in any order
+		sort.Strings(a.Downloaded)
+	}
+}
+
+func seconds(d time.Duration) float64 {
+	return d.Round(time.Millisecond).Seconds()
+}
+
+// countingTransport counts the requests to the forge APIs by host
+type countingTransport struct {
+	base http.RoundTripper
+
+	mu        sync.Mutex
+	calls     map[string]int
+	rateLimit map[string]int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.calls == nil {
+		t.calls = make(map[string]int)
+		t.rateLimit = make(map[string]int)
+	}
+
+	host := req.URL.Hostname()
+	t.calls[host]++
+
+	// GitHub and GitLab tell how many requests are left, Gitea only if it limits them
+	if resp != nil {
+		if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+			t.rateLimit[host] = remaining
+		}
+	}
+
+	return resp, err
+}
+
+func (t *countingTransport) usage() (usage []APIUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for host, calls := range t.calls {
+		remaining, ok := t.rateLimit[host]
+		if !ok {
+			remaining = -1
+		}
+		usage = append(usage, APIUsage{Host: host, Calls: calls, RateLimitRemaining: remaining})
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Host < usage[j].Host })
+
+	return
+}
+
+// Markdown renders the report for the summary of a GitHub Actions job
+func (r *Report) Markdown() string {
+	var sb strings.Builder
+
+	if len(r.Apps) > 0 {
+		sb.WriteString("| App | Releases | Downloaded | Skipped | Fields changed | Errors |\n")
+		sb.WriteString("| --- | ---: | ---: | ---: | --- | ---: |\n")
+		for _, a := range r.Apps {
+			var fields []string
+			for _, f := range a.FieldsChanged {
+				fields = append(fields, f.Field)
+			}
+			fmt.Fprintf(&sb, "| %s | %d | %d | %d | %s | %d |\n",
+				markdownCell(a.App), len(a.Releases), len(a.Downloaded), a.Count(ReleaseSkipped), markdownCell(strings.Join(fields, ", ")), len(a.Errors))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(r.Errors) > 0 {
+		sb.WriteString("### Failures\n\n| App | Stage | Retryable | Error |\n| --- | --- | --- | --- |\n")
+		for _, e := range r.Errors {
+			retryable := "no"
+			if e.Retryable {
+				retryable = "yes"
+			}
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", markdownCell(e.App), e.Stage, retryable, markdownCell(e.Err.Error()))
+		}
+		sb.WriteString("\n")
+	}
+
+	var skipped strings.Builder
+	for _, a := range r.Apps {
+		for _, rel := range a.Releases {
+			if rel.Status == ReleaseSkipped {
+				fmt.Fprintf(&skipped, "| %s | %s | %s |\n", markdownCell(a.App), markdownCell(rel.Tag), markdownCell(rel.Reason))
+			}
+		}
+	}
+	if skipped.Len() > 0 {
+		sb.WriteString("<details><summary>Skipped releases</summary>\n\n| App | Release | Reason |\n| --- | --- | --- |\n")
+		sb.WriteString(skipped.String())
+		sb.WriteString("\n</details>\n\n")
+	}
+
+	sb.WriteString("<details><summary>Timings and API calls</summary>\n\n| Stage | Seconds |\n| --- | ---: |\n")
+	for _, s := range r.Stages {
+		fmt.Fprintf(&sb, "| %s | %.1f |\n", s.Stage, s.Seconds)
+	}
+	fmt.Fprintf(&sb, "| **Total** | **%.1f** |\n\n", r.Seconds)
+
+	if len(r.APICalls) > 0 {
+		sb.WriteString("| Host | API calls | Rate limit remaining |\n| --- | ---: | ---: |\n")
+		for _, u := range r.APICalls {
+			remaining := "–"
+			if u.RateLimitRemaining >= 0 {
+				remaining = strconv.Itoa(u.RateLimitRemaining)
+			}
+			fmt.Fprintf(&sb, "| %s | %d | %s |\n", u.Host, u.Calls, remaining)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("</details>\n")
+
+	return sb.String()
+}
+
+// markdownCell keeps text from breaking a Markdown table
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
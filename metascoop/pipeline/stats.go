@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"metascoop/apps"
+	"metascoop/stats"
+)
+
+// StatsOptions configures the stats history
+type StatsOptions struct {
+	// Dir is where the history and summary are written, defaults to the "stats" directory in the fdroid directory
+	Dir string
+	// Readme writes the summary table into the README, between "<!-- begin stats -->" and "<!-- end stats -->"
+	Readme bool
+}
+
+// statsRegion is the region of the README with the summary table
+const statsRegion = "stats"
+
+func (r *runner) statsDir() string {
+	if r.cfg.Stats.Dir != "" {
+		return r.cfg.Stats.Dir
+	}
+	return filepath.Join(r.fdroidDir(), "stats")
+}
+
+// addSnapshot remembers the stats of an app for recordStats
+func (r *runner) addSnapshot(app apps.AppInfo, repo apps.Repo, details repoDetails) {
+	s := stats.NewSnapshot(time.Now(), app.Name(), repo.Host+"/"+repo.Author+"/"+repo.Name)
+
+	s.Stars = details.Stars
+	s.Forks = details.Forks
+	s.OpenIssues = details.OpenIssues
+	s.Archived = details.Archived
+	s.PushedAt = details.PushedAt.UTC()
+	s.LatestRelease = details.LatestRelease
+	s.LatestReleaseAt = details.LatestReleaseAt.UTC()
+	s.Releases = details.Releases
+
+	r.snapshots = append(r.snapshots, s)
+}
+
+// recordStats adds the stats of this run to the history and writes its summary, if stats are enabled
+func (r *runner) recordStats(ctx context.Context) (err error) {
+	if r.cfg.Stats == nil {
+		return
+	}
+
+	dir := r.statsDir()
+
+	history, err := stats.Read(dir)
+	if err != nil {
+		return
+	}
+
+	history.Add(r.snapshots...)
+
+	err = history.Write(dir)
+	if err != nil {
+		return fmt.Errorf("writing stats to %q: %w", dir, err)
+	}
+
+	log.Printf("Recorded the stats of %d apps in %q", len(r.snapshots), dir)
+
+	return
+}
@@ -0,0 +1,65 @@
+// Package qr renders QR codes as PNG or SVG images
+package qr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// moduleSize is the size of a module (a "pixel" of the QR code) in PNG images
+const moduleSize = 8
+
+// Write writes a QR code of content to path, as SVG if path ends in ".svg" and as PNG otherwise
+func Write(path, content string) (err error) {
+	q, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("encoding QR code: %w", err)
+	}
+
+	var image []byte
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		image = SVG(q.Bitmap())
+	} else {
+		image, err = q.PNG(-moduleSize)
+		if err != nil {
+			return
+		}
+	}
+
+	return os.WriteFile(path, image, 0o644)
+}
+
+// SVG renders a bitmap, whose dark modules are true, as an SVG image with one unit per module
+func SVG(bitmap [][]bool) []byte {
+	var sb strings.Builder
+
+	size := len(bitmap)
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	sb.WriteString("\n")
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="#fff"/>`, size, size)
+	sb.WriteString("\n")
+
+	sb.WriteString(`<path fill="#000" d="`)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+
+			// Runs of dark modules are drawn as one rectangle
+			start := x
+			for x+1 < len(row) && row[x+1] {
+				x++
+			}
+			fmt.Fprintf(&sb, "M%d %dh%dv1h-%dz", start, y, x-start+1, x-start+1)
+		}
+	}
+	sb.WriteString(`"/>`)
+	sb.WriteString("\n</svg>\n")
+
+	return []byte(sb.String())
+}
@@ -0,0 +1,73 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const content = "https://example.com/fdroid/repo?fingerprint=30C8B33215CDFDA5C78BCB3D1B7E4B0F8F050697820D7BE320E29D61A72ECC60"
+
+func TestWrite(t *testing.T) {
+	q, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules := len(q.Bitmap())
+
+	dir := t.TempDir()
+
+	pngPath := filepath.Join(dir, "qr.png")
+	if err := Write(pngPath, content); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(pngPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("QR code isn't a valid PNG: %s", err.Error())
+	}
+	if size := img.Bounds().Size(); size.X != modules*moduleSize || size.Y != modules*moduleSize {
+		t.Errorf("PNG has size %v, want %d modules of %d pixels", size, modules, moduleSize)
+	}
+
+	svgPath := filepath.Join(dir, "qr.svg")
+	if err := Write(svgPath, content); err != nil {
+		t.Fatal(err)
+	}
+	svg, err := os.ReadFile(svgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf(`viewBox="0 0 %d %d"`, modules, modules); !bytes.Contains(svg, []byte(want)) {
+		t.Errorf("SVG doesn't contain %s:\n%s", want, svg)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	bitmap := [][]bool{
+		{true, true, false},
+		{false, false, false},
+		{true, false, true},
+	}
+
+	svg := string(SVG(bitmap))
+
+	if !strings.Contains(svg, `viewBox="0 0 3 3"`) {
+		t.Errorf("SVG has the wrong size:\n%s", svg)
+	}
+	// Runs of dark modules are one rectangle, empty rows have none
+	if want := `d="M0 0h2v1h-2zM0 2h1v1h-1zM2 2h1v1h-1z"`; !strings.Contains(svg, want) {
+		t.Errorf("SVG doesn't contain %s:\n%s", want, svg)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"metascoop/pipeline"
+)
+
+// exitDescriptions explain the exit codes in the report
+var exitDescriptions = map[int]string{
+	exitChanged:          "the repo changed",
+	exitError:            "the run failed",
+	exitUnchanged:        "nothing significant changed",
+	exitPartial:          "some apps failed, the others changed the repo",
+	exitPartialUnchanged: "some apps failed, nothing else changed",
+	exitInterrupted:      "the run was interrupted",
+}
+
+// runReport is the report of the pipeline with the outcome of the run
+type runReport struct {
+	ExitCode int    `json:"exit_code"`
+	Result   string `json:"result"`
+	// Error is the error that stopped the run
+	Error string `json:"error,omitempty"`
+
+	*pipeline.Report
+}
+
+func newRunReport(report *pipeline.Report, exitCode int, err error) (rr runReport) {
+	rr = runReport{ExitCode: exitCode, Result: exitDescriptions[exitCode], Report: report}
+	if err != nil {
+		rr.Error = err.Error()
+	}
+	return
+}
+
+// writeJSON writes the report to path
+func (rr runReport) writeJSON(path string) (err error) {
+	content, err := json.MarshalIndent(rr, "", "\t")
+	if err != nil {
+		return
+	}
+
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
+
+// appendMarkdown appends the report to the Markdown file at path, which is how GitHub Actions
+// shows it in the summary of the job
+func (rr runReport) appendMarkdown(path string) (err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return
+	}
+
+	_, err = fmt.Fprintf(f, "## metascoop\n\n**Result:** %s (exit code %d)\n\n", rr.Result, rr.ExitCode)
+	if err == nil && rr.Error != "" {
+		_, err = fmt.Fprintf(f, "**Error:** %s\n\n", rr.Error)
+	}
+	if err == nil {
+		_, err = f.WriteString(rr.Report.Markdown())
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return
+}
@@ -0,0 +1,244 @@
+// Package site generates a static website for the F-Droid repo: an index page with all apps and a page for
+// each app with its screenshots, changelog and versions. It is written to the directory that is published, so
+// the links to icons and APKs are relative
+package site
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"metascoop/apps"
+	"metascoop/md"
+	"metascoop/text"
+)
+
+// appsDir is the directory of the app pages in the site directory
+const appsDir = "apps"
+
+// qrCodeName is the file the QR code is copied to
+const qrCodeName = "qrcode"
+
+//go:embed templates static
+var files embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"size": text.FormatSize,
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	},
+	"antiFeature": func(name string) string {
+		if d, ok := antiFeatures[name]; ok {
+			return d
+		}
+		return name
+	},
+	"search": func(app md.App) string {
+		return strings.ToLower(strings.Join(append([]string{app.Name, app.Summary, app.PackageName, app.AuthorName}, app.Categories...), " "))
+	},
+}).ParseFS(files, "templates/*.html"))
+
+// antiFeatures describes the anti-features, see https://f-droid.org/docs/Anti-Features/
+var antiFeatures = map[string]string{
+	"Ads":               "This app contains advertising",
+	"DisabledAlgorithm": "This app has a weak security signature",
+	"KnownVuln":         "This app contains a known security vulnerability",
+	"NSFW":              "This app contains content that should not be publicized or visible everywhere",
+	"NoSourceSince":     "The source code is no longer available",
+	"NonFreeAdd":        "This app promotes non-free add-ons",
+	"NonFreeAssets":     "This app contains non-free assets",
+	"NonFreeDep":        "This app depends on other non-free apps",
+	"NonFreeNet":        "This app promotes or depends entirely on a non-free network service",
+	"Tracking":          "This app tracks and reports your activity",
+	"UpstreamNonFree":   "The upstream source code is not entirely free",
+	"TetheredNet":       "This app depends entirely on a service that is controlled by the developers",
+}
+
+// Options configures the site
+type Options struct {
+	// Dir is where the site is written. It should be the fdroid directory, which contains the repo directory
+	Dir string
+	// QRCode is an image of the QR code for adding the repo, which is copied into Dir. By default, the QR code
+	// is generated if the repo is signed
+	QRCode string
+}
+
+// page is the data of all pages
+type page struct {
+	Title string
+	Repo  md.Repo
+	// Root is the path of the site directory relative to the page
+	Root string
+	// RepoPath is the path of the repo directory relative to the page
+	RepoPath string
+	// Favicon is the path of the favicon relative to the page, if there is one
+	Favicon string
+}
+
+type indexPage struct {
+	page
+	Apps   []md.App
+	QRCode string
+}
+
+type appPage struct {
+	page
+	App         md.App
+	Description template.HTML
+}
+
+// Generate writes the site for the index, whose APKs and icons are in repoDir
+func Generate(opts Options, repoDir string, index *apps.RepoIndex) (err error) {
+	appsPath := filepath.Join(opts.Dir, appsDir)
+
+	err = os.MkdirAll(appsPath, 0o755)
+	if err != nil {
+		return
+	}
+
+	err = copyStatic(opts.Dir)
+	if err != nil {
+		return fmt.Errorf("copying static files: %w", err)
+	}
+
+	qrCode := ""
+	if opts.QRCode != "" {
+		qrCode = qrCodeName + filepath.Ext(opts.QRCode)
+
+		err = copyFile(opts.QRCode, filepath.Join(opts.Dir, qrCode))
+		if err != nil {
+			return fmt.Errorf("copying QR code: %w", err)
+		}
+	}
+
+	indexData, err := md.NewData(index, repoDir, opts.Dir)
+	if err != nil {
+		return
+	}
+	err = indexData.WriteFiles()
+	if err != nil {
+		return
+	}
+	if qrCode == "" {
+		qrCode = indexData.Repo.QRCodeSVG
+	}
+
+	err = writePage(filepath.Join(opts.Dir, "index.html"), "index.html", indexPage{
+		page:   newPage(opts.Dir, opts.Dir, repoDir, indexData.Repo, indexData.Repo.Name),
+		Apps:   indexData.Apps,
+		QRCode: qrCode,
+	})
+	if err != nil {
+		return
+	}
+
+	appData, err := md.NewData(index, repoDir, appsPath)
+	if err != nil {
+		return
+	}
+
+	var pages = make(map[string]bool)
+	for _, app := range appData.Apps {
+		name := app.PackageName + ".html"
+		pages[name] = true
+
+		err = writePage(filepath.Join(appsPath, name), "app.html", appPage{
+			page:        newPage(appsPath, opts.Dir, repoDir, appData.Repo, app.Name),
+			App:         app,
+			Description: template.HTML(text.Sanitize(app.Description)),
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	// Pages of apps that were removed from the repo
+	entries, err := os.ReadDir(appsPath)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".html") && !pages[e.Name()] {
+			err = os.Remove(filepath.Join(appsPath, e.Name()))
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func newPage(pageDir, siteDir, repoDir string, repo md.Repo, title string) (p page) {
+	p = page{
+		Title:    title,
+		Repo:     repo,
+		Root:     relativePath(pageDir, siteDir),
+		RepoPath: relativePath(pageDir, repoDir),
+	}
+
+	if _, err := os.Stat(filepath.Join(siteDir, "favicon", "favicon.png")); err == nil {
+		p.Favicon = p.Root + "/favicon/favicon.png"
+	}
+
+	return
+}
+
+func writePage(path, name string, data interface{}) (err error) {
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return
+	}
+
+	err = templates.ExecuteTemplate(f, name, data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path + ".tmp")
+		return fmt.Errorf("generating %q: %w", path, err)
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// copyStatic copies the style sheet and scripts into dir
+func copyStatic(dir string) error {
+	return fs.WalkDir(files, "static", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := files.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(filepath.Join(dir, filepath.Base(path)), content, 0o644)
+	})
+}
+
+func copyFile(src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dst, content, 0o644)
+}
+
+func relativePath(base, path string) string {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,103 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"metascoop/apps"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "fdroid")
+	repoDir := filepath.Join(dir, "repo")
+
+	writeTestFile(t, filepath.Join(repoDir, "icons-320", "com.example.notes.10.png"), "icon")
+	writeTestFile(t, filepath.Join(dir, "qr.png"), "qr")
+	// Page of an app that is no longer in the repo
+	writeTestFile(t, filepath.Join(dir, appsDir, "com.example.removed.html"), "old")
+
+	index := &apps.RepoIndex{
+		Repo: map[string]interface{}{"name": "Test repo", "address": "https://example.com/fdroid/repo"},
+		Apps: []map[string]interface{}{
+			{
+				"packageName":  "com.example.notes",
+				"name":         "Notes <3",
+				"summary":      "Take notes",
+				"description":  `<p>Notes app</p><script>alert(1)</script>`,
+				"categories":   []interface{}{"Writing"},
+				"antiFeatures": []interface{}{"Tracking"},
+				"icon":         "com.example.notes.10.png",
+			},
+			{"packageName": "com.example.timer", "name": "Timer"},
+		},
+		Packages: map[string][]apps.PackageInfo{
+			"com.example.notes": {{VersionCode: 10, VersionName: "1.0", ApkName: "notes_10.apk", Size: 2048}},
+		},
+	}
+
+	err := Generate(Options{Dir: dir, QRCode: filepath.Join(dir, "qr.png")}, repoDir, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, wants := range map[string][]string{
+		"index.html": {
+			`<link rel="stylesheet" href="./style.css">`,
+			`<img class="qr-code" src="qrcode.png"`,
+			`data-search="notes &lt;3 take notes com.example.notes  writing"`,
+			`<a href="./apps/com.example.notes.html">`,
+			`src="repo/icons-320/com.example.notes.10.png"`,
+			`src="placeholder-icon.svg"`,
+			`<li class="badge" title="This app tracks and reports your activity">Tracking</li>`,
+		},
+		filepath.Join(appsDir, "com.example.notes.html"): {
+			`<h1>Notes &lt;3</h1>`,
+			`<p>Notes app</p>`,
+			`href="../repo/notes_10.apk"`,
+			`2.0 KiB`,
+			`src="../repo/icons-320/com.example.notes.10.png"`,
+		},
+		filepath.Join(appsDir, "com.example.timer.html"): {
+			`src="../placeholder-icon.svg"`,
+		},
+	} {
+		content, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s doesn't contain %q:\n%s", path, want, content)
+			}
+		}
+		if strings.Contains(string(content), "<script>alert") {
+			t.Errorf("%s contains the script of the description", path)
+		}
+	}
+
+	for _, name := range []string{"style.css", "search.js", "placeholder-icon.svg"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s wasn't written: %s", name, err.Error())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, appsDir, "com.example.removed.html")); !os.IsNotExist(err) {
+		t.Errorf("page of the removed app wasn't removed")
+	}
+}
@@ -0,0 +1,25 @@
+// Filters the app list on the index page while typing
+(function () {
+  var input = document.getElementById("search");
+  var apps = document.querySelectorAll(".app");
+  var empty = document.getElementById("no-results");
+
+  input.addEventListener("input", function () {
+    var terms = input.value.toLowerCase().split(/\s+/).filter(Boolean);
+    var shown = 0;
+
+    apps.forEach(function (app) {
+      var text = app.getAttribute("data-search");
+      var match = terms.every(function (term) {
+        return text.indexOf(term) >= 0;
+      });
+
+      app.hidden = !match;
+      if (match) {
+        shown++;
+      }
+    });
+
+    empty.hidden = shown > 0;
+  });
+})();
@@ -0,0 +1,288 @@
+// Package stats records how the apps do on their forges over time, e.g. their stars and download counts,
+// and summarizes it, which helps deciding which apps are worth maintaining
+package stats
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files written to the stats directory
+const (
+	HistoryName     = "history.json"
+	AppsCSVName     = "apps.csv"
+	ReleasesCSVName = "releases.csv"
+	SummaryName     = "summary.md"
+)
+
+// dateFormat is the format of Snapshot.Date, there is one snapshot per app and day
+const dateFormat = "2006-01-02"
+
+// Health thresholds: an app is flagged if its repository had no push or no release for this long
+const (
+	inactiveAfter   = 365 * 24 * time.Hour
+	noReleaseAfter  = 365 * 24 * time.Hour
+	downloadsPeriod = 30 * 24 * time.Hour
+)
+
+// Snapshot is the state of the repository of an app on one day
+type Snapshot struct {
+	Date string `json:"date"`
+	App  string `json:"app"`
+	// Repository is like "github.com/owner/name"
+	Repository string `json:"repository"`
+
+	Stars      int  `json:"stars"`
+	Forks      int  `json:"forks"`
+	OpenIssues int  `json:"open_issues"`
+	Archived   bool `json:"archived"`
+
+	PushedAt        time.Time `json:"pushed_at"`
+	LatestRelease   string    `json:"latest_release,omitempty"`
+	LatestReleaseAt time.Time `json:"latest_release_at"`
+
+	// Releases are the download counts of the APKs, if the forge counts downloads
+	Releases []Release `json:"releases,omitempty"`
+}
+
+// Release is the download count of the APK of a release
+type Release struct {
+	Tag       string `json:"tag"`
+	Downloads int    `json:"downloads"`
+}
+
+// NewSnapshot returns an empty snapshot of app for the day of t
+func NewSnapshot(t time.Time, app, repository string) Snapshot {
+	return Snapshot{Date: t.UTC().Format(dateFormat), App: app, Repository: repository}
+}
+
+// Downloads is the sum of the downloads of all releases
+func (s Snapshot) Downloads() (n int) {
+	for _, r := range s.Releases {
+		n += r.Downloads
+	}
+	return
+}
+
+func (s Snapshot) time() time.Time {
+	t, _ := time.Parse(dateFormat, s.Date)
+	return t
+}
+
+// Health describes problems of the repository, or is "ok"
+func (s Snapshot) Health() string {
+	var problems []string
+
+	if s.Archived {
+		problems = append(problems, "archived")
+	}
+	if !s.PushedAt.IsZero() && s.time().Sub(s.PushedAt) > inactiveAfter {
+		problems = append(problems, "no push since "+s.PushedAt.Format(dateFormat))
+	}
+	if !s.LatestReleaseAt.IsZero() && s.time().Sub(s.LatestReleaseAt) > noReleaseAfter {
+		problems = append(problems, "no release since "+s.LatestReleaseAt.Format(dateFormat))
+	}
+
+	if len(problems) == 0 {
+		return "ok"
+	}
+	return strings.Join(problems, ", ")
+}
+
+// History are the snapshots of all apps, oldest first
+type History struct {
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+// Read reads the history from dir. It is empty if there is none yet
+func Read(dir string) (h *History, err error) {
+	h = &History{}
+
+	path := filepath.Join(dir, HistoryName)
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(content, h)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", path, err)
+	}
+
+	return
+}
+
+// Add adds snapshots to the history. They replace snapshots of the same app and day
+func (h *History) Add(snapshots ...Snapshot) {
+	var replaced = make(map[string]bool)
+	for _, s := range snapshots {
+		replaced[s.Date+"\x00"+s.App] = true
+	}
+
+	var kept []Snapshot
+	for _, s := range h.Snapshots {
+		if !replaced[s.Date+"\x00"+s.App] {
+			kept = append(kept, s)
+		}
+	}
+
+	h.Snapshots = append(kept, snapshots...)
+	sort.SliceStable(h.Snapshots, func(i, j int) bool {
+		if h.Snapshots[i].Date != h.Snapshots[j].Date {
+			return h.Snapshots[i].Date < h.Snapshots[j].Date
+		}
+		return h.Snapshots[i].App < h.Snapshots[j].App
+	})
+}
+
+// Latest returns the newest snapshot of each app, the apps with the most downloads first
+func (h *History) Latest() (latest []Snapshot) {
+	var index = make(map[string]int)
+	for _, s := range h.Snapshots {
+		if i, ok := index[s.App]; ok {
+			latest[i] = s
+			continue
+		}
+
+		index[s.App] = len(latest)
+		latest = append(latest, s)
+	}
+
+	sort.SliceStable(latest, func(i, j int) bool {
+		if latest[i].Downloads() != latest[j].Downloads() {
+			return latest[i].Downloads() > latest[j].Downloads()
+		}
+		return latest[i].App < latest[j].App
+	})
+
+	return
+}
+
+// RecentDownloads returns how many downloads the app got in the 30 days before its latest snapshot. ok is
+// false if the history doesn't go back that far
+func (h *History) RecentDownloads(latest Snapshot) (n int, ok bool) {
+	start := latest.time().Add(-downloadsPeriod)
+
+	for i := len(h.Snapshots) - 1; i >= 0; i-- {
+		s := h.Snapshots[i]
+		if s.App == latest.App && !s.time().After(start) {
+			return latest.Downloads() - s.Downloads(), true
+		}
+	}
+
+	return 0, false
+}
+
+// Summary returns a Markdown table with the latest numbers of each app
+func (h *History) Summary() string {
+	var sb strings.Builder
+
+	sb.WriteString("| App | Stars | Downloads | Last 30 days | Latest release | Last push | Health |\n")
+	sb.WriteString("| --- | ---: | ---: | ---: | --- | --- | --- |\n")
+
+	for _, s := range h.Latest() {
+		recent := "–"
+		if n, ok := h.RecentDownloads(s); ok {
+			recent = strconv.Itoa(n)
+		}
+
+		release := s.LatestRelease
+		if !s.LatestReleaseAt.IsZero() {
+			release += " (" + s.LatestReleaseAt.Format(dateFormat) + ")"
+		}
+
+		fmt.Fprintf(&sb, "| [%s](https://%s) | %d | %d | %s | %s | %s | %s |\n",
+			escape(s.App), s.Repository, s.Stars, s.Downloads(), recent, escape(release), formatDate(s.PushedAt), s.Health())
+	}
+
+	return sb.String()
+}
+
+// Write writes the history as JSON and CSV files and the summary into dir
+func (h *History) Write(dir string) (err error) {
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return
+	}
+
+	content, err := json.MarshalIndent(h, "", "\t")
+	if err != nil {
+		return
+	}
+
+	var files = map[string][]byte{
+		HistoryName: append(content, '\n'),
+		SummaryName: []byte(h.Summary()),
+	}
+
+	files[AppsCSVName], files[ReleasesCSVName], err = h.csv()
+	if err != nil {
+		return
+	}
+
+	for name, content := range files {
+		err = os.WriteFile(filepath.Join(dir, name), content, 0o644)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// csv returns a table with a row for each snapshot and one with a row for each release of a snapshot
+func (h *History) csv() (appsCSV, releasesCSV []byte, err error) {
+	var appsBuf, releasesBuf bytes.Buffer
+
+	aw := csv.NewWriter(&appsBuf)
+	rw := csv.NewWriter(&releasesBuf)
+
+	_ = aw.Write([]string{"date", "app", "repository", "stars", "forks", "open_issues", "archived", "pushed_at", "latest_release", "latest_release_at", "downloads"})
+	_ = rw.Write([]string{"date", "app", "tag", "downloads"})
+
+	for _, s := range h.Snapshots {
+		_ = aw.Write([]string{
+			s.Date, s.App, s.Repository,
+			strconv.Itoa(s.Stars), strconv.Itoa(s.Forks), strconv.Itoa(s.OpenIssues), strconv.FormatBool(s.Archived),
+			formatDate(s.PushedAt), s.LatestRelease, formatDate(s.LatestReleaseAt),
+			strconv.Itoa(s.Downloads()),
+		})
+
+		for _, r := range s.Releases {
+			_ = rw.Write([]string{s.Date, s.App, r.Tag, strconv.Itoa(r.Downloads)})
+		}
+	}
+
+	aw.Flush()
+	rw.Flush()
+	if err = aw.Error(); err == nil {
+		err = rw.Error()
+	}
+
+	return appsBuf.Bytes(), releasesBuf.Bytes(), err
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(dateFormat)
+}
+
+// escape keeps text from breaking a Markdown table
+func escape(s string) string {
+	return strings.NewReplacer("|", "\\|", "[", "\\[", "]", "\\]", "\n", " ").Replace(s)
+}
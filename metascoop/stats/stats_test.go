@@ -0,0 +1,74 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).AddDate(0, 0, d)
+	}
+
+	notes := func(d, downloads int) Snapshot {
+		s := NewSnapshot(day(d), "notes", "github.com/example/notes")
+		s.Stars = 40 + d
+		s.PushedAt = day(d - 1)
+		s.LatestRelease = "v1.0"
+		s.LatestReleaseAt = day(-10)
+		s.Releases = []Release{{Tag: "v1.0", Downloads: downloads}, {Tag: "v0.9", Downloads: 100}}
+		return s
+	}
+
+	timer := NewSnapshot(day(40), "timer", "codeberg.org/example/timer")
+	timer.Archived = true
+	timer.PushedAt = day(-400)
+
+	h := &History{}
+	h.Add(notes(0, 10))
+	h.Add(notes(40, 50), timer)
+	// A second run on the same day replaces the snapshot
+	h.Add(notes(40, 60))
+
+	if len(h.Snapshots) != 3 {
+		t.Fatalf("history has %d snapshots, want 3: %+v", len(h.Snapshots), h.Snapshots)
+	}
+
+	summary := h.Summary()
+	for _, want := range []string{
+		"| [notes](https://github.com/example/notes) | 80 | 160 | 50 | v1.0 (2023-12-22) | 2024-02-09 | ok |",
+		"| [timer](https://codeberg.org/example/timer) | 0 | 0 | – |  | 2022-11-27 | archived, no push since 2022-11-27 |",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary doesn't contain %q:\n%s", want, summary)
+		}
+	}
+	if strings.Index(summary, "notes") > strings.Index(summary, "timer") {
+		t.Errorf("apps with more downloads aren't listed first:\n%s", summary)
+	}
+
+	dir := filepath.Join(t.TempDir(), "stats")
+	err := h.Write(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Summary() != summary {
+		t.Errorf("history changed when it was written and read")
+	}
+
+	releases, err := os.ReadFile(filepath.Join(dir, ReleasesCSVName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(releases), "2024-02-10,notes,v1.0,60\n") {
+		t.Errorf("releases.csv doesn't contain the downloads of v1.0:\n%s", releases)
+	}
+}
@@ -0,0 +1,479 @@
+package text
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	headingBlock
+	listBlock
+	quoteBlock
+	codeBlock
+	ruleBlock
+)
+
+type block struct {
+	kind blockKind
+
+	// level is the level of a heading
+	level int
+	// ordered is set for ordered lists
+	ordered bool
+
+	// lines is the content of paragraphs, headings and code blocks
+	lines []string
+	// items are the items of a list
+	items []listItem
+	// children are the blocks in a quote
+	children []block
+}
+
+type listItem struct {
+	text     string
+	children []block
+}
+
+var (
+	headingRegex  = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	ruleRegex     = regexp.MustCompile(`^ {0,3}([-*_])(?:\s*([-*_])){2,}\s*$`)
+	setextRegex   = regexp.MustCompile(`^ {0,3}(=+|-+)\s*$`)
+	listItemRegex = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])(?:\s+(.*))?$`)
+	fenceRegex    = regexp.MustCompile("^\\s*(```+|~~~+)")
+	quoteRegex    = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+)
+
+// parseBlocks splits markdown into its blocks. It supports the subset of CommonMark
+// that is commonly used in repository descriptions and release notes
+func parseBlocks(lines []string) (blocks []block) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		if strings.TrimSpace(line) == "" {
+			i++
+			continue
+		}
+
+		if m := fenceRegex.FindStringSubmatch(line); m != nil {
+			var code []string
+			i++
+			for ; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]) {
+					i++
+					break
+				}
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, block{kind: codeBlock, lines: code})
+			continue
+		}
+
+		if m := headingRegex.FindStringSubmatch(line); m != nil {
+			blocks = append(blocks, block{kind: headingBlock, level: len(m[1]), lines: []string{m[2]}})
+			i++
+			continue
+		}
+
+		if ruleRegex.MatchString(line) && isRule(line) {
+			blocks = append(blocks, block{kind: ruleBlock})
+			i++
+			continue
+		}
+
+		if quoteRegex.MatchString(line) {
+			var quoted []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				if m := quoteRegex.FindStringSubmatch(lines[i]); m != nil {
+					quoted = append(quoted, m[1])
+				} else {
+					quoted = append(quoted, lines[i])
+				}
+			}
+			blocks = append(blocks, block{kind: quoteBlock, children: parseBlocks(quoted)})
+			continue
+		}
+
+		if listItemRegex.MatchString(line) {
+			var b block
+			b, i = parseList(lines, i)
+			blocks = append(blocks, b)
+			continue
+		}
+
+		var paragraph []string
+		for ; i < len(lines); i++ {
+			l := lines[i]
+			if strings.TrimSpace(l) == "" || (len(paragraph) > 0 && startsBlock(l)) {
+				break
+			}
+
+			if len(paragraph) > 0 && setextRegex.MatchString(l) {
+				level := 2
+				if strings.Contains(l, "=") {
+					level = 1
+				}
+				blocks = append(blocks, block{kind: headingBlock, level: level, lines: []string{strings.Join(trimLines(paragraph), " ")}})
+				paragraph = nil
+				i++
+				break
+			}
+
+			paragraph = append(paragraph, l)
+		}
+		if len(paragraph) > 0 {
+			blocks = append(blocks, block{kind: paragraphBlock, lines: paragraph})
+		}
+	}
+
+	return
+}
+
+// isRule makes sure all characters of a thematic break are the same
+func isRule(line string) bool {
+	line = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, line)
+	return strings.Count(line, line[:1]) == len(line)
+}
+
+func startsBlock(line string) bool {
+	return headingRegex.MatchString(line) || fenceRegex.MatchString(line) ||
+		quoteRegex.MatchString(line) || listItemRegex.MatchString(line) ||
+		(ruleRegex.MatchString(line) && isRule(line) && !setextRegex.MatchString(line))
+}
+
+func indentation(line string) (n int) {
+	for _, r := range line {
+		switch r {
+		case ' ':
+			n++
+		case '\t':
+			n += 4
+		default:
+			return
+		}
+	}
+	return
+}
+
+// parseList parses the list starting at lines[start], including nested lists.
+// It returns the list and the index of the first line after it
+func parseList(lines []string, start int) (b block, next int) {
+	first := listItemRegex.FindStringSubmatch(lines[start])
+	baseIndent := len(first[1])
+
+	b.kind = listBlock
+	b.ordered = !strings.ContainsAny(first[2], "-*+")
+
+	i := start
+	for i < len(lines) {
+		line := lines[i]
+
+		if strings.TrimSpace(line) == "" {
+			// A blank line only continues the list if the next line belongs to it
+			j := i + 1
+			for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+				j++
+			}
+			if j >= len(lines) || (indentation(lines[j]) <= baseIndent && !listItemRegex.MatchString(lines[j])) {
+				break
+			}
+			i = j
+			continue
+		}
+
+		m := listItemRegex.FindStringSubmatch(line)
+		indent := indentation(line)
+
+		switch {
+		case m != nil && indent <= baseIndent:
+			if ordered := !strings.ContainsAny(m[2], "-*+"); ordered != b.ordered {
+				return b, i
+			}
+			b.items = append(b.items, listItem{text: strings.TrimSpace(m[3])})
+			i++
+		case len(b.items) == 0:
+			return b, i
+		case m != nil:
+			var nested block
+			nested, i = parseList(lines, i)
+			last := &b.items[len(b.items)-1]
+			last.children = append(last.children, nested)
+		case indent > baseIndent || !startsBlock(line):
+			// Continuation of the previous item, possibly a lazy one without indentation
+			last := &b.items[len(b.items)-1]
+			if len(last.children) > 0 {
+				return b, i
+			}
+			last.text = joinLines(last.text, line)
+			i++
+		default:
+			return b, i
+		}
+	}
+
+	return b, i
+}
+
+// joinLines appends line to text, keeping markers for hard line breaks
+func joinLines(text, line string) string {
+	line = strings.TrimLeft(line, " \t")
+	if text == "" {
+		return line
+	}
+	return text + "\n" + line
+}
+
+func trimLines(lines []string) []string {
+	var out = make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = strings.TrimSpace(l)
+	}
+	return out
+}
+
+// MarkdownToHTML converts markdown to the HTML subset supported by F-Droid clients. Raw HTML
+// in the input is kept, but all tags F-Droid doesn't support are removed, see Sanitize
+func MarkdownToHTML(markdown string) string {
+	blocks := parseBlocks(splitLines(markdown))
+
+	return Sanitize(renderBlocksHTML(blocks))
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimRight(s, "\n"), "\n")
+}
+
+func renderBlocksHTML(blocks []block) string {
+	var parts []string
+
+	for _, b := range blocks {
+		switch b.kind {
+		case paragraphBlock:
+			parts = append(parts, "<p>"+renderLinesHTML(b.lines)+"</p>")
+		case headingBlock:
+			parts = append(parts, fmt.Sprintf("<h%d>%s</h%d>", b.level, inlineHTML(b.lines[0]), b.level))
+		case codeBlock:
+			var escaped = make([]string, len(b.lines))
+			for i, l := range b.lines {
+				escaped[i] = html.EscapeString(l)
+			}
+			parts = append(parts, "<p><tt>"+strings.Join(escaped, "<br>\n")+"</tt></p>")
+		case quoteBlock:
+			parts = append(parts, "<blockquote>"+renderBlocksHTML(b.children)+"</blockquote>")
+		case listBlock:
+			tag := "ul"
+			if b.ordered {
+				tag = "ol"
+			}
+
+			var list strings.Builder
+			list.WriteString("<" + tag + ">\n")
+			for _, item := range b.items {
+				list.WriteString("<li>" + renderLinesHTML(strings.Split(item.text, "\n")))
+				if len(item.children) > 0 {
+					list.WriteString("\n" + renderBlocksHTML(item.children) + "\n")
+				}
+				list.WriteString("</li>\n")
+			}
+			list.WriteString("</" + tag + ">")
+
+			parts = append(parts, list.String())
+		case ruleBlock:
+			// There's no supported tag for horizontal lines
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// renderLinesHTML renders the lines of a paragraph, converting hard line breaks to <br>
+func renderLinesHTML(lines []string) string {
+	var out = make([]string, len(lines))
+
+	for i, l := range lines {
+		var lineBreak = i < len(lines)-1 && (strings.HasSuffix(l, "  ") || strings.HasSuffix(l, "\\"))
+
+		l = strings.TrimSpace(l)
+		if lineBreak {
+			l = strings.TrimSpace(strings.TrimSuffix(l, "\\"))
+		}
+
+		out[i] = inlineHTML(l)
+		if lineBreak {
+			out[i] += "<br>"
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+var (
+	linkRegex     = regexp.MustCompile(`^!?\[((?:[^\[\]\\]|\\.)*)\]\(\s*<?([^\s()<>]*(?:\([^\s()]*\)[^\s()<>]*)*)>?(?:\s+(?:"[^"]*"|'[^']*'))?\s*\)`)
+	autolinkRegex = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*)>`)
+	rawTagRegex   = regexp.MustCompile(`^</?[a-zA-Z][a-zA-Z0-9-]*(?:\s[^<>]*)?/?>`)
+	bareURLRegex  = regexp.MustCompile(`^https?://[^\s<>]+`)
+	entityRegex   = regexp.MustCompile(`^&(?:[a-zA-Z][a-zA-Z0-9]{1,31}|#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6});`)
+)
+
+var emphasisTags = []struct {
+	delimiter string
+	tag       string
+}{
+	{"**", "b"},
+	{"__", "b"},
+	{"~~", "strike"},
+	{"*", "i"},
+	{"_", "i"},
+}
+
+// inlineHTML renders inline markdown: code spans, emphasis, links, autolinks and raw HTML tags
+func inlineHTML(s string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		c := s[i]
+
+		switch {
+		case c == '\\' && len(rest) > 1 && isASCIIPunct(rest[1]):
+			out.WriteString(html.EscapeString(rest[1:2]))
+			i += 2
+			continue
+		case c == '`':
+			if content, n, ok := codeSpan(rest); ok {
+				out.WriteString("<tt>" + html.EscapeString(content) + "</tt>")
+				i += n
+				continue
+			}
+		case c == '[' || (c == '!' && strings.HasPrefix(rest, "![")):
+			if m := linkRegex.FindStringSubmatch(rest); m != nil {
+				label := inlineHTML(m[1])
+				if label == "" {
+					label = html.EscapeString(m[2])
+				}
+				out.WriteString(`<a href="` + html.EscapeString(m[2]) + `">` + label + "</a>")
+				i += len(m[0])
+				continue
+			}
+		case c == '<':
+			if m := autolinkRegex.FindStringSubmatch(rest); m != nil {
+				out.WriteString(`<a href="` + html.EscapeString(m[1]) + `">` + html.EscapeString(m[1]) + "</a>")
+				i += len(m[0])
+				continue
+			}
+			if m := rawTagRegex.FindString(rest); m != "" {
+				out.WriteString(m)
+				i += len(m)
+				continue
+			}
+		case c == '&':
+			if m := entityRegex.FindString(rest); m != "" {
+				out.WriteString(m)
+				i += len(m)
+				continue
+			}
+		case c == 'h' && (i == 0 || isURLStart(s[i-1])):
+			if m := bareURLRegex.FindString(rest); m != "" {
+				m = strings.TrimRight(m, ".,;:!?)'\"")
+				out.WriteString(`<a href="` + html.EscapeString(m) + `">` + html.EscapeString(m) + "</a>")
+				i += len(m)
+				continue
+			}
+		case c == '*' || c == '_' || c == '~':
+			if tag, inner, n, ok := emphasis(s, i); ok {
+				out.WriteString("<" + tag + ">" + inlineHTML(inner) + "</" + tag + ">")
+				i += n
+				continue
+			}
+		}
+
+		out.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+
+	return out.String()
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isURLStart(before byte) bool {
+	return before == ' ' || before == '\t' || before == '(' || before == '\n'
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// codeSpan returns the content of the code span at the start of s and its length in s
+func codeSpan(s string) (content string, n int, ok bool) {
+	ticks := len(s) - len(strings.TrimLeft(s, "`"))
+	delimiter := s[:ticks]
+
+	end := strings.Index(s[ticks:], delimiter)
+	if end < 0 {
+		return
+	}
+
+	content = s[ticks : ticks+end]
+	if strings.HasPrefix(content, " ") && strings.HasSuffix(content, " ") && strings.TrimSpace(content) != "" {
+		content = content[1 : len(content)-1]
+	}
+
+	return content, 2*ticks + end, true
+}
+
+// emphasis finds emphasis starting at s[i]. It returns the tag to use, the emphasized
+// text and the length of the whole emphasis including delimiters
+func emphasis(s string, i int) (tag string, inner string, n int, ok bool) {
+	rest := s[i:]
+
+	for _, e := range emphasisTags {
+		d := e.delimiter
+		if !strings.HasPrefix(rest, d) || len(rest) <= len(d) {
+			continue
+		}
+
+		// Intraword underscores, e.g. in snake_case, are not emphasis
+		if d[0] == '_' && i > 0 && isWordByte(s[i-1]) {
+			return
+		}
+
+		after := rest[len(d)]
+		if after == ' ' || after == '\t' || (len(d) == 1 && after == d[0]) {
+			continue
+		}
+
+		for j := len(d); j+len(d) <= len(rest); j++ {
+			if !strings.HasPrefix(rest[j:], d) {
+				continue
+			}
+
+			before := rest[j-1]
+			if before == ' ' || before == '\t' || j == len(d) {
+				continue
+			}
+			if len(d) == 1 && (before == d[0] || (j+1 < len(rest) && rest[j+1] == d[0])) {
+				continue
+			}
+			if d[0] == '_' && j+len(d) < len(rest) && isWordByte(rest[j+len(d)]) {
+				continue
+			}
+
+			return e.tag, rest[len(d):j], j + len(d), true
+		}
+	}
+
+	return
+}
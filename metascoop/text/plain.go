@@ -0,0 +1,163 @@
+package text
+
+import (
+	"fmt"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// MarkdownToText converts markdown to plain text, e.g. for changelogs that F-Droid clients
+// display without any formatting. List items are put on their own lines with a bullet,
+// links are written as "text (URL)" and all HTML tags are removed
+func MarkdownToText(markdown string) string {
+	blocks := parseBlocks(splitLines(markdown))
+
+	return strings.TrimSpace(renderBlocksText(blocks, ""))
+}
+
+func renderBlocksText(blocks []block, indent string) string {
+	var parts []string
+
+	for _, b := range blocks {
+		switch b.kind {
+		case paragraphBlock:
+			parts = append(parts, indentLines(renderLinesText(b.lines), indent))
+		case headingBlock:
+			parts = append(parts, indent+inlineText(b.lines[0]))
+		case codeBlock:
+			parts = append(parts, indentLines(strings.Join(b.lines, "\n"), indent))
+		case quoteBlock:
+			parts = append(parts, renderBlocksText(b.children, indent+"> "))
+		case listBlock:
+			var items []string
+			for n, item := range b.items {
+				bullet := "• "
+				if b.ordered {
+					bullet = fmt.Sprintf("%d. ", n+1)
+				}
+
+				itemText := renderLinesText(strings.Split(item.text, "\n"))
+				itemText = strings.ReplaceAll(itemText, "\n", "\n"+indent+strings.Repeat(" ", len([]rune(bullet))))
+				items = append(items, indent+bullet+itemText)
+
+				for _, child := range item.children {
+					items = append(items, renderBlocksText([]block{child}, indent+"  "))
+				}
+			}
+			parts = append(parts, strings.Join(items, "\n"))
+		case ruleBlock:
+			// A blank line between the surrounding blocks is enough
+		}
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+func indentLines(s string, indent string) string {
+	if indent == "" {
+		return s
+	}
+	return indent + strings.ReplaceAll(s, "\n", "\n"+indent)
+}
+
+// renderLinesText joins the lines of a paragraph. Only hard line breaks are kept,
+// other lines are joined with a space like they would be when rendered
+func renderLinesText(lines []string) string {
+	var out strings.Builder
+
+	for i, l := range lines {
+		var lineBreak = strings.HasSuffix(l, "  ") || strings.HasSuffix(l, "\\")
+
+		l = strings.TrimSpace(l)
+		if lineBreak {
+			l = strings.TrimSpace(strings.TrimSuffix(l, "\\"))
+		}
+
+		out.WriteString(inlineText(l))
+
+		if i < len(lines)-1 {
+			if lineBreak {
+				out.WriteString("\n")
+			} else {
+				out.WriteString(" ")
+			}
+		}
+	}
+
+	return out.String()
+}
+
+// inlineText renders inline markdown as plain text
+func inlineText(s string) string {
+	var (
+		out strings.Builder
+		z   = nethtml.NewTokenizer(strings.NewReader(inlineHTML(s)))
+
+		// hrefs is a stack of the links we are in, the URL is written after the link text
+		hrefs    []string
+		linkText []string
+	)
+
+	for {
+		tt := z.Next()
+		if tt == nethtml.ErrorToken {
+			break
+		}
+
+		tok := z.Token()
+
+		switch tt {
+		case nethtml.TextToken:
+			out.WriteString(tok.Data)
+			if len(linkText) > 0 {
+				linkText[len(linkText)-1] += tok.Data
+			}
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			switch tok.Data {
+			case "br":
+				out.WriteString("\n")
+			case "a":
+				var href string
+				for _, a := range tok.Attr {
+					if a.Key == "href" {
+						href = a.Val
+					}
+				}
+				hrefs = append(hrefs, href)
+				linkText = append(linkText, "")
+			}
+		case nethtml.EndTagToken:
+			if tok.Data != "a" || len(hrefs) == 0 {
+				continue
+			}
+
+			href, label := hrefs[len(hrefs)-1], linkText[len(linkText)-1]
+			hrefs, linkText = hrefs[:len(hrefs)-1], linkText[:len(linkText)-1]
+
+			if href != "" && href != label {
+				out.WriteString(" (" + href + ")")
+			}
+		}
+	}
+
+	return out.String()
+}
+
+// TruncateWithLink works like Truncate, but if s needs to be shortened, link is appended on its own
+// line so readers can find the full text. The result including the link is at most maxLength characters.
+// The link is left out if it leaves no room for any of the text
+func TruncateWithLink(s string, maxLength int, link string) string {
+	if len([]rune(s)) <= maxLength || link == "" {
+		return Truncate(s, maxLength)
+	}
+
+	suffix := "\n\n" + link
+
+	limit := maxLength - len([]rune(suffix))
+	if limit <= len([]rune(ellipsis)) {
+		return Truncate(s, maxLength)
+	}
+
+	return Truncate(s, limit) + suffix
+}
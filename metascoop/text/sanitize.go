@@ -0,0 +1,182 @@
+package text
+
+import (
+	"net/url"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// allowedTags are the HTML tags F-Droid clients render in app descriptions,
+// see https://f-droid.org/en/docs/Build_Metadata_Reference/#Description
+var allowedTags = map[string]bool{
+	"a":          true,
+	"b":          true,
+	"big":        true,
+	"blockquote": true,
+	"br":         true,
+	"cite":       true,
+	"dfn":        true,
+	"div":        true,
+	"em":         true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"i":          true,
+	"li":         true,
+	"ol":         true,
+	"p":          true,
+	"small":      true,
+	"strike":     true,
+	"strong":     true,
+	"sub":        true,
+	"sup":        true,
+	"tt":         true,
+	"u":          true,
+	"ul":         true,
+}
+
+// replacedTags are common tags that have an allowed equivalent
+var replacedTags = map[string]string{
+	"code": "tt",
+	"kbd":  "tt",
+	"samp": "tt",
+	"pre":  "div",
+	"s":    "strike",
+	"del":  "strike",
+	"ins":  "u",
+}
+
+// droppedTags are removed together with their content
+var droppedTags = map[string]bool{
+	"head":     true,
+	"iframe":   true,
+	"object":   true,
+	"script":   true,
+	"style":    true,
+	"template": true,
+	"title":    true,
+}
+
+var (
+	// textEscaper only escapes what is necessary to keep descriptions readable in metadata files
+	textEscaper      = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attributeEscaper = strings.NewReplacer("&", "&amp;", `"`, "&quot;")
+)
+
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// Sanitize removes all HTML tags and attributes F-Droid doesn't support from s. The text
+// content of removed tags is kept, except for tags like <script> whose content isn't text.
+// All tags that are still open at the end are closed
+func Sanitize(s string) string {
+	var (
+		out strings.Builder
+		z   = nethtml.NewTokenizer(strings.NewReader(s))
+
+		open []string
+		// dropping counts the nested dropped tags we are currently in
+		dropping int
+	)
+
+	for {
+		tt := z.Next()
+		if tt == nethtml.ErrorToken {
+			break
+		}
+
+		tok := z.Token()
+
+		switch tt {
+		case nethtml.TextToken:
+			if dropping == 0 {
+				out.WriteString(textEscaper.Replace(tok.Data))
+			}
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			if droppedTags[tok.Data] {
+				if tt == nethtml.StartTagToken {
+					dropping++
+				}
+				continue
+			}
+
+			name := allowedTag(tok.Data)
+			if dropping > 0 || name == "" {
+				continue
+			}
+
+			out.WriteString("<" + name)
+			if name == "a" {
+				if href, ok := safeHref(tok.Attr); ok {
+					out.WriteString(` href="` + attributeEscaper.Replace(href) + `"`)
+				}
+			}
+			out.WriteString(">")
+
+			if name != "br" && tt == nethtml.StartTagToken {
+				open = append(open, name)
+			}
+		case nethtml.EndTagToken:
+			if droppedTags[tok.Data] {
+				if dropping > 0 {
+					dropping--
+				}
+				continue
+			}
+
+			name := allowedTag(tok.Data)
+			if dropping > 0 || name == "" || name == "br" {
+				continue
+			}
+
+			// Close everything that was opened after this tag, ignore end tags that were never opened
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != name {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					out.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+
+	return out.String()
+}
+
+func allowedTag(name string) string {
+	if allowedTags[name] {
+		return name
+	}
+	return replacedTags[name]
+}
+
+func safeHref(attrs []nethtml.Attribute) (href string, ok bool) {
+	for _, a := range attrs {
+		if a.Key != "href" {
+			continue
+		}
+
+		u, err := url.Parse(strings.TrimSpace(a.Val))
+		if err != nil || !allowedSchemes[strings.ToLower(u.Scheme)] {
+			return "", false
+		}
+
+		return u.String(), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,85 @@
+package text
+
+import "testing"
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		input     string
+		maxLength int
+		want      string
+	}{
+		{"short", 80, "short"},
+		{"The quick brown fox jumps over the lazy dog", 20, "The quick brown..."},
+		{"Überprüfung der Änderungen", 15, "Überprüfung..."},
+		{"Donaudampfschifffahrtsgesellschaft", 10, "Donauda..."},
+		{"Donaudampfschifffahrtsgesellschaft", 0, ""},
+		{"Donaudampfschifffahrtsgesellschaft", -5, ""},
+		// A combining accent must stay with its letter
+		{"abcde\u0301fghij", 9, "abcde\u0301..."},
+		{"abcde\u0301fghij", 8, "abcd..."},
+		// Flags consist of two regional indicators that must not be split
+		{"ab\U0001F1E9\U0001F1EA\U0001F1EB\U0001F1F7cdefgh", 8, "ab\U0001F1E9\U0001F1EA..."},
+	}
+
+	for _, tt := range tests {
+		if got := Truncate(tt.input, tt.maxLength); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.input, tt.maxLength, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownToHTML(t *testing.T) {
+	const input = "# Title\n\nSome **bold**, _italic_ and `code` with a [link](https://example.com) and snake_case_name.\nSecond line\\\nafter break\n\n- One\n- Two\n  - Nested\n\n1. First\n2. Second\n\n<script>alert(1)</script><img src=x onerror=alert(1)>Grocy's <b onclick=\"x\">app</b> & more"
+
+	const want = "<h1>Title</h1>\n" +
+		"<p>Some <b>bold</b>, <i>italic</i> and <tt>code</tt> with a <a href=\"https://example.com\">link</a> and snake_case_name.\nSecond line<br>\nafter break</p>\n" +
+		"<ul>\n<li>One</li>\n<li>Two\n<ul>\n<li>Nested</li>\n</ul>\n</li>\n</ul>\n" +
+		"<ol>\n<li>First</li>\n<li>Second</li>\n</ol>\n" +
+		"<p>Grocy's <b>app</b> &amp; more</p>"
+
+	if got := MarkdownToHTML(input); got != want {
+		t.Errorf("MarkdownToHTML returned\n%s\nwanted\n%s", got, want)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	const input = `<div><a href="javascript:alert(1)">x</a><a href="https://example.com/?a=1&amp;b=2" target="_blank">y</a><code>z</code><span>w</span></b><i>unclosed`
+	const want = `<div><a>x</a><a href="https://example.com/?a=1&amp;b=2">y</a><tt>z</tt>w<i>unclosed</i></div>`
+
+	if got := Sanitize(input); got != want {
+		t.Errorf("Sanitize(%q) = %q, want %q", input, got, want)
+	}
+}
+
+func TestMarkdownToText(t *testing.T) {
+	const input = "## What's new\n\n* Fixed **crash** on start, see [#12](https://example.com/12)\n* Added `dark mode`\n  * Also for <b>widgets</b>\n\nThanks to https://example.com!"
+
+	const want = "What's new\n\n• Fixed crash on start, see #12 (https://example.com/12)\n• Added dark mode\n  • Also for widgets\n\nThanks to https://example.com!"
+
+	if got := MarkdownToText(input); got != want {
+		t.Errorf("MarkdownToText returned\n%s\nwanted\n%s", got, want)
+	}
+}
+
+func TestTruncateWithLink(t *testing.T) {
+	const link = "More: https://example.com"
+
+	tests := []struct {
+		input     string
+		maxLength int
+		want      string
+	}{
+		{"short text", 50, "short text"},
+		{"a long text that really does not fit into the limit", 40, "a long...\n\n" + link},
+		// The link doesn't fit, so the text is only truncated
+		{"a long text that really does not fit into the limit", 20, "a long text that..."},
+		{"a long text that really does not fit into the limit", 2, ".."},
+		{"a long text that really does not fit into the limit", 0, ""},
+	}
+
+	for _, tt := range tests {
+		if got := TruncateWithLink(tt.input, tt.maxLength, link); got != tt.want {
+			t.Errorf("TruncateWithLink(%q, %d) = %q, want %q", tt.input, tt.maxLength, got, tt.want)
+		}
+	}
+}
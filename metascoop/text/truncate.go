@@ -0,0 +1,97 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const ellipsis = "..."
+
+// Truncate shortens s to at most maxLength characters (runes). If s is too long, it is cut at
+// the last word boundary that fits and an ellipsis is appended. A cut never splits a
+// multi-byte character or a grapheme cluster, e.g. a letter with combining accents or an emoji sequence
+func Truncate(s string, maxLength int) string {
+	if maxLength <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= maxLength {
+		return s
+	}
+
+	limit := maxLength - utf8.RuneCountInString(ellipsis)
+	if limit <= 0 {
+		return string([]rune(ellipsis)[:maxLength])
+	}
+
+	var (
+		runes = []rune(s)
+		// lastGrapheme is the last grapheme boundary at or before limit
+		lastGrapheme int
+		// lastWord is the last boundary before whitespace at or before limit
+		lastWord int
+	)
+
+	for i := 1; i <= limit && i < len(runes); i++ {
+		if !isGraphemeBoundary(runes[i-1], runes[i], runes[:i]) {
+			continue
+		}
+
+		lastGrapheme = i
+		if unicode.IsSpace(runes[i]) && !unicode.IsSpace(runes[i-1]) {
+			lastWord = i
+		}
+	}
+
+	// Cutting at a word is only worth it if we don't lose too much of the text
+	cut := lastGrapheme
+	if lastWord > limit/2 {
+		cut = lastWord
+	}
+
+	return strings.TrimRightFunc(string(runes[:cut]), func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == ';' || r == ':' || r == '-'
+	}) + ellipsis
+}
+
+const (
+	zeroWidthJoiner = '\u200d'
+	regionalA       = '\U0001F1E6'
+	regionalZ       = '\U0001F1FF'
+)
+
+// isGraphemeBoundary reports whether there is a grapheme cluster boundary between prev and r.
+// This is a simplified version of the rules from Unicode Standard Annex #29 that covers
+// combining marks, emoji ZWJ sequences, variation selectors, skin tone modifiers, flags and CRLF
+func isGraphemeBoundary(prev, r rune, before []rune) bool {
+	switch {
+	case prev == '\r' && r == '\n':
+		return false
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+		return false
+	case r == zeroWidthJoiner || prev == zeroWidthJoiner:
+		return false
+	case r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0100 && r <= 0xE01EF:
+		// Variation selectors
+		return false
+	case r >= 0x1F3FB && r <= 0x1F3FF:
+		// Emoji skin tone modifiers
+		return false
+	case r >= 0xE0020 && r <= 0xE007F:
+		// Tag characters used in subdivision flags
+		return false
+	case isRegionalIndicator(prev) && isRegionalIndicator(r):
+		// Flags are pairs of regional indicators, so we only break after an even number of them
+		var count int
+		for i := len(before) - 1; i >= 0 && isRegionalIndicator(before[i]); i-- {
+			count++
+		}
+		return count%2 == 0
+	}
+
+	return true
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= regionalA && r <= regionalZ
+}
@@ -5,7 +5,8 @@ echo "::group::Building metascoop executable"
 go build -o metascoop
 echo "::endgroup::"
 
-./metascoop -ap=../apps.yaml -rd=../fdroid/repo -pat="$GH_ACCESS_TOKEN" $1
+# The token is passed in the environment, flags show up in process listings
+METASCOOP_TOKEN_GITHUB_COM="$GH_ACCESS_TOKEN" ./metascoop -ap=../apps.yaml -rd=../fdroid/repo $1
 EXIT_CODE=$?
 cd ..
 
@@ -13,6 +14,15 @@ echo "Scoop had an exit code of $EXIT_CODE"
 
 set -e
 
+commit_and_push() {
+    git config --global user.name 'github-actions'
+    git config --global user.email '41898282+github-actions[bot]@users.noreply.github.com'
+
+    git add .
+    git commit -m"Automated update"
+    git push
+}
+
 if [ $EXIT_CODE -eq 2 ]; then
     # Exit code 2 means that there were no significant changes
     echo "This means that there were no significant changes"
@@ -22,12 +32,26 @@ elif [ $EXIT_CODE -eq 0 ]; then
 
     echo "This means that we now have changes we should push"
 
-    git config --global user.name 'github-actions'
-    git config --global user.email '41898282+github-actions[bot]@users.noreply.github.com'
+    commit_and_push
+elif [ $EXIT_CODE -eq 3 ]; then
+    # Exit code 3 means that some apps failed, but the changes of the others should still be published
+    echo "This means that some apps failed, the changes of the other apps are pushed"
 
-    git add .
-    git commit -m"Automated update"
-    git push
+    commit_and_push
+
+    # The job doesn't fail, so that the pushed changes are still deployed. The failed apps are listed in the log
+    echo "::error title=Some apps failed::The changes of the other apps were pushed, see the group \"Failed apps\" of the log"
+    exit 0
+elif [ $EXIT_CODE -eq 4 ]; then
+    # Exit code 4 means that some apps failed and nothing else changed
+    echo "This means that some apps failed and there were no other significant changes"
+
+    exit $EXIT_CODE
+elif [ $EXIT_CODE -eq 130 ]; then
+    # Exit code 130 means that metascoop was stopped by SIGINT or SIGTERM, e.g. because the job was cancelled
+    echo "This means that the update was interrupted, nothing is committed"
+
+    exit $EXIT_CODE
 else 
     echo "This is an unexpected error"
 